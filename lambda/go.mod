@@ -1,9 +1,17 @@
 require (
+	github.com/apache/thrift v0.14.2 // indirect
 	github.com/aws/aws-lambda-go v1.20.0
 	github.com/aws/aws-sdk-go v1.36.0
 	github.com/kelseyhightower/envconfig v1.4.0
+	github.com/klauspost/compress v1.13.1 // indirect
+	github.com/linkedin/goavro/v2 v2.11.1
+	github.com/pierrec/lz4/v4 v4.1.8 // indirect
 	github.com/sirupsen/logrus v1.7.0
+	github.com/stretchr/objx v0.3.0 // indirect
 	github.com/stretchr/testify v1.6.1
+	github.com/xitongsys/parquet-go v1.6.1
+	github.com/xitongsys/parquet-go-source v0.0.0-20200817004010-026bad9b25d0
+	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
 
 module rdsauditlogss3
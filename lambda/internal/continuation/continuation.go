@@ -0,0 +1,118 @@
+package continuation
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"rdsauditlogss3/internal/entity"
+)
+
+// Continuation is passed to the next invocation if processing stopped before the deadline
+type Continuation struct {
+	// Chain is the number of invocations which have been continued in a row
+	Chain int `json:"chain"`
+	// Instances are the RDS instances which stopped before the deadline
+	Instances []Instance `json:"instances"`
+}
+
+// RdsInstanceIdentifiers returns the identifiers of the continued RDS instances
+func (c *Continuation) RdsInstanceIdentifiers() []string {
+	identifiers := make([]string, 0, len(c.Instances))
+	for _, instance := range c.Instances {
+		identifiers = append(identifiers, instance.RdsInstanceIdentifier)
+	}
+	return identifiers
+}
+
+// Instance is an RDS instance which stopped before the deadline and its checkpoint at that time
+type Instance struct {
+	RdsInstanceIdentifier string   `json:"rds_instance_identifier"`
+	LogFileTimestamp      int64    `json:"logfile_timestamp"`
+	ProcessedLogFiles     []string `json:"processed_logfiles,omitempty"`
+}
+
+// Event is the payload of an invocation started by a Continuer
+type Event struct {
+	Continuation *Continuation `json:"continuation,omitempty"`
+}
+
+// Continuer starts the next invocation of the lambda function
+type Continuer interface {
+	Continue(ctx context.Context, continuation Continuation) error
+}
+
+// Recorder collects the RDS instances which stopped before the deadline, it can be used by concurrent processors
+type Recorder struct {
+	mu        sync.Mutex
+	instances []Instance
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// Record adds an RDS instance with its checkpoint, nothing is recorded if r is nil
+func (r *Recorder) Record(rdsInstanceIdentifier string, checkpoint entity.CheckpointRecord) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.instances = append(r.instances, Instance{
+		RdsInstanceIdentifier: rdsInstanceIdentifier,
+		LogFileTimestamp:      checkpoint.LogFileTimestamp,
+		ProcessedLogFiles:     checkpoint.ProcessedLogFiles,
+	})
+}
+
+// Instances returns the recorded RDS instances ordered by their identifier
+func (r *Recorder) Instances() []Instance {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	instances := append([]Instance(nil), r.instances...)
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].RdsInstanceIdentifier < instances[j].RdsInstanceIdentifier
+	})
+	return instances
+}
+
+// Next returns the continuation of the stopped instances or nil if processing is not continued.
+// previous is the continuation of the current invocation, it is nil for scheduled invocations.
+// An instance whose checkpoint is the same as in previous has not made any progress and is not continued,
+// so a single log file which can't be processed before the deadline does not continue forever.
+// No continuation is returned once maxChain invocations have been continued in a row.
+func Next(previous *Continuation, stopped []Instance, maxChain int) *Continuation {
+	chain := 1
+	if previous != nil {
+		chain = previous.Chain + 1
+	}
+	if len(stopped) > 0 && chain > maxChain {
+		log.WithField("max_continuations", maxChain).Warn("Not continuing processing, the maximum number of continuations is reached")
+		return nil
+	}
+
+	next := &Continuation{Chain: chain}
+	for _, instance := range stopped {
+		if previous != nil && containsInstance(previous.Instances, instance) {
+			log.WithField("instance", instance.RdsInstanceIdentifier).WithField("logfile_timestamp", instance.LogFileTimestamp).Warn("Not continuing processing, the instance has not made progress")
+			continue
+		}
+		next.Instances = append(next.Instances, instance)
+	}
+	if len(next.Instances) == 0 {
+		return nil
+	}
+	return next
+}
+
+func containsInstance(instances []Instance, instance Instance) bool {
+	for _, i := range instances {
+		if reflect.DeepEqual(i, instance) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package continuation
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/lambda/lambdaiface"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"rdsauditlogss3/internal/entity"
+)
+
+type mockLambdaClient struct {
+	lambdaiface.LambdaAPI
+	mock.Mock
+}
+
+func (m *mockLambdaClient) InvokeWithContext(ctx aws.Context, input *lambda.InvokeInput, opts ...request.Option) (*lambda.InvokeOutput, error) {
+	args := m.MethodCalled("Invoke", input)
+	return args.Get(0).(*lambda.InvokeOutput), args.Error(1)
+}
+
+type mockSQSClient struct {
+	sqsiface.SQSAPI
+	mock.Mock
+}
+
+func (m *mockSQSClient) SendMessageWithContext(ctx aws.Context, input *sqs.SendMessageInput, opts ...request.Option) (*sqs.SendMessageOutput, error) {
+	args := m.MethodCalled("SendMessage", input)
+	return args.Get(0).(*sqs.SendMessageOutput), args.Error(1)
+}
+
+func TestRecorder(t *testing.T) {
+	recorder := NewRecorder()
+	recorder.Record("my-instance-2", entity.CheckpointRecord{LogFileTimestamp: 2, ProcessedLogFiles: []string{"identity-2"}})
+	recorder.Record("my-instance-1", entity.CheckpointRecord{LogFileTimestamp: 1})
+
+	assert.Equal(t, []Instance{
+		{RdsInstanceIdentifier: "my-instance-1", LogFileTimestamp: 1},
+		{RdsInstanceIdentifier: "my-instance-2", LogFileTimestamp: 2, ProcessedLogFiles: []string{"identity-2"}},
+	}, recorder.Instances())
+
+	// Processors without a recorder don't record anything
+	var noRecorder *Recorder
+	noRecorder.Record("my-instance-1", entity.CheckpointRecord{LogFileTimestamp: 1})
+}
+
+func TestNext(t *testing.T) {
+	instance1 := Instance{RdsInstanceIdentifier: "my-instance-1", LogFileTimestamp: 1}
+	instance1Progress := Instance{RdsInstanceIdentifier: "my-instance-1", LogFileTimestamp: 1, ProcessedLogFiles: []string{"identity-1"}}
+	instance2 := Instance{RdsInstanceIdentifier: "my-instance-2", LogFileTimestamp: 2}
+
+	tests := []struct {
+		name     string
+		previous *Continuation
+		stopped  []Instance
+		expected *Continuation
+	}{
+		{"nothing stopped", nil, nil, nil},
+		{"scheduled invocation", nil, []Instance{instance1, instance2}, &Continuation{Chain: 1, Instances: []Instance{instance1, instance2}}},
+		{"continued invocation", &Continuation{Chain: 1, Instances: []Instance{instance1}}, []Instance{instance1Progress}, &Continuation{Chain: 2, Instances: []Instance{instance1Progress}}},
+		{"no progress", &Continuation{Chain: 1, Instances: []Instance{instance1, instance2}}, []Instance{instance1, instance2}, nil},
+		{"partial progress", &Continuation{Chain: 1, Instances: []Instance{instance1, instance2}}, []Instance{instance1Progress, instance2}, &Continuation{Chain: 2, Instances: []Instance{instance1Progress}}},
+		{"chain limit", &Continuation{Chain: 3, Instances: []Instance{instance1}}, []Instance{instance1Progress}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Next(tt.previous, tt.stopped, 3))
+		})
+	}
+}
+
+func TestLambdaContinuer(t *testing.T) {
+	lambdaClient := new(mockLambdaClient)
+	continuer := NewLambdaContinuer(lambdaClient, "my-function")
+
+	lambdaClient.On("Invoke", &lambda.InvokeInput{
+		FunctionName:   aws.String("my-function"),
+		InvocationType: aws.String("Event"),
+		Payload:        []byte(`{"continuation":{"chain":1,"instances":[{"rds_instance_identifier":"my-instance-1","logfile_timestamp":1}]}}`),
+	}).Return(&lambda.InvokeOutput{}, nil)
+
+	err := continuer.Continue(context.Background(), Continuation{
+		Chain:     1,
+		Instances: []Instance{{RdsInstanceIdentifier: "my-instance-1", LogFileTimestamp: 1}},
+	})
+	assert.NoError(t, err)
+
+	lambdaClient.AssertExpectations(t)
+}
+
+func TestSQSContinuer(t *testing.T) {
+	sqsClient := new(mockSQSClient)
+	continuer := NewSQSContinuer(sqsClient, "https://sqs.eu-central-1.amazonaws.com/123456789012/my-queue")
+
+	continuation := Continuation{
+		Chain:     2,
+		Instances: []Instance{{RdsInstanceIdentifier: "my-instance-1", LogFileTimestamp: 1, ProcessedLogFiles: []string{"identity-1"}}},
+	}
+	sqsClient.On("SendMessage", mock.MatchedBy(func(input *sqs.SendMessageInput) bool {
+		var event Event
+		err := json.Unmarshal([]byte(*input.MessageBody), &event)
+		return err == nil &&
+			*input.QueueUrl == "https://sqs.eu-central-1.amazonaws.com/123456789012/my-queue" &&
+			assert.ObjectsAreEqual(&continuation, event.Continuation)
+	})).Return(&sqs.SendMessageOutput{}, nil)
+
+	err := continuer.Continue(context.Background(), continuation)
+	assert.NoError(t, err)
+
+	sqsClient.AssertExpectations(t)
+}
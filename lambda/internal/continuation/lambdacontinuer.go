@@ -0,0 +1,41 @@
+package continuation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/lambda/lambdaiface"
+)
+
+// LambdaContinuer invokes the lambda function asynchronously with the continuation
+type LambdaContinuer struct {
+	lambda       lambdaiface.LambdaAPI
+	functionName string
+}
+
+func NewLambdaContinuer(api lambdaiface.LambdaAPI, functionName string) *LambdaContinuer {
+	return &LambdaContinuer{
+		lambda:       api,
+		functionName: functionName,
+	}
+}
+
+func (l *LambdaContinuer) Continue(ctx context.Context, continuation Continuation) error {
+	payload, err := json.Marshal(Event{Continuation: &continuation})
+	if err != nil {
+		return fmt.Errorf("could not marshal continuation: %v", err)
+	}
+
+	_, err = l.lambda.InvokeWithContext(ctx, &lambda.InvokeInput{
+		FunctionName:   aws.String(l.functionName),
+		InvocationType: aws.String(lambda.InvocationTypeEvent),
+		Payload:        payload,
+	})
+	if err != nil {
+		return fmt.Errorf("could not invoke lambda function %s: %v", l.functionName, err)
+	}
+	return nil
+}
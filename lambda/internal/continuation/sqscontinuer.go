@@ -0,0 +1,40 @@
+package continuation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+)
+
+// SQSContinuer sends the continuation to a queue which triggers the lambda function
+type SQSContinuer struct {
+	sqs      sqsiface.SQSAPI
+	queueURL string
+}
+
+func NewSQSContinuer(api sqsiface.SQSAPI, queueURL string) *SQSContinuer {
+	return &SQSContinuer{
+		sqs:      api,
+		queueURL: queueURL,
+	}
+}
+
+func (s *SQSContinuer) Continue(ctx context.Context, continuation Continuation) error {
+	body, err := json.Marshal(Event{Continuation: &continuation})
+	if err != nil {
+		return fmt.Errorf("could not marshal continuation: %v", err)
+	}
+
+	_, err = s.sqs.SendMessageWithContext(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(s.queueURL),
+		MessageBody: aws.String(string(body)),
+	})
+	if err != nil {
+		return fmt.Errorf("could not send continuation to %s: %v", s.queueURL, err)
+	}
+	return nil
+}
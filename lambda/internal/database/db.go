@@ -1,9 +1,16 @@
 package database
 
-import "rdsauditlogss3/internal/entity"
+import (
+	"context"
+
+	"rdsauditlogss3/internal/entity"
+)
 
 // Database is the high-level interface for interacting with dynamodb
 type Database interface {
-	StoreCheckpoint(checkpoint *entity.CheckpointRecord) error
-	GetCheckpoint(id string) (*entity.CheckpointRecord, error)
+	StoreCheckpoint(ctx context.Context, checkpoint *entity.CheckpointRecord) error
+	GetCheckpoint(ctx context.Context, id string) (*entity.CheckpointRecord, error)
+	StoreMembership(ctx context.Context, membership *entity.MembershipRecord) error
+	GetMembership(ctx context.Context, id string) (*entity.MembershipRecord, error)
+	StoreGap(ctx context.Context, gap *entity.GapRecord) error
 }
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
@@ -11,8 +12,30 @@ import (
 
 // Internal checkpoint record for DynamoDB
 type dynamoDBCheckpointRecord struct {
-	LogFileTimestamp int64  `dynamodbav:"logfile_timestamp,omitempty"`
-	Id               string `dynamodbav:"id,omitempty"`
+	LogFileTimestamp         int64    `dynamodbav:"logfile_timestamp,omitempty"`
+	Id                       string   `dynamodbav:"id,omitempty"`
+	ActiveLogFileMarker      string   `dynamodbav:"active_logfile_marker,omitempty"`
+	ActiveLogFileOffset      int64    `dynamodbav:"active_logfile_offset,omitempty"`
+	ActiveLogFilePartialLine string   `dynamodbav:"active_logfile_partial_line,omitempty"`
+	ActiveLogFileLines       int64    `dynamodbav:"active_logfile_lines,omitempty"`
+	ProcessedLogFiles        []string `dynamodbav:"processed_logfiles,omitempty"`
+	LogFileSha256            string   `dynamodbav:"logfile_sha256,omitempty"`
+}
+
+// Internal membership record for DynamoDB
+type dynamoDBMembershipRecord struct {
+	Members []string `dynamodbav:"members"`
+	Id      string   `dynamodbav:"id,omitempty"`
+}
+
+// Internal gap record for DynamoDB
+type dynamoDBGapRecord struct {
+	Id                    string `dynamodbav:"id,omitempty"`
+	RdsInstanceIdentifier string `dynamodbav:"rds_instance_identifier"`
+	From                  int64  `dynamodbav:"from_timestamp"`
+	To                    int64  `dynamodbav:"to_timestamp"`
+	LogFileName           string `dynamodbav:"logfile_name"`
+	DetectedAt            int64  `dynamodbav:"detected_at"`
 }
 
 // DatabaseDynamo persists checkpoints
@@ -30,10 +53,16 @@ func NewDynamoDb(dynamoDBClient dynamodbiface.DynamoDBAPI, tableName string) *Da
 }
 
 // StoreCheckpoint puts a checkpoint into the database
-func (db *DatabaseDynamo) StoreCheckpoint(record *entity.CheckpointRecord) error {
+func (db *DatabaseDynamo) StoreCheckpoint(ctx context.Context, record *entity.CheckpointRecord) error {
 	attributeValues, err := dynamodbattribute.MarshalMap(&dynamoDBCheckpointRecord{
-		LogFileTimestamp: record.LogFileTimestamp,
-		Id:               record.Id,
+		LogFileTimestamp:         record.LogFileTimestamp,
+		Id:                       record.Id,
+		ActiveLogFileMarker:      record.ActiveLogFile.Marker,
+		ActiveLogFileOffset:      record.ActiveLogFile.Offset,
+		ActiveLogFilePartialLine: record.ActiveLogFile.PartialLine,
+		ActiveLogFileLines:       record.ActiveLogFile.Lines,
+		ProcessedLogFiles:        record.ProcessedLogFiles,
+		LogFileSha256:            record.LogFileSha256,
 	})
 	if err != nil {
 		return fmt.Errorf("failed DynamoDB marshal Record: %v", err)
@@ -44,7 +73,7 @@ func (db *DatabaseDynamo) StoreCheckpoint(record *entity.CheckpointRecord) error
 		Item:      attributeValues,
 	}
 
-	_, err = db.client.PutItem(putItemInput)
+	_, err = db.client.PutItemWithContext(ctx, putItemInput)
 	if err != nil {
 		return fmt.Errorf("failed to save checkpoint to dynamodb: %v", err)
 	}
@@ -53,8 +82,8 @@ func (db *DatabaseDynamo) StoreCheckpoint(record *entity.CheckpointRecord) error
 }
 
 // GetCheckpoint retrieves a checkpoint from the database
-func (db *DatabaseDynamo) GetCheckpoint(id string) (*entity.CheckpointRecord, error) {
-	out, err := db.client.GetItem(&dynamodb.GetItemInput{
+func (db *DatabaseDynamo) GetCheckpoint(ctx context.Context, id string) (*entity.CheckpointRecord, error) {
+	out, err := db.client.GetItemWithContext(ctx, &dynamodb.GetItemInput{
 		Key: map[string]*dynamodb.AttributeValue{
 			"id": {S: aws.String(id)},
 		},
@@ -75,7 +104,94 @@ func (db *DatabaseDynamo) GetCheckpoint(id string) (*entity.CheckpointRecord, er
 	}
 
 	return &entity.CheckpointRecord{
-		LogFileTimestamp: record.LogFileTimestamp,
-		Id:               record.Id,
+		LogFileTimestamp:  record.LogFileTimestamp,
+		Id:                record.Id,
+		ProcessedLogFiles: record.ProcessedLogFiles,
+		LogFileSha256:     record.LogFileSha256,
+		ActiveLogFile: entity.ActiveLogFileCheckpoint{
+			Marker:      record.ActiveLogFileMarker,
+			Offset:      record.ActiveLogFileOffset,
+			PartialLine: record.ActiveLogFilePartialLine,
+			Lines:       record.ActiveLogFileLines,
+		},
 	}, nil
 }
+
+// StoreMembership puts the known members of a group of RDS instances into the database
+func (db *DatabaseDynamo) StoreMembership(ctx context.Context, record *entity.MembershipRecord) error {
+	members := record.Members
+	if members == nil {
+		members = []string{}
+	}
+
+	attributeValues, err := dynamodbattribute.MarshalMap(&dynamoDBMembershipRecord{
+		Members: members,
+		Id:      record.Id,
+	})
+	if err != nil {
+		return fmt.Errorf("failed DynamoDB marshal Record: %v", err)
+	}
+
+	_, err = db.client.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(db.tableName),
+		Item:      attributeValues,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save membership to dynamodb: %v", err)
+	}
+
+	return nil
+}
+
+// GetMembership retrieves the known members of a group of RDS instances from the database
+func (db *DatabaseDynamo) GetMembership(ctx context.Context, id string) (*entity.MembershipRecord, error) {
+	out, err := db.client.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(id)},
+		},
+		TableName: aws.String(db.tableName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting membership from DynamoDB: %v", err)
+	}
+
+	if out.Item == nil {
+		return nil, nil
+	}
+
+	var record dynamoDBMembershipRecord
+	err = dynamodbattribute.UnmarshalMap(out.Item, &record)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling record from DynamoDB: %v", err)
+	}
+
+	return &entity.MembershipRecord{
+		Members: record.Members,
+		Id:      record.Id,
+	}, nil
+}
+
+// StoreGap puts a detected gap in the audit logs into the database
+func (db *DatabaseDynamo) StoreGap(ctx context.Context, record *entity.GapRecord) error {
+	attributeValues, err := dynamodbattribute.MarshalMap(&dynamoDBGapRecord{
+		Id:                    record.Id,
+		RdsInstanceIdentifier: record.RdsInstanceIdentifier,
+		From:                  record.From,
+		To:                    record.To,
+		LogFileName:           record.LogFileName,
+		DetectedAt:            record.DetectedAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed DynamoDB marshal Record: %v", err)
+	}
+
+	_, err = db.client.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(db.tableName),
+		Item:      attributeValues,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save gap to dynamodb: %v", err)
+	}
+
+	return nil
+}
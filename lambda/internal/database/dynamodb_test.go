@@ -1,7 +1,9 @@
 package database
 
 import (
+	"context"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
 	"github.com/stretchr/testify/assert"
@@ -16,13 +18,13 @@ type mockDynamoDBClient struct {
 	mock.Mock
 }
 
-func (m *mockDynamoDBClient) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
-	args := m.Called(input)
+func (m *mockDynamoDBClient) PutItemWithContext(ctx aws.Context, input *dynamodb.PutItemInput, opts ...request.Option) (*dynamodb.PutItemOutput, error) {
+	args := m.MethodCalled("PutItem", input)
 	return args.Get(0).(*dynamodb.PutItemOutput), args.Error(1)
 }
 
-func (m *mockDynamoDBClient) GetItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
-	args := m.Called(input)
+func (m *mockDynamoDBClient) GetItemWithContext(ctx aws.Context, input *dynamodb.GetItemInput, opts ...request.Option) (*dynamodb.GetItemOutput, error) {
+	args := m.MethodCalled("GetItem", input)
 	return args.Get(0).(*dynamodb.GetItemOutput), args.Error(1)
 }
 
@@ -46,7 +48,7 @@ func TestStoreCheckpoint(t *testing.T) {
 	}
 	dynamoDBClient.On("PutItem", expectedDynamoDBInput).Return(&dynamodb.PutItemOutput{}, nil)
 
-	err := db.StoreCheckpoint(&entity.CheckpointRecord{
+	err := db.StoreCheckpoint(context.Background(), &entity.CheckpointRecord{
 		Id:               someID,
 		LogFileTimestamp: someMarker,
 	})
@@ -54,6 +56,62 @@ func TestStoreCheckpoint(t *testing.T) {
 	dynamoDBClient.AssertExpectations(t)
 }
 
+func TestStoreCheckpointActiveLogFile(t *testing.T) {
+	dynamoDBClient := new(mockDynamoDBClient)
+	db := NewDynamoDb(dynamoDBClient, TestTableName)
+
+	expectedDynamoDBInput := &dynamodb.PutItemInput{
+		TableName: aws.String(TestTableName),
+		Item: map[string]*dynamodb.AttributeValue{
+			"id":                          {S: aws.String("1")},
+			"logfile_timestamp":           {N: aws.String("2")},
+			"active_logfile_marker":       {S: aws.String("0:1234")},
+			"active_logfile_offset":       {N: aws.String("1200")},
+			"active_logfile_partial_line": {S: aws.String("20200714 07:05")},
+			"active_logfile_lines":        {N: aws.String("42")},
+		},
+	}
+	dynamoDBClient.On("PutItem", expectedDynamoDBInput).Return(&dynamodb.PutItemOutput{}, nil)
+
+	err := db.StoreCheckpoint(context.Background(), &entity.CheckpointRecord{
+		Id:               "1",
+		LogFileTimestamp: 2,
+		ActiveLogFile: entity.ActiveLogFileCheckpoint{
+			Marker:      "0:1234",
+			Offset:      1200,
+			PartialLine: "20200714 07:05",
+			Lines:       42,
+		},
+	})
+	assert.NoError(t, err)
+	dynamoDBClient.AssertExpectations(t)
+}
+
+func TestStoreCheckpointProcessedLogFile(t *testing.T) {
+	dynamoDBClient := new(mockDynamoDBClient)
+	db := NewDynamoDb(dynamoDBClient, TestTableName)
+
+	expectedDynamoDBInput := &dynamodb.PutItemInput{
+		TableName: aws.String(TestTableName),
+		Item: map[string]*dynamodb.AttributeValue{
+			"id":                 {S: aws.String("1")},
+			"logfile_timestamp":  {N: aws.String("2")},
+			"processed_logfiles": {L: []*dynamodb.AttributeValue{{S: aws.String("2-100-abc")}, {S: aws.String("2-200-def")}}},
+			"logfile_sha256":     {S: aws.String("abc")},
+		},
+	}
+	dynamoDBClient.On("PutItem", expectedDynamoDBInput).Return(&dynamodb.PutItemOutput{}, nil)
+
+	err := db.StoreCheckpoint(context.Background(), &entity.CheckpointRecord{
+		Id:                "1",
+		LogFileTimestamp:  2,
+		ProcessedLogFiles: []string{"2-100-abc", "2-200-def"},
+		LogFileSha256:     "abc",
+	})
+	assert.NoError(t, err)
+	dynamoDBClient.AssertExpectations(t)
+}
+
 func TestGetCheckpoint(t *testing.T) {
 	dynamoDBClient := new(mockDynamoDBClient)
 	db := NewDynamoDb(dynamoDBClient, TestTableName)
@@ -75,7 +133,7 @@ func TestGetCheckpoint(t *testing.T) {
 	}
 	dynamoDBClient.On("GetItem", expectedDynamoDBInput).Return(expectedDynamoDBOuput, nil)
 
-	record, err := db.GetCheckpoint(someID)
+	record, err := db.GetCheckpoint(context.Background(), someID)
 	assert.NoError(t, err)
 	assert.Equal(t, &entity.CheckpointRecord{
 		Id:               someID,
@@ -83,3 +141,91 @@ func TestGetCheckpoint(t *testing.T) {
 	}, record)
 	dynamoDBClient.AssertExpectations(t)
 }
+
+func TestStoreMembership(t *testing.T) {
+	dynamoDBClient := new(mockDynamoDBClient)
+	db := NewDynamoDb(dynamoDBClient, TestTableName)
+
+	someID := "my-cluster:members"
+
+	expectedDynamoDBInput := &dynamodb.PutItemInput{
+		TableName: aws.String(TestTableName),
+		Item: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(someID)},
+			"members": {L: []*dynamodb.AttributeValue{
+				{S: aws.String("my-instance-1")},
+				{S: aws.String("my-instance-2")},
+			}},
+		},
+	}
+	dynamoDBClient.On("PutItem", expectedDynamoDBInput).Return(&dynamodb.PutItemOutput{}, nil)
+
+	err := db.StoreMembership(context.Background(), &entity.MembershipRecord{
+		Id:      someID,
+		Members: []string{"my-instance-1", "my-instance-2"},
+	})
+	assert.NoError(t, err)
+	dynamoDBClient.AssertExpectations(t)
+}
+
+func TestGetMembership(t *testing.T) {
+	dynamoDBClient := new(mockDynamoDBClient)
+	db := NewDynamoDb(dynamoDBClient, TestTableName)
+
+	someID := "my-cluster:members"
+
+	expectedDynamoDBInput := &dynamodb.GetItemInput{
+		TableName: aws.String(TestTableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: &someID},
+		},
+	}
+	expectedDynamoDBOuput := &dynamodb.GetItemOutput{
+		Item: map[string]*dynamodb.AttributeValue{
+			"id": {S: &someID},
+			"members": {L: []*dynamodb.AttributeValue{
+				{S: aws.String("my-instance-1")},
+			}},
+		},
+	}
+	dynamoDBClient.On("GetItem", expectedDynamoDBInput).Return(expectedDynamoDBOuput, nil)
+
+	record, err := db.GetMembership(context.Background(), someID)
+	assert.NoError(t, err)
+	assert.Equal(t, &entity.MembershipRecord{
+		Id:      someID,
+		Members: []string{"my-instance-1"},
+	}, record)
+	dynamoDBClient.AssertExpectations(t)
+}
+
+func TestStoreGap(t *testing.T) {
+	dynamoDBClient := new(mockDynamoDBClient)
+	db := NewDynamoDb(dynamoDBClient, TestTableName)
+
+	someID := "my-instance:gap:1595256406000"
+
+	expectedDynamoDBInput := &dynamodb.PutItemInput{
+		TableName: aws.String(TestTableName),
+		Item: map[string]*dynamodb.AttributeValue{
+			"id":                      {S: aws.String(someID)},
+			"rds_instance_identifier": {S: aws.String("my-instance")},
+			"from_timestamp":          {N: aws.String("1595256406000")},
+			"to_timestamp":            {N: aws.String("1595262837000")},
+			"logfile_name":            {S: aws.String("audit/server_audit.log.3")},
+			"detected_at":             {N: aws.String("1595263000000")},
+		},
+	}
+	dynamoDBClient.On("PutItem", expectedDynamoDBInput).Return(&dynamodb.PutItemOutput{}, nil)
+
+	err := db.StoreGap(context.Background(), &entity.GapRecord{
+		Id:                    someID,
+		RdsInstanceIdentifier: "my-instance",
+		From:                  1595256406000,
+		To:                    1595262837000,
+		LogFileName:           "audit/server_audit.log.3",
+		DetectedAt:            1595263000000,
+	})
+	assert.NoError(t, err)
+	dynamoDBClient.AssertExpectations(t)
+}
@@ -0,0 +1,73 @@
+package entity
+
+import "time"
+
+// Operations of the MariaDB audit plugin and Aurora MySQL advanced auditing
+const (
+	OperationConnect          = "CONNECT"
+	OperationDisconnect       = "DISCONNECT"
+	OperationFailedConnect    = "FAILED_CONNECT"
+	OperationChangeUser       = "CHANGEUSER"
+	OperationQuery            = "QUERY"
+	OperationQueryDDL         = "QUERY_DDL"
+	OperationQueryDML         = "QUERY_DML"
+	OperationQueryDMLNoSelect = "QUERY_DML_NO_SELECT"
+	OperationQueryDCL         = "QUERY_DCL"
+	OperationRead             = "READ"
+	OperationWrite            = "WRITE"
+	OperationCreate           = "CREATE"
+	OperationAlter            = "ALTER"
+	OperationRename           = "RENAME"
+	OperationDrop             = "DROP"
+)
+
+// AuditEvent is a single record of an audit log
+type AuditEvent struct {
+	Timestamp  time.Time
+	ServerHost string
+	Username   string
+	// Host is the host or IP address the client connected from
+	Host         string
+	ConnectionID int64
+	QueryID      int64
+	// Operation is the type of the event, eg. CONNECT, QUERY or TABLE operations like READ and WRITE
+	Operation string
+	Database  string
+	// Object is the query text for queries and the table name for table operations
+	Object string
+	// RetCode is the error code returned by the database, 0 means success
+	RetCode int
+	// Raw is the text of the record as written to the log file
+	Raw string
+	// Line is the number of the first line of the record in the log file, starting at 1
+	Line int64
+}
+
+// AuditEventReader returns the audit events of a log entry one after another.
+// io.EOF is returned if there are no more events.
+type AuditEventReader interface {
+	Next() (*AuditEvent, error)
+}
+
+// IsQuery returns true if the event is a query, its Object is the query text then
+func (e *AuditEvent) IsQuery() bool {
+	switch e.Operation {
+	case OperationQuery, OperationQueryDDL, OperationQueryDML, OperationQueryDMLNoSelect, OperationQueryDCL:
+		return true
+	}
+	return false
+}
+
+// IsTableOperation returns true if the event is an operation on a table, its Object is the table name then
+func (e *AuditEvent) IsTableOperation() bool {
+	switch e.Operation {
+	case OperationRead, OperationWrite, OperationCreate, OperationAlter, OperationRename, OperationDrop:
+		return true
+	}
+	return false
+}
+
+// Succeeded returns true if the database did not return an error and the event is not a failed connection attempt
+func (e *AuditEvent) Succeeded() bool {
+	return e.RetCode == 0 && e.Operation != OperationFailedConnect
+}
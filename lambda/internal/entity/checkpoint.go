@@ -4,4 +4,22 @@ package entity
 type CheckpointRecord struct {
 	LogFileTimestamp int64
 	Id               string
+	// ProcessedLogFiles are the identities of the processed log files last written at LogFileTimestamp
+	ProcessedLogFiles []string
+	// LogFileSha256 is the SHA-256 digest of the log file processed last
+	LogFileSha256 string
+	// ActiveLogFile holds the progress of tailing the active log file
+	ActiveLogFile ActiveLogFileCheckpoint
+}
+
+// ActiveLogFileCheckpoint is the position up to which the active (not yet rotated) log file has been processed
+type ActiveLogFileCheckpoint struct {
+	// Marker is the DownloadDBLogFilePortion marker after the last downloaded data
+	Marker string
+	// Offset is the number of bytes of complete lines which have been processed
+	Offset int64
+	// PartialLine is the beginning of a line which had not been written completely
+	PartialLine string
+	// Lines is the number of complete lines which have been processed
+	Lines int64
 }
@@ -0,0 +1,15 @@
+package entity
+
+// GapRecord describes a period of which audit logs may have been lost before they could be processed
+type GapRecord struct {
+	Id                    string
+	RdsInstanceIdentifier string
+	// From is the timestamp (msec since epoch) of the last log file processed before the gap
+	From int64
+	// To is the time (msec since epoch) of the first record after the gap
+	To int64
+	// LogFileName is the first log file processed after the gap
+	LogFileName string
+	// DetectedAt is the time (msec since epoch) the gap has been detected
+	DetectedAt int64
+}
@@ -1,6 +1,11 @@
 package entity
 
-import "bytes"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"time"
+)
 
 type LogEntryTimestamp struct {
 	Year  int
@@ -9,7 +14,7 @@ type LogEntryTimestamp struct {
 	Hour  int
 }
 
-func NewLogEntryTimestamp(year, month , day, hour int) LogEntryTimestamp {
+func NewLogEntryTimestamp(year, month, day, hour int) LogEntryTimestamp {
 	return LogEntryTimestamp{
 		Year:  year,
 		Month: month,
@@ -19,7 +24,27 @@ func NewLogEntryTimestamp(year, month , day, hour int) LogEntryTimestamp {
 }
 
 type LogEntry struct {
-	Timestamp        LogEntryTimestamp
-	LogLine          *bytes.Buffer
+	RdsInstanceIdentifier string
+	// LogFileName is the name of the log file the records have been read from
+	LogFileName string
+	// LogFileIdentity identifies the log file independent of its name, it is empty for the active log file
+	LogFileIdentity string
+	Timestamp       LogEntryTimestamp
+	LogLine         io.Reader
+	// Events reads the same records as LogLine parsed into audit events, only one of both can be read
+	Events           AuditEventReader
 	LogFileTimestamp int64
+	// FirstRecordTime is the time of the first record of the entry
+	FirstRecordTime time.Time
+}
+
+// LogFileID returns a short hash of the log file the entry has been read from. It tells the objects of log files which
+// have been last written at the same time apart and stays the same if a rotated log file is renamed.
+func (e LogEntry) LogFileID() string {
+	id := e.LogFileIdentity
+	if id == "" {
+		id = e.LogFileName
+	}
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:8])
 }
@@ -0,0 +1,18 @@
+package entity
+
+// ManifestRecord describes the download of a log file, it is written to S3 next to the processed logs
+type ManifestRecord struct {
+	RdsInstanceIdentifier string
+	LogFileName           string
+	LogFileTimestamp      int64
+	Identity              string
+	// Size is the size of the log file reported by DescribeDBLogFiles
+	Size int64
+	// Bytes and Lines are the number of bytes and lines downloaded
+	Bytes int64
+	Lines int64
+	// Sha256 is the hex encoded SHA-256 digest of the downloaded data
+	Sha256 string
+	// Error is the reason why the download could not be verified, it is only set for quarantined log files
+	Error string
+}
@@ -0,0 +1,7 @@
+package entity
+
+// MembershipRecord is the data used for storing the known members of a group of RDS instances in dynamodb
+type MembershipRecord struct {
+	Id      string
+	Members []string
+}
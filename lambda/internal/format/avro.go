@@ -0,0 +1,133 @@
+package format
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/linkedin/goavro/v2"
+	"rdsauditlogss3/internal/entity"
+)
+
+const (
+	// AvroSchemaVersion is the version of the schema of the Avro files, it changes with incompatible changes.
+	// It is only stored in the metadata, the full name of the schema stays the same so readers can resolve it.
+	AvroSchemaVersion = "1"
+	// AvroSchemaVersionKey is the key of the schema version in the metadata of the Avro files
+	AvroSchemaVersionKey = "rds_audit_logs_s3.schema_version"
+
+	DefaultAvroCompression = "deflate"
+
+	// avroBlockSize is the number of audit events written per block of an Avro file
+	avroBlockSize = 1000
+)
+
+// AvroSchema is the writer schema of the audit events embedded in every Avro file
+const AvroSchema = `{
+  "type": "record",
+  "name": "AuditEvent",
+  "namespace": "rdsauditlogss3",
+  "doc": "Audit event of an RDS instance",
+  "fields": [
+    {"name": "timestamp", "type": {"type": "long", "logicalType": "timestamp-micros"}},
+    {"name": "rds_instance_identifier", "type": "string"},
+    {"name": "logfile_name", "type": "string"},
+    {"name": "line", "type": "long"},
+    {"name": "server_host", "type": "string"},
+    {"name": "username", "type": "string"},
+    {"name": "host", "type": "string"},
+    {"name": "connection_id", "type": "long"},
+    {"name": "query_id", "type": "long"},
+    {"name": "operation", "type": "string"},
+    {"name": "database", "type": "string"},
+    {"name": "object", "type": "string"},
+    {"name": "retcode", "type": "int"}
+  ]
+}`
+
+// avroCompressions are the supported block compressions of Avro files
+var avroCompressions = map[string]string{
+	"null":    goavro.CompressionNullLabel,
+	"deflate": goavro.CompressionDeflateLabel,
+	"snappy":  goavro.CompressionSnappyLabel,
+}
+
+// Avro writes an Avro object container file per log entry with one record per audit event
+type Avro struct {
+	codec       *goavro.Codec
+	compression string
+}
+
+// NewAvro returns the Avro format, compression is null, deflate or snappy
+func NewAvro(compression string) (*Avro, error) {
+	label, ok := avroCompressions[compression]
+	if !ok {
+		return nil, fmt.Errorf("unknown avro compression %s", compression)
+	}
+	codec, err := goavro.NewCodec(AvroSchema)
+	if err != nil {
+		return nil, fmt.Errorf("could not create avro codec: %v", err)
+	}
+	return &Avro{
+		codec:       codec,
+		compression: label,
+	}, nil
+}
+
+func (a *Avro) Extension() string {
+	return "avro"
+}
+
+func (a *Avro) ContentType() string {
+	return "application/avro"
+}
+
+func (a *Avro) Write(w io.Writer, entry entity.LogEntry) error {
+	ocf, err := goavro.NewOCFWriter(goavro.OCFConfig{
+		W:               w,
+		Codec:           a.codec,
+		CompressionName: a.compression,
+		MetaData:        map[string][]byte{AvroSchemaVersionKey: []byte(AvroSchemaVersion)},
+	})
+	if err != nil {
+		return fmt.Errorf("could not create avro writer: %v", err)
+	}
+
+	block := make([]interface{}, 0, avroBlockSize)
+	flush := func() error {
+		if len(block) == 0 {
+			return nil
+		}
+		err := ocf.Append(block)
+		if err != nil {
+			return fmt.Errorf("could not write avro block: %v", err)
+		}
+		block = block[:0]
+		return nil
+	}
+
+	err = forEachEvent(entry, func(event *entity.AuditEvent) error {
+		block = append(block, map[string]interface{}{
+			"timestamp":               event.Timestamp.UTC(),
+			"rds_instance_identifier": entry.RdsInstanceIdentifier,
+			"logfile_name":            entry.LogFileName,
+			"line":                    event.Line,
+			"server_host":             event.ServerHost,
+			"username":                event.Username,
+			"host":                    event.Host,
+			"connection_id":           event.ConnectionID,
+			"query_id":                event.QueryID,
+			"operation":               event.Operation,
+			"database":                event.Database,
+			"object":                  event.Object,
+			"retcode":                 int32(event.RetCode),
+		})
+		if len(block) == avroBlockSize {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return flush()
+}
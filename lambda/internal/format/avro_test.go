@@ -0,0 +1,58 @@
+package format
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/linkedin/goavro/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAvroRoundTrip(t *testing.T) {
+	for _, compression := range []string{"null", "deflate", "snappy"} {
+		t.Run(compression, func(t *testing.T) {
+			f, err := NewAvro(compression)
+			assert.NoError(t, err)
+
+			var buf bytes.Buffer
+			err = f.Write(&buf, testEntry())
+			assert.NoError(t, err)
+
+			ocf, err := goavro.NewOCFReader(&buf)
+			assert.NoError(t, err)
+			assert.Equal(t, compression, ocf.CompressionName())
+			assert.Equal(t, []byte(AvroSchemaVersion), ocf.MetaData()[AvroSchemaVersionKey])
+			assert.Contains(t, string(ocf.MetaData()["avro.schema"]), `"namespace": "rdsauditlogss3"`)
+
+			var records []interface{}
+			for ocf.Scan() {
+				record, err := ocf.Read()
+				assert.NoError(t, err)
+				records = append(records, record)
+			}
+			assert.NoError(t, ocf.Err())
+			assert.Len(t, records, 2)
+			assert.Equal(t, map[string]interface{}{
+				"timestamp":               time.Date(2020, 7, 14, 10, 30, 3, 123456000, time.UTC),
+				"rds_instance_identifier": "my-instance",
+				"logfile_name":            "audit/server_audit.log.1",
+				"line":                    int64(2),
+				"server_host":             "ip-172-27-1-97",
+				"username":                "admin",
+				"host":                    "10.120.182.212",
+				"connection_id":           int64(33303),
+				"query_id":                int64(161152),
+				"operation":               "QUERY",
+				"database":                "rdslogstest",
+				"object":                  "SELECT '<a>',\n\"b\"",
+				"retcode":                 int32(1064),
+			}, records[1])
+		})
+	}
+}
+
+func TestNewAvroInvalidCompression(t *testing.T) {
+	_, err := NewAvro("lz4")
+	assert.EqualError(t, err, "unknown avro compression lz4")
+}
@@ -0,0 +1,199 @@
+package format
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"rdsauditlogss3/internal/entity"
+)
+
+const (
+	// CEFDeviceVersion is the device version in the header of the CEF messages, it changes with the signatures
+	CEFDeviceVersion = "1"
+
+	cefVendor  = "Personio"
+	cefProduct = "rds-audit-logs-s3"
+
+	// syslogFacilityLogAudit is the facility of the syslog messages
+	syslogFacilityLogAudit = 13
+	syslogAppName          = "rds-audit-logs-s3"
+	// syslogTimestampFormat is RFC 3339 with at most microseconds as required by RFC 5424
+	syslogTimestampFormat = "2006-01-02T15:04:05.999999Z07:00"
+)
+
+// cefSignature is the CEF event class of an operation
+type cefSignature struct {
+	id   string
+	name string
+	// severity of the operation if it succeeded, from 0 (lowest) to 10 (highest)
+	severity int
+}
+
+// cefSignatures are the signatures of the operations, their IDs must not change
+var cefSignatures = map[string]cefSignature{
+	entity.OperationConnect:          {"100", "Connect", 3},
+	entity.OperationFailedConnect:    {"101", "Failed connect", 7},
+	entity.OperationDisconnect:       {"102", "Disconnect", 1},
+	entity.OperationChangeUser:       {"103", "Change user", 5},
+	entity.OperationQuery:            {"200", "Query", 3},
+	entity.OperationQueryDDL:         {"201", "DDL query", 6},
+	entity.OperationQueryDML:         {"202", "DML query", 3},
+	entity.OperationQueryDMLNoSelect: {"203", "DML query without select", 4},
+	entity.OperationQueryDCL:         {"204", "DCL query", 7},
+	entity.OperationRead:             {"300", "Table read", 3},
+	entity.OperationWrite:            {"301", "Table write", 4},
+	entity.OperationCreate:           {"302", "Table create", 5},
+	entity.OperationAlter:            {"303", "Table alter", 5},
+	entity.OperationRename:           {"304", "Table rename", 5},
+	entity.OperationDrop:             {"305", "Table drop", 7},
+}
+
+// cefUnknownSignature is the signature of operations which are not known, the operation is its name
+var cefUnknownSignature = cefSignature{"999", "", 3}
+
+var (
+	cefHeaderEscaper    = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\r", " ", "\n", " ")
+	cefExtensionEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r", `\r`, "\n", `\n`)
+)
+
+// CEF writes one ArcSight Common Event Format message per audit event and line
+type CEF struct{}
+
+func (CEF) Extension() string {
+	return "cef"
+}
+
+func (CEF) ContentType() string {
+	return "text/plain"
+}
+
+func (c CEF) Write(w io.Writer, entry entity.LogEntry) error {
+	buf := bufio.NewWriter(w)
+	err := forEachEvent(entry, func(event *entity.AuditEvent) error {
+		_, err := buf.WriteString(c.Message(entry, event) + "\n")
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return buf.Flush()
+}
+
+// Message returns the CEF message of an audit event, it does not contain line breaks
+func (CEF) Message(entry entity.LogEntry, event *entity.AuditEvent) string {
+	signature := cefEventSignature(event)
+
+	extension := []string{
+		"rt=" + strconv.FormatInt(event.Timestamp.UnixNano()/int64(time.Millisecond), 10),
+		"act=" + cefExtensionEscaper.Replace(event.Operation),
+		"outcome=" + cefOutcome(event),
+		"deviceExternalId=" + cefExtensionEscaper.Replace(entry.RdsInstanceIdentifier),
+	}
+	if event.ServerHost != "" {
+		extension = append(extension, "dvchost="+cefExtensionEscaper.Replace(event.ServerHost))
+	}
+	if event.Username != "" {
+		extension = append(extension, "suser="+cefExtensionEscaper.Replace(event.Username))
+	}
+	if net.ParseIP(event.Host) != nil {
+		extension = append(extension, "src="+event.Host)
+	} else if event.Host != "" {
+		extension = append(extension, "shost="+cefExtensionEscaper.Replace(event.Host))
+	}
+	extension = append(extension,
+		"cn1Label=connectionId", "cn1="+strconv.FormatInt(event.ConnectionID, 10),
+		"cn2Label=queryId", "cn2="+strconv.FormatInt(event.QueryID, 10),
+		"cn3Label=retcode", "cn3="+strconv.Itoa(event.RetCode),
+		"cs1Label=database", "cs1="+cefExtensionEscaper.Replace(event.Database),
+	)
+	switch {
+	case event.IsQuery():
+		extension = append(extension, "cs2Label=query", "cs2="+cefExtensionEscaper.Replace(event.Object))
+	case event.IsTableOperation():
+		extension = append(extension, "cs2Label=table", "cs2="+cefExtensionEscaper.Replace(event.Object))
+	}
+	extension = append(extension, "cs3Label=logFile", "cs3="+cefExtensionEscaper.Replace(fmt.Sprintf("%s:%d", entry.LogFileName, event.Line)))
+
+	return fmt.Sprintf("CEF:0|%s|%s|%s|%s|%s|%d|%s",
+		cefVendor, cefProduct, CEFDeviceVersion, signature.id, cefHeaderEscaper.Replace(signature.name),
+		cefSeverity(event), strings.Join(extension, " "))
+}
+
+// SyslogMessage returns the CEF message of an audit event as RFC 5424 syslog message without framing,
+// the host name is the RDS instance and the message ID the operation
+func (c CEF) SyslogMessage(entry entity.LogEntry, event *entity.AuditEvent) string {
+	priority := syslogFacilityLogAudit*8 + syslogSeverity(cefSeverity(event))
+	return fmt.Sprintf("<%d>1 %s %s %s %s %s - %s",
+		priority,
+		event.Timestamp.UTC().Format(syslogTimestampFormat),
+		syslogHeaderField(entry.RdsInstanceIdentifier, 255),
+		syslogAppName,
+		syslogHeaderField(strconv.FormatInt(event.ConnectionID, 10), 128),
+		syslogHeaderField(event.Operation, 32),
+		c.Message(entry, event))
+}
+
+// cefEventSignature returns the signature of the operation of an audit event
+func cefEventSignature(event *entity.AuditEvent) cefSignature {
+	signature, ok := cefSignatures[event.Operation]
+	if !ok {
+		signature = cefUnknownSignature
+		signature.name = event.Operation
+	}
+	return signature
+}
+
+// cefSeverity returns the severity of an audit event, failed operations are two levels more severe
+func cefSeverity(event *entity.AuditEvent) int {
+	severity := cefEventSignature(event).severity
+	if event.RetCode != 0 {
+		severity += 2
+	}
+	if severity > 10 {
+		return 10
+	}
+	return severity
+}
+
+func cefOutcome(event *entity.AuditEvent) string {
+	if event.Succeeded() {
+		return "success"
+	}
+	return "failure"
+}
+
+// syslogSeverity maps the CEF severity to the syslog severity
+func syslogSeverity(cefSeverity int) int {
+	switch {
+	case cefSeverity >= 9:
+		return 2 // critical
+	case cefSeverity >= 7:
+		return 4 // warning
+	case cefSeverity >= 4:
+		return 5 // notice
+	default:
+		return 6 // informational
+	}
+}
+
+// syslogHeaderField returns a header field of at most maxLength printable ASCII characters, "-" if it is empty
+func syslogHeaderField(value string, maxLength int) string {
+	field := strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return -1
+		}
+		return r
+	}, value)
+	if len(field) > maxLength {
+		field = field[:maxLength]
+	}
+	if field == "" {
+		return "-"
+	}
+	return field
+}
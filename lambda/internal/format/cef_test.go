@@ -0,0 +1,68 @@
+package format
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"rdsauditlogss3/internal/entity"
+)
+
+func TestCEF(t *testing.T) {
+	var buf bytes.Buffer
+	err := CEF{}.Write(&buf, testEntry())
+	assert.NoError(t, err)
+
+	assert.Equal(t, `CEF:0|Personio|rds-audit-logs-s3|1|100|Connect|3|rt=1594722602000 act=CONNECT outcome=success deviceExternalId=my-instance dvchost=ip-172-27-1-97 suser=admin src=10.120.182.212 cn1Label=connectionId cn1=33303 cn2Label=queryId cn2=0 cn3Label=retcode cn3=0 cs1Label=database cs1=rdslogstest cs3Label=logFile cs3=audit/server_audit.log.1:1
+CEF:0|Personio|rds-audit-logs-s3|1|200|Query|5|rt=1594722603123 act=QUERY outcome=failure deviceExternalId=my-instance dvchost=ip-172-27-1-97 suser=admin src=10.120.182.212 cn1Label=connectionId cn1=33303 cn2Label=queryId cn2=161152 cn3Label=retcode cn3=1064 cs1Label=database cs1=rdslogstest cs2Label=query cs2=SELECT '<a>',\n"b" cs3Label=logFile cs3=audit/server_audit.log.1:2
+`, buf.String())
+}
+
+func TestCEFEscaping(t *testing.T) {
+	message := CEF{}.Message(entity.LogEntry{}, &entity.AuditEvent{
+		Timestamp: time.Unix(0, 0),
+		Operation: "CUSTOM|OP",
+		Host:      "client.local",
+		Object:    "a=b\\c\r\nd",
+	})
+	assert.Equal(t, `CEF:0|Personio|rds-audit-logs-s3|1|999|CUSTOM\|OP|3|rt=0 act=CUSTOM|OP outcome=success deviceExternalId= shost=client.local cn1Label=connectionId cn1=0 cn2Label=queryId cn2=0 cn3Label=retcode cn3=0 cs1Label=database cs1= cs3Label=logFile cs3=:0`, message)
+
+	message = CEF{}.Message(entity.LogEntry{}, &entity.AuditEvent{
+		Operation: entity.OperationQueryDDL,
+		Object:    "a=b\\c\r\nd",
+	})
+	assert.Contains(t, message, ` cs2=a\=b\\c\r\nd `)
+}
+
+func TestCEFSeverity(t *testing.T) {
+	for _, test := range []struct {
+		operation string
+		retCode   int
+		severity  int
+	}{
+		{entity.OperationDisconnect, 0, 1},
+		{entity.OperationFailedConnect, 1045, 9},
+		{entity.OperationQueryDCL, 0, 7},
+		{entity.OperationDrop, 1051, 9},
+		{entity.OperationQueryDCL, 1227, 9},
+		{"UNKNOWN", 0, 3},
+	} {
+		assert.Equal(t, test.severity, cefSeverity(&entity.AuditEvent{Operation: test.operation, RetCode: test.retCode}), test.operation)
+	}
+}
+
+func TestCEFSyslogMessage(t *testing.T) {
+	entry := entity.LogEntry{RdsInstanceIdentifier: "my-instance", LogFileName: "audit/server_audit.log.1"}
+	message := CEF{}.SyslogMessage(entry, &entity.AuditEvent{
+		Timestamp:    time.Date(2020, 7, 14, 10, 30, 3, 123456789, time.UTC),
+		ConnectionID: 33303,
+		Operation:    entity.OperationFailedConnect,
+		RetCode:      1045,
+		Line:         3,
+	})
+	assert.Equal(t, `<106>1 2020-07-14T10:30:03.123456Z my-instance rds-audit-logs-s3 33303 FAILED_CONNECT - CEF:0|Personio|rds-audit-logs-s3|1|101|Failed connect|9|rt=1594722603123 act=FAILED_CONNECT outcome=failure deviceExternalId=my-instance cn1Label=connectionId cn1=33303 cn2Label=queryId cn2=0 cn3Label=retcode cn3=1045 cs1Label=database cs1= cs3Label=logFile cs3=audit/server_audit.log.1:3`, message)
+
+	message = CEF{}.SyslogMessage(entity.LogEntry{}, &entity.AuditEvent{Timestamp: time.Date(2020, 7, 14, 10, 30, 3, 0, time.UTC)})
+	assert.Regexp(t, `^<110>1 2020-07-14T10:30:03Z - rds-audit-logs-s3 0 - - CEF:`, message)
+}
@@ -0,0 +1,199 @@
+package format
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"rdsauditlogss3/internal/entity"
+)
+
+// ECSVersion is the version of the Elastic Common Schema the events are mapped to
+const ECSVersion = "8.11.0"
+
+// ecsEvent is the ECS document written for an audit event
+type ecsEvent struct {
+	Timestamp string            `json:"@timestamp"`
+	ECS       ecsVersion        `json:"ecs"`
+	Event     ecsEventFields    `json:"event"`
+	User      *ecsUser          `json:"user,omitempty"`
+	Source    *ecsSource        `json:"source,omitempty"`
+	Host      *ecsHost          `json:"host,omitempty"`
+	DB        ecsDB             `json:"db"`
+	Error     *ecsError         `json:"error,omitempty"`
+	Cloud     ecsCloud          `json:"cloud"`
+	Log       ecsLog            `json:"log"`
+	Labels    map[string]string `json:"labels"`
+}
+
+type ecsVersion struct {
+	Version string `json:"version"`
+}
+
+type ecsEventFields struct {
+	Kind     string   `json:"kind"`
+	Category []string `json:"category"`
+	Type     []string `json:"type"`
+	Action   string   `json:"action"`
+	Outcome  string   `json:"outcome"`
+	Dataset  string   `json:"dataset"`
+	Original string   `json:"original,omitempty"`
+}
+
+type ecsUser struct {
+	Name string `json:"name"`
+}
+
+type ecsSource struct {
+	IP     string `json:"ip,omitempty"`
+	Domain string `json:"domain,omitempty"`
+}
+
+type ecsHost struct {
+	Hostname string `json:"hostname"`
+}
+
+type ecsDB struct {
+	Name      string  `json:"name,omitempty"`
+	Statement string  `json:"statement,omitempty"`
+	SQL       *ecsSQL `json:"sql,omitempty"`
+}
+
+type ecsSQL struct {
+	Table string `json:"table"`
+}
+
+type ecsError struct {
+	Code string `json:"code"`
+}
+
+type ecsCloud struct {
+	Provider string          `json:"provider"`
+	Region   string          `json:"region,omitempty"`
+	Service  ecsCloudService `json:"service"`
+	Instance ecsCloudID      `json:"instance"`
+}
+
+type ecsCloudService struct {
+	Name string `json:"name"`
+}
+
+type ecsCloudID struct {
+	ID string `json:"id"`
+}
+
+type ecsLog struct {
+	File ecsLogFile `json:"file"`
+}
+
+type ecsLogFile struct {
+	Path string `json:"path"`
+}
+
+// ecsEventTypes are the values of event.type of the operations, all other operations are of type info
+var ecsEventTypes = map[string][]string{
+	entity.OperationConnect:       {"connection", "start"},
+	entity.OperationFailedConnect: {"connection", "start"},
+	entity.OperationDisconnect:    {"connection", "end"},
+	entity.OperationChangeUser:    {"change"},
+	entity.OperationRead:          {"access"},
+	entity.OperationWrite:         {"change"},
+	entity.OperationCreate:        {"creation"},
+	entity.OperationAlter:         {"change"},
+	entity.OperationRename:        {"change"},
+	entity.OperationDrop:          {"deletion"},
+}
+
+// ECS writes one Elastic Common Schema document per audit event and line
+type ECS struct {
+	region string
+}
+
+// NewECS returns the ECS format for RDS instances in the given region
+func NewECS(region string) ECS {
+	return ECS{region: region}
+}
+
+func (e ECS) Extension() string {
+	return "jsonl"
+}
+
+func (e ECS) ContentType() string {
+	return "application/x-ndjson"
+}
+
+func (e ECS) Write(w io.Writer, entry entity.LogEntry) error {
+	buf := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+
+	err := forEachEvent(entry, func(event *entity.AuditEvent) error {
+		return encoder.Encode(e.newEvent(entry, event))
+	})
+	if err != nil {
+		return err
+	}
+	return buf.Flush()
+}
+
+// newEvent maps an audit event to ECS, fields without an ECS equivalent are kept as labels
+func (e ECS) newEvent(entry entity.LogEntry, event *entity.AuditEvent) *ecsEvent {
+	result := &ecsEvent{
+		Timestamp: formatTimestamp(event.Timestamp),
+		ECS:       ecsVersion{Version: ECSVersion},
+		Event: ecsEventFields{
+			Kind:     "event",
+			Category: []string{"database"},
+			Type:     []string{"info"},
+			Action:   strings.ToLower(event.Operation),
+			Outcome:  "success",
+			Dataset:  "rds.audit",
+			Original: event.Raw,
+		},
+		DB: ecsDB{Name: event.Database},
+		Cloud: ecsCloud{
+			Provider: "aws",
+			Region:   e.region,
+			Service:  ecsCloudService{Name: "rds"},
+			Instance: ecsCloudID{ID: entry.RdsInstanceIdentifier},
+		},
+		Log: ecsLog{File: ecsLogFile{Path: entry.LogFileName}},
+		Labels: map[string]string{
+			"rds_instance_identifier": entry.RdsInstanceIdentifier,
+			"line":                    strconv.FormatInt(event.Line, 10),
+			"connection_id":           strconv.FormatInt(event.ConnectionID, 10),
+			"query_id":                strconv.FormatInt(event.QueryID, 10),
+		},
+	}
+	if eventType, ok := ecsEventTypes[event.Operation]; ok {
+		result.Event.Type = eventType
+	}
+	if event.Operation == entity.OperationConnect || event.Operation == entity.OperationFailedConnect {
+		result.Event.Category = append(result.Event.Category, "authentication")
+	}
+	if !event.Succeeded() {
+		result.Event.Outcome = "failure"
+		result.Error = &ecsError{Code: strconv.Itoa(event.RetCode)}
+	}
+	if event.Username != "" {
+		result.User = &ecsUser{Name: event.Username}
+	}
+	if net.ParseIP(event.Host) != nil {
+		result.Source = &ecsSource{IP: event.Host}
+	} else if event.Host != "" {
+		result.Source = &ecsSource{Domain: event.Host}
+	}
+	if event.ServerHost != "" {
+		result.Host = &ecsHost{Hostname: event.ServerHost}
+	}
+	switch {
+	case event.IsQuery():
+		result.DB.Statement = event.Object
+	case event.IsTableOperation():
+		result.DB.SQL = &ecsSQL{Table: event.Object}
+	}
+	return result
+}
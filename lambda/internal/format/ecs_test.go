@@ -0,0 +1,35 @@
+package format
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"rdsauditlogss3/internal/entity"
+)
+
+func TestECS(t *testing.T) {
+	var buf bytes.Buffer
+	err := NewECS("eu-central-1").Write(&buf, testEntry())
+	assert.NoError(t, err)
+
+	assert.Equal(t, `{"@timestamp":"2020-07-14T10:30:02Z","ecs":{"version":"8.11.0"},"event":{"kind":"event","category":["database","authentication"],"type":["connection","start"],"action":"connect","outcome":"success","dataset":"rds.audit"},"user":{"name":"admin"},"source":{"ip":"10.120.182.212"},"host":{"hostname":"ip-172-27-1-97"},"db":{"name":"rdslogstest"},"cloud":{"provider":"aws","region":"eu-central-1","service":{"name":"rds"},"instance":{"id":"my-instance"}},"log":{"file":{"path":"audit/server_audit.log.1"}},"labels":{"connection_id":"33303","line":"1","query_id":"0","rds_instance_identifier":"my-instance"}}
+{"@timestamp":"2020-07-14T10:30:03.123456Z","ecs":{"version":"8.11.0"},"event":{"kind":"event","category":["database"],"type":["info"],"action":"query","outcome":"failure","dataset":"rds.audit"},"user":{"name":"admin"},"source":{"ip":"10.120.182.212"},"host":{"hostname":"ip-172-27-1-97"},"db":{"name":"rdslogstest","statement":"SELECT '<a>',\n\"b\""},"error":{"code":"1064"},"cloud":{"provider":"aws","region":"eu-central-1","service":{"name":"rds"},"instance":{"id":"my-instance"}},"log":{"file":{"path":"audit/server_audit.log.1"}},"labels":{"connection_id":"33303","line":"2","query_id":"161152","rds_instance_identifier":"my-instance"}}
+`, buf.String())
+}
+
+func TestECSTableOperation(t *testing.T) {
+	event := NewECS("eu-central-1").newEvent(testEntry(), &entity.AuditEvent{
+		Operation: entity.OperationDrop,
+		Host:      "client.local",
+		Object:    "employees",
+		Raw:       "20200714 10:30:02,ip-172-27-1-97,admin,client.local,33303,161153,DROP,rdslogstest,employees,0",
+	})
+	assert.Equal(t, "drop", event.Event.Action)
+	assert.Equal(t, []string{"deletion"}, event.Event.Type)
+	assert.Equal(t, &ecsSource{Domain: "client.local"}, event.Source)
+	assert.Equal(t, &ecsSQL{Table: "employees"}, event.DB.SQL)
+	assert.Empty(t, event.DB.Statement)
+	assert.Nil(t, event.User)
+	assert.Equal(t, "20200714 10:30:02,ip-172-27-1-97,admin,client.local,33303,161153,DROP,rdslogstest,employees,0", event.Event.Original)
+}
@@ -0,0 +1,129 @@
+package format
+
+import (
+	"fmt"
+	"io"
+
+	"rdsauditlogss3/internal/entity"
+)
+
+// Format serialises the log entries written by a writer
+type Format interface {
+	// Extension is the file extension of the objects written in this format
+	Extension() string
+	ContentType() string
+	// Write serialises the records of a log entry to w
+	Write(w io.Writer, entry entity.LogEntry) error
+}
+
+// Layout is implemented by formats which are written to a fixed location, eg. the partitions of a data lake,
+// instead of the hourly partitions below the prefix of the instance
+type Layout interface {
+	// ObjectKey returns the key of the object a log entry is written to
+	ObjectKey(entry entity.LogEntry) string
+}
+
+// Options are the settings of the formats
+type Options struct {
+	// ParquetCompression is the compression of the columns of Parquet files: snappy or zstd
+	ParquetCompression  string
+	ParquetRowGroupSize int64
+	// AvroCompression is the compression of the blocks of Avro files: null, deflate or snappy
+	AvroCompression string
+	// SecurityLakeSource is the name of the custom source in Amazon Security Lake the OCSF events are written to
+	SecurityLakeSource string
+	// Region and AccountID of the RDS instances, they are part of the ECS and OCSF events
+	Region    string
+	AccountID string
+}
+
+// DefaultOptions returns the default settings of all formats
+func DefaultOptions() Options {
+	return Options{
+		ParquetCompression:  DefaultParquetCompression,
+		ParquetRowGroupSize: DefaultParquetRowGroupSize,
+		AvroCompression:     DefaultAvroCompression,
+	}
+}
+
+// New returns the format with the given name
+func New(name string, options Options) (Format, error) {
+	switch name {
+	case "raw":
+		return Raw{}, nil
+	case "json":
+		return JSONLines{}, nil
+	case "parquet":
+		return NewParquet(options.ParquetCompression, options.ParquetRowGroupSize)
+	case "avro":
+		return NewAvro(options.AvroCompression)
+	case "ecs":
+		return NewECS(options.Region), nil
+	case "cef":
+		return CEF{}, nil
+	case "ocsf":
+		return NewOCSF(options.SecurityLakeSource, options.Region, options.AccountID)
+	}
+	return nil, fmt.Errorf("unknown output format %s", name)
+}
+
+// Raw passes the records through as they were written to the audit log
+type Raw struct{}
+
+func (Raw) Extension() string {
+	return "log"
+}
+
+func (Raw) ContentType() string {
+	return "text/plain"
+}
+
+func (Raw) Write(w io.Writer, entry entity.LogEntry) error {
+	_, err := io.Copy(w, entry.LogLine)
+	return err
+}
+
+// forEachEvent calls fn for every audit event of a log entry
+func forEachEvent(entry entity.LogEntry, fn func(event *entity.AuditEvent) error) error {
+	if entry.Events == nil {
+		return fmt.Errorf("log entry has no audit events")
+	}
+	for {
+		event, err := entry.Events.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("could not read audit event: %w", err)
+		}
+		err = fn(event)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// encodedReader reads a log entry while it is serialised by a format in the background
+type encodedReader struct {
+	*io.PipeReader
+	done chan struct{}
+}
+
+// NewReader returns a reader of the log entry serialised in format f, eg. to be uploaded while the log file is read.
+// The entry must not be read anymore once the reader has been closed.
+func NewReader(f Format, entry entity.LogEntry) io.ReadCloser {
+	pr, pw := io.Pipe()
+	r := &encodedReader{PipeReader: pr, done: make(chan struct{})}
+	go func() {
+		defer close(r.done)
+		pw.CloseWithError(f.Write(pw, entry))
+	}()
+	return r
+}
+
+// Close stops serialising the log entry and waits until it has been stopped
+func (r *encodedReader) Close() error {
+	err := r.PipeReader.Close()
+	<-r.done
+	return err
+}
@@ -0,0 +1,108 @@
+package format
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"rdsauditlogss3/internal/entity"
+)
+
+// failingFormat fails after writing some data
+type failingFormat struct {
+	Raw
+}
+
+func (failingFormat) Write(w io.Writer, _ entity.LogEntry) error {
+	_, _ = w.Write([]byte("some data"))
+	return fmt.Errorf("some error")
+}
+
+// eventSlice returns the audit events of a slice
+type eventSlice []entity.AuditEvent
+
+func (s *eventSlice) Next() (*entity.AuditEvent, error) {
+	if len(*s) == 0 {
+		return nil, io.EOF
+	}
+	event := (*s)[0]
+	*s = (*s)[1:]
+	return &event, nil
+}
+
+// testEntry returns a log entry with a connect and a query event
+func testEntry() entity.LogEntry {
+	return entity.LogEntry{
+		RdsInstanceIdentifier: "my-instance",
+		LogFileName:           "audit/server_audit.log.1",
+		Timestamp:             entity.NewLogEntryTimestamp(2020, 7, 14, 10),
+		Events: &eventSlice{
+			{
+				Timestamp:    time.Date(2020, 7, 14, 10, 30, 2, 0, time.UTC),
+				ServerHost:   "ip-172-27-1-97",
+				Username:     "admin",
+				Host:         "10.120.182.212",
+				ConnectionID: 33303,
+				Operation:    entity.OperationConnect,
+				Database:     "rdslogstest",
+				Line:         1,
+			},
+			{
+				Timestamp:    time.Date(2020, 7, 14, 10, 30, 3, 123456000, time.UTC),
+				ServerHost:   "ip-172-27-1-97",
+				Username:     "admin",
+				Host:         "10.120.182.212",
+				ConnectionID: 33303,
+				QueryID:      161152,
+				Operation:    entity.OperationQuery,
+				Database:     "rdslogstest",
+				Object:       "SELECT '<a>',\n\"b\"",
+				RetCode:      1064,
+				Line:         2,
+			},
+		},
+	}
+}
+
+func TestNew(t *testing.T) {
+	f, err := New("json", DefaultOptions())
+	assert.NoError(t, err)
+	assert.Equal(t, JSONLines{}, f)
+
+	_, err = New("parquet", Options{ParquetCompression: "lzo", ParquetRowGroupSize: 1})
+	assert.EqualError(t, err, "unknown parquet compression lzo")
+
+	_, err = New("xml", DefaultOptions())
+	assert.EqualError(t, err, "unknown output format xml")
+}
+
+func TestNewReaderRaw(t *testing.T) {
+	logLine := "20200714 10:30:02,ip-172-27-1-97,admin,10.120.182.212,33303,0,CONNECT,rdslogstest,,0\n"
+	r := NewReader(Raw{}, entity.LogEntry{LogLine: strings.NewReader(logLine)})
+
+	data, err := ioutil.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, logLine, string(data))
+	assert.NoError(t, r.Close())
+}
+
+func TestNewReaderError(t *testing.T) {
+	r := NewReader(failingFormat{}, entity.LogEntry{})
+
+	data, err := ioutil.ReadAll(r)
+	assert.EqualError(t, err, "some error")
+	assert.Equal(t, "some data", string(data))
+	assert.NoError(t, r.Close())
+}
+
+func TestNewReaderCloseUnread(t *testing.T) {
+	r := NewReader(Raw{}, entity.LogEntry{LogLine: strings.NewReader("some data")})
+	assert.NoError(t, r.Close())
+
+	_, err := r.Read(make([]byte, 1))
+	assert.Equal(t, io.ErrClosedPipe, err)
+}
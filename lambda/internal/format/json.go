@@ -0,0 +1,71 @@
+package format
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"time"
+
+	"rdsauditlogss3/internal/entity"
+)
+
+// jsonEvent is the JSON object written for an audit event, its field names must not change
+type jsonEvent struct {
+	Timestamp             string `json:"timestamp"`
+	RdsInstanceIdentifier string `json:"rds_instance_identifier"`
+	LogFileName           string `json:"logfile_name"`
+	Line                  int64  `json:"line"`
+	ServerHost            string `json:"server_host"`
+	Username              string `json:"username"`
+	Host                  string `json:"host"`
+	ConnectionID          int64  `json:"connection_id"`
+	QueryID               int64  `json:"query_id"`
+	Operation             string `json:"operation"`
+	Database              string `json:"database"`
+	Object                string `json:"object"`
+	RetCode               int    `json:"retcode"`
+}
+
+// JSONLines writes one JSON object per audit event and line
+type JSONLines struct{}
+
+func (JSONLines) Extension() string {
+	return "jsonl"
+}
+
+func (JSONLines) ContentType() string {
+	return "application/x-ndjson"
+}
+
+func (JSONLines) Write(w io.Writer, entry entity.LogEntry) error {
+	buf := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+
+	err := forEachEvent(entry, func(event *entity.AuditEvent) error {
+		return encoder.Encode(&jsonEvent{
+			Timestamp:             formatTimestamp(event.Timestamp),
+			RdsInstanceIdentifier: entry.RdsInstanceIdentifier,
+			LogFileName:           entry.LogFileName,
+			Line:                  event.Line,
+			ServerHost:            event.ServerHost,
+			Username:              event.Username,
+			Host:                  event.Host,
+			ConnectionID:          event.ConnectionID,
+			QueryID:               event.QueryID,
+			Operation:             event.Operation,
+			Database:              event.Database,
+			Object:                event.Object,
+			RetCode:               event.RetCode,
+		})
+	})
+	if err != nil {
+		return err
+	}
+	return buf.Flush()
+}
+
+// formatTimestamp formats the time of an event according to RFC 3339 in UTC
+func formatTimestamp(ts time.Time) string {
+	return ts.UTC().Format(time.RFC3339Nano)
+}
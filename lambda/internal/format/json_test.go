@@ -0,0 +1,24 @@
+package format
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"rdsauditlogss3/internal/entity"
+)
+
+func TestJSONLines(t *testing.T) {
+	var buf bytes.Buffer
+	err := JSONLines{}.Write(&buf, testEntry())
+	assert.NoError(t, err)
+
+	assert.Equal(t, `{"timestamp":"2020-07-14T10:30:02Z","rds_instance_identifier":"my-instance","logfile_name":"audit/server_audit.log.1","line":1,"server_host":"ip-172-27-1-97","username":"admin","host":"10.120.182.212","connection_id":33303,"query_id":0,"operation":"CONNECT","database":"rdslogstest","object":"","retcode":0}
+{"timestamp":"2020-07-14T10:30:03.123456Z","rds_instance_identifier":"my-instance","logfile_name":"audit/server_audit.log.1","line":2,"server_host":"ip-172-27-1-97","username":"admin","host":"10.120.182.212","connection_id":33303,"query_id":161152,"operation":"QUERY","database":"rdslogstest","object":"SELECT '<a>',\n\"b\"","retcode":1064}
+`, buf.String())
+}
+
+func TestJSONLinesWithoutEvents(t *testing.T) {
+	err := JSONLines{}.Write(&bytes.Buffer{}, entity.LogEntry{})
+	assert.EqualError(t, err, "log entry has no audit events")
+}
@@ -0,0 +1,306 @@
+package format
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/xitongsys/parquet-go/writer"
+	"rdsauditlogss3/internal/entity"
+)
+
+const (
+	// OCSFVersion is the version of the OCSF schema the events are mapped to
+	OCSFVersion = "1.1.0"
+
+	ocsfCategoryUID  = 6
+	ocsfCategoryName = "Application Activity"
+	ocsfClassUID     = 6005
+	ocsfClassName    = "Datastore Activity"
+	ocsfProductName  = "rds-audit-logs-s3"
+	ocsfVendorName   = "Personio"
+)
+
+// OCSF activities of the Datastore Activity class
+const (
+	ocsfActivityRead    = 1
+	ocsfActivityUpdate  = 2
+	ocsfActivityConnect = 3
+	ocsfActivityQuery   = 4
+	ocsfActivityWrite   = 5
+	ocsfActivityCreate  = 6
+	ocsfActivityDelete  = 7
+	ocsfActivityOther   = 99
+)
+
+var ocsfActivityNames = map[int32]string{
+	ocsfActivityRead:    "Read",
+	ocsfActivityUpdate:  "Update",
+	ocsfActivityConnect: "Connect",
+	ocsfActivityQuery:   "Query",
+	ocsfActivityWrite:   "Write",
+	ocsfActivityCreate:  "Create",
+	ocsfActivityDelete:  "Delete",
+	ocsfActivityOther:   "Other",
+}
+
+// ocsfEvent is the OCSF Datastore Activity written for an audit event
+type ocsfEvent struct {
+	ActivityID   int32          `parquet:"name=activity_id, type=INT32"`
+	ActivityName string         `parquet:"name=activity_name, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	CategoryUID  int32          `parquet:"name=category_uid, type=INT32"`
+	CategoryName string         `parquet:"name=category_name, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	ClassUID     int32          `parquet:"name=class_uid, type=INT32"`
+	ClassName    string         `parquet:"name=class_name, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	TypeUID      int64          `parquet:"name=type_uid, type=INT64"`
+	TypeName     string         `parquet:"name=type_name, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Time         int64          `parquet:"name=time, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	SeverityID   int32          `parquet:"name=severity_id, type=INT32"`
+	Severity     string         `parquet:"name=severity, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	StatusID     int32          `parquet:"name=status_id, type=INT32"`
+	Status       string         `parquet:"name=status, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	StatusCode   string         `parquet:"name=status_code, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Metadata     ocsfMetadata   `parquet:"name=metadata"`
+	Cloud        ocsfCloud      `parquet:"name=cloud"`
+	Actor        ocsfActor      `parquet:"name=actor"`
+	SrcEndpoint  ocsfEndpoint   `parquet:"name=src_endpoint"`
+	DstEndpoint  ocsfEndpoint   `parquet:"name=dst_endpoint"`
+	Database     ocsfDatabase   `parquet:"name=database"`
+	Table        *ocsfTable     `parquet:"name=table, repetitiontype=OPTIONAL"`
+	QueryInfo    *ocsfQueryInfo `parquet:"name=query_info, repetitiontype=OPTIONAL"`
+	RawData      string         `parquet:"name=raw_data, type=BYTE_ARRAY, convertedtype=UTF8"`
+}
+
+type ocsfMetadata struct {
+	Version string      `parquet:"name=version, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Product ocsfProduct `parquet:"name=product"`
+	LogName string      `parquet:"name=log_name, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	UID     string      `parquet:"name=uid, type=BYTE_ARRAY, convertedtype=UTF8"`
+}
+
+type ocsfProduct struct {
+	Name       string `parquet:"name=name, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	VendorName string `parquet:"name=vendor_name, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+}
+
+type ocsfCloud struct {
+	Provider string      `parquet:"name=provider, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Region   string      `parquet:"name=region, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Account  ocsfAccount `parquet:"name=account"`
+}
+
+type ocsfAccount struct {
+	UID string `parquet:"name=uid, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+}
+
+type ocsfActor struct {
+	User    ocsfUser    `parquet:"name=user"`
+	Session ocsfSession `parquet:"name=session"`
+}
+
+type ocsfUser struct {
+	Name string `parquet:"name=name, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+}
+
+type ocsfSession struct {
+	UID string `parquet:"name=uid, type=BYTE_ARRAY, convertedtype=UTF8"`
+}
+
+type ocsfEndpoint struct {
+	IP          *string `parquet:"name=ip, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY, repetitiontype=OPTIONAL"`
+	Hostname    *string `parquet:"name=hostname, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY, repetitiontype=OPTIONAL"`
+	InstanceUID *string `parquet:"name=instance_uid, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY, repetitiontype=OPTIONAL"`
+}
+
+type ocsfDatabase struct {
+	Name   string `parquet:"name=name, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Type   string `parquet:"name=type, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	TypeID int32  `parquet:"name=type_id, type=INT32"`
+}
+
+type ocsfTable struct {
+	Name string `parquet:"name=name, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+}
+
+type ocsfQueryInfo struct {
+	QueryString string `parquet:"name=query_string, type=BYTE_ARRAY, convertedtype=UTF8"`
+	UID         string `parquet:"name=uid, type=BYTE_ARRAY, convertedtype=UTF8"`
+}
+
+// OCSF writes the audit events as OCSF Datastore Activity to Parquet files in the layout of a custom source
+// of Amazon Security Lake
+type OCSF struct {
+	sourceName string
+	region     string
+	accountID  string
+	parquet    *Parquet
+}
+
+// NewOCSF returns the OCSF format for a custom source of Security Lake receiving events of RDS instances
+// in the given region and account
+func NewOCSF(sourceName, region, accountID string) (*OCSF, error) {
+	if sourceName == "" {
+		return nil, fmt.Errorf("security lake source name must be set")
+	}
+	if accountID == "" {
+		return nil, fmt.Errorf("account ID must be set")
+	}
+	parquet, err := NewParquet("zstd", DefaultParquetRowGroupSize)
+	if err != nil {
+		return nil, err
+	}
+	return &OCSF{
+		sourceName: sourceName,
+		region:     region,
+		accountID:  accountID,
+		parquet:    parquet,
+	}, nil
+}
+
+func (o *OCSF) Extension() string {
+	return o.parquet.Extension()
+}
+
+func (o *OCSF) ContentType() string {
+	return o.parquet.ContentType()
+}
+
+// ObjectKey returns the key in the partition layout of Security Lake custom sources, the name contains the
+// instance, hour and log file, so entries of several instances, hours and log files of the same day don't overwrite
+// each other
+func (o *OCSF) ObjectKey(entry entity.LogEntry) string {
+	ts := entry.Timestamp
+	return fmt.Sprintf("ext/%s/region=%s/accountId=%s/eventDay=%04d%02d%02d/%s-%02d-%d-%s.%s",
+		o.sourceName, o.region, o.accountID, ts.Year, ts.Month, ts.Day,
+		entry.RdsInstanceIdentifier, ts.Hour, entry.LogFileTimestamp, entry.LogFileID(), o.Extension())
+}
+
+func (o *OCSF) Write(w io.Writer, entry entity.LogEntry) error {
+	pw, err := writer.NewParquetWriterFromWriter(w, new(ocsfEvent), 1)
+	if err != nil {
+		return fmt.Errorf("could not create parquet writer: %v", err)
+	}
+	pw.CompressionType = o.parquet.compression
+	pw.RowGroupSize = o.parquet.rowGroupSize
+
+	err = forEachEvent(entry, func(event *entity.AuditEvent) error {
+		err := pw.Write(o.newEvent(entry, event))
+		if err != nil {
+			return fmt.Errorf("could not write parquet row: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = pw.WriteStop()
+	if err != nil {
+		return fmt.Errorf("could not write parquet footer: %v", err)
+	}
+	return nil
+}
+
+// newEvent maps an audit event to the OCSF Datastore Activity class
+func (o *OCSF) newEvent(entry entity.LogEntry, event *entity.AuditEvent) *ocsfEvent {
+	activityID := ocsfActivity(event)
+	activityName := ocsfActivityNames[activityID]
+
+	result := &ocsfEvent{
+		ActivityID:   activityID,
+		ActivityName: activityName,
+		CategoryUID:  ocsfCategoryUID,
+		CategoryName: ocsfCategoryName,
+		ClassUID:     ocsfClassUID,
+		ClassName:    ocsfClassName,
+		TypeUID:      ocsfClassUID*100 + int64(activityID),
+		TypeName:     ocsfClassName + ": " + activityName,
+		Time:         event.Timestamp.UnixNano() / int64(time.Millisecond),
+		SeverityID:   1,
+		Severity:     "Informational",
+		StatusID:     1,
+		Status:       "Success",
+		StatusCode:   strconv.Itoa(event.RetCode),
+		Metadata: ocsfMetadata{
+			Version: OCSFVersion,
+			Product: ocsfProduct{Name: ocsfProductName, VendorName: ocsfVendorName},
+			LogName: entry.LogFileName,
+			UID:     fmt.Sprintf("%s:%s:%d", entry.RdsInstanceIdentifier, entry.LogFileName, event.Line),
+		},
+		Cloud: ocsfCloud{
+			Provider: "AWS",
+			Region:   o.region,
+			Account:  ocsfAccount{UID: o.accountID},
+		},
+		Actor: ocsfActor{
+			User:    ocsfUser{Name: event.Username},
+			Session: ocsfSession{UID: strconv.FormatInt(event.ConnectionID, 10)},
+		},
+		SrcEndpoint: newOCSFEndpoint(event.Host),
+		DstEndpoint: newOCSFEndpoint(event.ServerHost),
+		Database: ocsfDatabase{
+			Name:   event.Database,
+			Type:   "Relational",
+			TypeID: 1,
+		},
+		RawData: event.Raw,
+	}
+	result.DstEndpoint.InstanceUID = optionalString(entry.RdsInstanceIdentifier)
+
+	if !event.Succeeded() {
+		result.SeverityID = 2
+		result.Severity = "Low"
+		result.StatusID = 2
+		result.Status = "Failure"
+	}
+	switch {
+	case event.IsQuery():
+		result.QueryInfo = &ocsfQueryInfo{
+			QueryString: event.Object,
+			UID:         strconv.FormatInt(event.QueryID, 10),
+		}
+	case event.IsTableOperation():
+		result.Table = &ocsfTable{Name: event.Object}
+	}
+	return result
+}
+
+// ocsfActivity returns the Datastore Activity of an audit event
+func ocsfActivity(event *entity.AuditEvent) int32 {
+	switch event.Operation {
+	case entity.OperationConnect, entity.OperationFailedConnect:
+		return ocsfActivityConnect
+	case entity.OperationRead:
+		return ocsfActivityRead
+	case entity.OperationWrite:
+		return ocsfActivityWrite
+	case entity.OperationCreate:
+		return ocsfActivityCreate
+	case entity.OperationAlter, entity.OperationRename:
+		return ocsfActivityUpdate
+	case entity.OperationDrop:
+		return ocsfActivityDelete
+	}
+	if event.IsQuery() {
+		return ocsfActivityQuery
+	}
+	return ocsfActivityOther
+}
+
+// newOCSFEndpoint returns an endpoint with the IP address or host name of host
+func newOCSFEndpoint(host string) ocsfEndpoint {
+	if net.ParseIP(host) != nil {
+		return ocsfEndpoint{IP: &host}
+	}
+	return ocsfEndpoint{Hostname: optionalString(host)}
+}
+
+// optionalString returns nil for an empty string
+func optionalString(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
@@ -0,0 +1,138 @@
+package format
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xitongsys/parquet-go-source/buffer"
+	"github.com/xitongsys/parquet-go/reader"
+	"rdsauditlogss3/internal/entity"
+)
+
+func TestOCSFRoundTrip(t *testing.T) {
+	f, err := NewOCSF("rds-audit-logs", "eu-central-1", "123456789012")
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	err = f.Write(&buf, testEntry())
+	assert.NoError(t, err)
+
+	file, err := buffer.NewBufferFile(buf.Bytes())
+	assert.NoError(t, err)
+	pr, err := reader.NewParquetReader(file, new(ocsfEvent), 1)
+	assert.NoError(t, err)
+	defer pr.ReadStop()
+
+	rows := make([]ocsfEvent, 2)
+	err = pr.Read(&rows)
+	assert.NoError(t, err)
+
+	clientIP := "10.120.182.212"
+	serverHost := "ip-172-27-1-97"
+	instance := "my-instance"
+	cloud := ocsfCloud{Provider: "AWS", Region: "eu-central-1", Account: ocsfAccount{UID: "123456789012"}}
+	product := ocsfProduct{Name: "rds-audit-logs-s3", VendorName: "Personio"}
+	actor := ocsfActor{User: ocsfUser{Name: "admin"}, Session: ocsfSession{UID: "33303"}}
+	database := ocsfDatabase{Name: "rdslogstest", Type: "Relational", TypeID: 1}
+	assert.Equal(t, []ocsfEvent{
+		{
+			ActivityID:   3,
+			ActivityName: "Connect",
+			CategoryUID:  6,
+			CategoryName: "Application Activity",
+			ClassUID:     6005,
+			ClassName:    "Datastore Activity",
+			TypeUID:      600503,
+			TypeName:     "Datastore Activity: Connect",
+			Time:         time.Date(2020, 7, 14, 10, 30, 2, 0, time.UTC).UnixNano() / int64(time.Millisecond),
+			SeverityID:   1,
+			Severity:     "Informational",
+			StatusID:     1,
+			Status:       "Success",
+			StatusCode:   "0",
+			Metadata: ocsfMetadata{
+				Version: "1.1.0",
+				Product: product,
+				LogName: "audit/server_audit.log.1",
+				UID:     "my-instance:audit/server_audit.log.1:1",
+			},
+			Cloud:       cloud,
+			Actor:       actor,
+			SrcEndpoint: ocsfEndpoint{IP: &clientIP},
+			DstEndpoint: ocsfEndpoint{Hostname: &serverHost, InstanceUID: &instance},
+			Database:    database,
+		},
+		{
+			ActivityID:   4,
+			ActivityName: "Query",
+			CategoryUID:  6,
+			CategoryName: "Application Activity",
+			ClassUID:     6005,
+			ClassName:    "Datastore Activity",
+			TypeUID:      600504,
+			TypeName:     "Datastore Activity: Query",
+			Time:         time.Date(2020, 7, 14, 10, 30, 3, 123000000, time.UTC).UnixNano() / int64(time.Millisecond),
+			SeverityID:   2,
+			Severity:     "Low",
+			StatusID:     2,
+			Status:       "Failure",
+			StatusCode:   "1064",
+			Metadata: ocsfMetadata{
+				Version: "1.1.0",
+				Product: product,
+				LogName: "audit/server_audit.log.1",
+				UID:     "my-instance:audit/server_audit.log.1:2",
+			},
+			Cloud:       cloud,
+			Actor:       actor,
+			SrcEndpoint: ocsfEndpoint{IP: &clientIP},
+			DstEndpoint: ocsfEndpoint{Hostname: &serverHost, InstanceUID: &instance},
+			Database:    database,
+			QueryInfo:   &ocsfQueryInfo{QueryString: "SELECT '<a>',\n\"b\"", UID: "161152"},
+		},
+	}, rows)
+}
+
+func TestOCSFActivity(t *testing.T) {
+	for operation, expected := range map[string]int32{
+		entity.OperationConnect:          ocsfActivityConnect,
+		entity.OperationFailedConnect:    ocsfActivityConnect,
+		entity.OperationDisconnect:       ocsfActivityOther,
+		entity.OperationQueryDDL:         ocsfActivityQuery,
+		entity.OperationQueryDMLNoSelect: ocsfActivityQuery,
+		entity.OperationRead:             ocsfActivityRead,
+		entity.OperationWrite:            ocsfActivityWrite,
+		entity.OperationCreate:           ocsfActivityCreate,
+		entity.OperationAlter:            ocsfActivityUpdate,
+		entity.OperationRename:           ocsfActivityUpdate,
+		entity.OperationDrop:             ocsfActivityDelete,
+	} {
+		assert.Equal(t, expected, ocsfActivity(&entity.AuditEvent{Operation: operation}), operation)
+	}
+}
+
+func TestOCSFTableOperation(t *testing.T) {
+	f, err := NewOCSF("rds-audit-logs", "eu-central-1", "123456789012")
+	assert.NoError(t, err)
+
+	event := f.newEvent(testEntry(), &entity.AuditEvent{Operation: entity.OperationDisconnect, Host: "client.local"})
+	assert.Equal(t, int32(99), event.ActivityID)
+	assert.Equal(t, "Other", event.ActivityName)
+	assert.Equal(t, int64(600599), event.TypeUID)
+	assert.Equal(t, "client.local", *event.SrcEndpoint.Hostname)
+	assert.Nil(t, event.SrcEndpoint.IP)
+
+	event = f.newEvent(testEntry(), &entity.AuditEvent{Operation: entity.OperationWrite, Object: "employees"})
+	assert.Equal(t, &ocsfTable{Name: "employees"}, event.Table)
+	assert.Nil(t, event.QueryInfo)
+}
+
+func TestNewOCSFMissingSettings(t *testing.T) {
+	_, err := NewOCSF("", "eu-central-1", "123456789012")
+	assert.EqualError(t, err, "security lake source name must be set")
+
+	_, err = NewOCSF("rds-audit-logs", "eu-central-1", "")
+	assert.EqualError(t, err, "account ID must be set")
+}
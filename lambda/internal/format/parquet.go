@@ -0,0 +1,117 @@
+package format
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+	"rdsauditlogss3/internal/entity"
+)
+
+const (
+	// ParquetSchemaVersion is the version of the schema of the Parquet files, it changes with incompatible changes
+	ParquetSchemaVersion = "1"
+	// ParquetSchemaVersionKey is the key of the schema version in the key-value metadata of the Parquet files
+	ParquetSchemaVersionKey = "rds_audit_logs_s3.schema_version"
+
+	DefaultParquetCompression = "snappy"
+	// DefaultParquetRowGroupSize is the size of the row groups, Athena reads a file with a single row group at once
+	// and splits bigger files by their row groups
+	DefaultParquetRowGroupSize = 64 * 1024 * 1024
+)
+
+// parquetEvent is the row written for an audit event, the schema is published in README.md
+type parquetEvent struct {
+	Timestamp             int64  `parquet:"name=timestamp, type=INT64, convertedtype=TIMESTAMP_MICROS"`
+	RdsInstanceIdentifier string `parquet:"name=rds_instance_identifier, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	LogFileName           string `parquet:"name=logfile_name, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Line                  int64  `parquet:"name=line, type=INT64"`
+	ServerHost            string `parquet:"name=server_host, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Username              string `parquet:"name=username, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Host                  string `parquet:"name=host, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	ConnectionID          int64  `parquet:"name=connection_id, type=INT64"`
+	QueryID               int64  `parquet:"name=query_id, type=INT64"`
+	Operation             string `parquet:"name=operation, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Database              string `parquet:"name=database, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Object                string `parquet:"name=object, type=BYTE_ARRAY, convertedtype=UTF8"`
+	RetCode               int32  `parquet:"name=retcode, type=INT32"`
+}
+
+// parquetCompressions maps the supported compression names to their codec
+var parquetCompressions = map[string]parquet.CompressionCodec{
+	"snappy": parquet.CompressionCodec_SNAPPY,
+	"zstd":   parquet.CompressionCodec_ZSTD,
+}
+
+// Parquet writes a Parquet file per log entry with one row per audit event
+type Parquet struct {
+	compression  parquet.CompressionCodec
+	rowGroupSize int64
+}
+
+// NewParquet returns the Parquet format, compression is snappy or zstd
+func NewParquet(compression string, rowGroupSize int64) (*Parquet, error) {
+	codec, ok := parquetCompressions[compression]
+	if !ok {
+		return nil, fmt.Errorf("unknown parquet compression %s", compression)
+	}
+	if rowGroupSize <= 0 {
+		return nil, fmt.Errorf("parquet row group size must be positive")
+	}
+	return &Parquet{
+		compression:  codec,
+		rowGroupSize: rowGroupSize,
+	}, nil
+}
+
+func (p *Parquet) Extension() string {
+	return "parquet"
+}
+
+func (p *Parquet) ContentType() string {
+	return "application/vnd.apache.parquet"
+}
+
+func (p *Parquet) Write(w io.Writer, entry entity.LogEntry) error {
+	pw, err := writer.NewParquetWriterFromWriter(w, new(parquetEvent), 1)
+	if err != nil {
+		return fmt.Errorf("could not create parquet writer: %v", err)
+	}
+	pw.CompressionType = p.compression
+	pw.RowGroupSize = p.rowGroupSize
+	schemaVersion := ParquetSchemaVersion
+	pw.Footer.KeyValueMetadata = []*parquet.KeyValue{{Key: ParquetSchemaVersionKey, Value: &schemaVersion}}
+
+	err = forEachEvent(entry, func(event *entity.AuditEvent) error {
+		err := pw.Write(&parquetEvent{
+			Timestamp:             event.Timestamp.UnixNano() / int64(time.Microsecond),
+			RdsInstanceIdentifier: entry.RdsInstanceIdentifier,
+			LogFileName:           entry.LogFileName,
+			Line:                  event.Line,
+			ServerHost:            event.ServerHost,
+			Username:              event.Username,
+			Host:                  event.Host,
+			ConnectionID:          event.ConnectionID,
+			QueryID:               event.QueryID,
+			Operation:             event.Operation,
+			Database:              event.Database,
+			Object:                event.Object,
+			RetCode:               int32(event.RetCode),
+		})
+		if err != nil {
+			return fmt.Errorf("could not write parquet row: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = pw.WriteStop()
+	if err != nil {
+		return fmt.Errorf("could not write parquet footer: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package format
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xitongsys/parquet-go-source/buffer"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+func TestParquetRoundTrip(t *testing.T) {
+	for _, compression := range []string{"snappy", "zstd"} {
+		t.Run(compression, func(t *testing.T) {
+			f, err := NewParquet(compression, DefaultParquetRowGroupSize)
+			assert.NoError(t, err)
+
+			var buf bytes.Buffer
+			err = f.Write(&buf, testEntry())
+			assert.NoError(t, err)
+
+			file, err := buffer.NewBufferFile(buf.Bytes())
+			assert.NoError(t, err)
+			pr, err := reader.NewParquetReader(file, new(parquetEvent), 1)
+			assert.NoError(t, err)
+			defer pr.ReadStop()
+
+			assert.Equal(t, int64(2), pr.GetNumRows())
+			assert.Equal(t, ParquetSchemaVersionKey, pr.Footer.KeyValueMetadata[0].Key)
+			assert.Equal(t, ParquetSchemaVersion, *pr.Footer.KeyValueMetadata[0].Value)
+			assert.Equal(t, parquetCompressions[compression], pr.Footer.RowGroups[0].Columns[0].MetaData.Codec)
+			assert.Equal(t, parquet.ConvertedType_TIMESTAMP_MICROS, *pr.Footer.Schema[1].ConvertedType)
+
+			rows := make([]parquetEvent, 2)
+			err = pr.Read(&rows)
+			assert.NoError(t, err)
+			assert.Equal(t, []parquetEvent{
+				{
+					Timestamp:             time.Date(2020, 7, 14, 10, 30, 2, 0, time.UTC).UnixNano() / 1000,
+					RdsInstanceIdentifier: "my-instance",
+					LogFileName:           "audit/server_audit.log.1",
+					Line:                  1,
+					ServerHost:            "ip-172-27-1-97",
+					Username:              "admin",
+					Host:                  "10.120.182.212",
+					ConnectionID:          33303,
+					Operation:             "CONNECT",
+					Database:              "rdslogstest",
+				},
+				{
+					Timestamp:             time.Date(2020, 7, 14, 10, 30, 3, 123456000, time.UTC).UnixNano() / 1000,
+					RdsInstanceIdentifier: "my-instance",
+					LogFileName:           "audit/server_audit.log.1",
+					Line:                  2,
+					ServerHost:            "ip-172-27-1-97",
+					Username:              "admin",
+					Host:                  "10.120.182.212",
+					ConnectionID:          33303,
+					QueryID:               161152,
+					Operation:             "QUERY",
+					Database:              "rdslogstest",
+					Object:                "SELECT '<a>',\n\"b\"",
+					RetCode:               1064,
+				},
+			}, rows)
+		})
+	}
+}
+
+func TestNewParquetInvalidRowGroupSize(t *testing.T) {
+	_, err := NewParquet("snappy", 0)
+	assert.EqualError(t, err, "parquet row group size must be positive")
+}
@@ -0,0 +1,58 @@
+package logcollector
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// assumeRoleExpiryWindow is the time before the credentials of an assumed role expire at which they are refreshed
+const assumeRoleExpiryWindow = time.Minute
+
+// AssumeRoleOptions is the role assumed for getting the audit logs of an RDS instance, eg. in another account
+type AssumeRoleOptions struct {
+	RoleARN    string
+	ExternalID string
+}
+
+// RoleSessions creates sessions using the credentials of assumed roles.
+// The session of a role is reused, so its credentials are only requested again when they are about to expire.
+type RoleSessions struct {
+	sess     *session.Session
+	mu       sync.Mutex
+	sessions map[AssumeRoleOptions]*session.Session
+}
+
+func NewRoleSessions(sess *session.Session) *RoleSessions {
+	return &RoleSessions{
+		sess:     sess,
+		sessions: make(map[AssumeRoleOptions]*session.Session),
+	}
+}
+
+// Session returns a session with the credentials of the role, or the base session if no role is given
+func (r *RoleSessions) Session(options AssumeRoleOptions) *session.Session {
+	if options.RoleARN == "" {
+		return r.sess
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if sess, ok := r.sessions[options]; ok {
+		return sess
+	}
+
+	credentials := stscreds.NewCredentials(r.sess, options.RoleARN, func(p *stscreds.AssumeRoleProvider) {
+		if options.ExternalID != "" {
+			p.ExternalID = aws.String(options.ExternalID)
+		}
+		p.RoleSessionName = "rds-audit-logs-s3"
+		p.ExpiryWindow = assumeRoleExpiryWindow
+	})
+	sess := r.sess.Copy(&aws.Config{Credentials: credentials})
+	r.sessions[options] = sess
+	return sess
+}
@@ -0,0 +1,30 @@
+package logcollector
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoleSessions(t *testing.T) {
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("eu-central-1"),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+	}))
+	roleSessions := NewRoleSessions(sess)
+
+	assert.Same(t, sess, roleSessions.Session(AssumeRoleOptions{}))
+
+	role := AssumeRoleOptions{RoleARN: "arn:aws:iam::123456789012:role/audit-logs"}
+	roleSess := roleSessions.Session(role)
+	assert.NotSame(t, sess, roleSess)
+	assert.NotSame(t, sess.Config.Credentials, roleSess.Config.Credentials)
+	assert.Equal(t, "eu-central-1", *roleSess.Config.Region)
+	assert.Same(t, roleSess, roleSessions.Session(role))
+
+	roleWithExternalID := AssumeRoleOptions{RoleARN: role.RoleARN, ExternalID: "some-id"}
+	assert.NotSame(t, roleSess, roleSessions.Session(roleWithExternalID))
+}
@@ -1,7 +1,12 @@
 package logcollector
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws/session"
@@ -12,16 +17,66 @@ type HTTPClient interface {
 	Do(req *http.Request) (*http.Response, error)
 }
 
+// HTTPClientOptions configures the HTTP client used for all requests to AWS
+type HTTPClientOptions struct {
+	// ProxyURL is used for all requests, if it is empty the proxy is taken from HTTPS_PROXY and NO_PROXY
+	ProxyURL string
+	// CABundle is the path of a PEM file with certificate authorities which are trusted in addition to the system ones
+	CABundle string
+	// InsecureSkipVerify disables the verification of TLS certificates, it must only be used for development
+	InsecureSkipVerify bool
+}
+
+// NewHTTPClient creates a HTTP client with the given proxy and TLS settings
+func NewHTTPClient(options HTTPClientOptions) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if options.ProxyURL != "" {
+		proxyURL, err := url.Parse(options.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy url: %v", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: options.InsecureSkipVerify,
+	}
+	if options.CABundle != "" {
+		pem, err := ioutil.ReadFile(options.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("could not read CA bundle: %v", err)
+		}
+		rootCAs, err := x509.SystemCertPool()
+		if err != nil {
+			rootCAs = x509.NewCertPool()
+		}
+		if !rootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", options.CABundle)
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	return &http.Client{Transport: transport}, nil
+}
+
 type AWSHttpClient struct {
 	httpClient *http.Client
 	signer     *v4.Signer
 	region     string
 }
 
+// NewAWSHttpClient creates a client signing requests to RDS, it uses the HTTP client of the session if it has one
 func NewAWSHttpClient(sess *session.Session) *AWSHttpClient {
+	httpClient := sess.Config.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{}
+	}
 
 	return &AWSHttpClient{
-		httpClient: &http.Client{},
+		httpClient: httpClient,
 		signer:     v4.NewSigner(sess.Config.Credentials),
 		region:     *sess.Config.Region,
 	}
@@ -0,0 +1,40 @@
+package logcollector
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewHTTPClientProxy(t *testing.T) {
+	client, err := NewHTTPClient(HTTPClientOptions{ProxyURL: "http://proxy.internal:3128"})
+	assert.NoError(t, err)
+
+	req, _ := http.NewRequest("GET", "https://rds.eu-central-1.amazonaws.com", nil)
+	proxyURL, err := client.Transport.(*http.Transport).Proxy(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://proxy.internal:3128", proxyURL.String())
+}
+
+func TestNewHTTPClientCABundle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cabundle")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	invalidBundle := filepath.Join(dir, "invalid.pem")
+	assert.NoError(t, ioutil.WriteFile(invalidBundle, []byte("no certificate"), 0600))
+
+	_, err = NewHTTPClient(HTTPClientOptions{CABundle: invalidBundle})
+	assert.EqualError(t, err, "no certificates found in CA bundle "+invalidBundle)
+
+	_, err = NewHTTPClient(HTTPClientOptions{CABundle: filepath.Join(dir, "missing.pem")})
+	assert.Error(t, err)
+
+	client, err := NewHTTPClient(HTTPClientOptions{InsecureSkipVerify: true})
+	assert.NoError(t, err)
+	assert.True(t, client.Transport.(*http.Transport).TLSClientConfig.InsecureSkipVerify)
+}
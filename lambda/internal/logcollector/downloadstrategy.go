@@ -0,0 +1,100 @@
+package logcollector
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DownloadStrategy selects how rotated log files are downloaded
+type DownloadStrategy string
+
+const (
+	// DownloadComplete downloads a log file at once using the downloadCompleteLogFile REST endpoint
+	DownloadComplete DownloadStrategy = "complete"
+	// DownloadPortion downloads a log file in portions using the DownloadDBLogFilePortion API
+	DownloadPortion DownloadStrategy = "portion"
+	// DownloadAuto uses DownloadComplete and falls back to DownloadPortion after repeated failures
+	DownloadAuto DownloadStrategy = "auto"
+)
+
+// autoFallbackAttempts is the number of consecutive failed complete downloads after which DownloadAuto
+// downloads all log files of an instance in portions
+const autoFallbackAttempts = 3
+
+// DownloadFallbacks counts the consecutive failed complete downloads of every RDS instance for DownloadAuto.
+// It is kept between invocations, so the collectors created by every invocation share it.
+type DownloadFallbacks struct {
+	mu       sync.Mutex
+	failures map[string]int
+}
+
+func NewDownloadFallbacks() *DownloadFallbacks {
+	return &DownloadFallbacks{failures: make(map[string]int)}
+}
+
+// fallenBack returns true if the log files of the instance are only downloaded in portions
+func (f *DownloadFallbacks) fallenBack(rdsInstanceIdentifier string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.failures[rdsInstanceIdentifier] >= autoFallbackAttempts
+}
+
+// recordFailure counts a failed complete download and returns the number of consecutive failures
+func (f *DownloadFallbacks) recordFailure(rdsInstanceIdentifier string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures[rdsInstanceIdentifier]++
+	return f.failures[rdsInstanceIdentifier]
+}
+
+// recordSuccess resets the consecutive failures after a successful complete download
+func (f *DownloadFallbacks) recordSuccess(rdsInstanceIdentifier string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.failures, rdsInstanceIdentifier)
+}
+
+// ParseDownloadStrategy returns the download strategy with the given name
+func ParseDownloadStrategy(name string) (DownloadStrategy, error) {
+	switch strategy := DownloadStrategy(name); strategy {
+	case DownloadComplete, DownloadPortion, DownloadAuto:
+		return strategy, nil
+	}
+	return "", fmt.Errorf("unknown download strategy %s", name)
+}
+
+// download starts downloading a rotated log file using the configured strategy.
+// All strategies return the same data, the log file is only read while the returned reader is read.
+func (c *RdsLogCollector) download(ctx context.Context, logFile LogFile) (io.ReadCloser, error) {
+	switch c.DownloadStrategy {
+	case DownloadPortion:
+		return c.downloadLogFilePortions(ctx, logFile), nil
+	case DownloadAuto:
+		if c.Fallbacks.fallenBack(c.instanceIdentifier) {
+			return c.downloadLogFilePortions(ctx, logFile), nil
+		}
+		// The complete download has already been retried, the log file is downloaded in portions if it failed
+		resp, err := c.downloadLogFile(ctx, logFile)
+		if err == nil {
+			c.Fallbacks.recordSuccess(c.instanceIdentifier)
+			return resp, nil
+		}
+		failures := c.Fallbacks.recordFailure(c.instanceIdentifier)
+		log.WithFields(log.Fields{"logfile_name": logFile.LogFileName, "failures": failures}).WithError(err).Warn("Could not download complete log file, downloading it in portions")
+		if failures >= autoFallbackAttempts {
+			log.WithField("instance", c.instanceIdentifier).Warn("Falling back to downloading all log files in portions")
+		}
+		return c.downloadLogFilePortions(ctx, logFile), nil
+	default:
+		return c.downloadLogFile(ctx, logFile)
+	}
+}
+
+// downloadLogFilePortions downloads a log file from its beginning using DownloadDBLogFilePortion
+func (c *RdsLogCollector) downloadLogFilePortions(ctx context.Context, logFile LogFile) io.ReadCloser {
+	return newPortionReader(ctx, c.rds, c.instanceIdentifier, logFile.LogFileName, "0")
+}
@@ -0,0 +1,32 @@
+package logcollector
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+)
+
+// maxIdentityLineLength is the maximum length of the first line used for the identity of a log file
+const maxIdentityLineLength = 4096
+
+// logFileIdentity identifies a rotated log file independent of its name, so it is recognized after it has been renamed.
+// It consists of the time the file was last written, its size and the hash of its first line.
+func logFileIdentity(logFile LogFile, firstLine []byte) string {
+	return fmt.Sprintf("%s%x", logFileIdentityPrefix(logFile), sha256.Sum256(firstLine))
+}
+
+// logFileIdentityPrefix is the part of the identity which is known without downloading the log file
+func logFileIdentityPrefix(logFile LogFile) string {
+	return fmt.Sprintf("%d-%d-", logFile.LastWritten, logFile.Size)
+}
+
+// hasIdentityPrefix returns true if one of the identities may belong to the log file
+func hasIdentityPrefix(identities []string, logFile LogFile) bool {
+	prefix := logFileIdentityPrefix(logFile)
+	for _, identity := range identities {
+		if strings.HasPrefix(identity, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package logcollector
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// Integrity describes the data read from a log file download
+type Integrity struct {
+	// Bytes is the number of bytes read
+	Bytes int64
+	// Lines is the number of lines read
+	Lines int64
+	// Sha256 is the hex encoded SHA-256 digest of the data, it is set once the download has been read completely
+	Sha256 string
+	// Err is set if the download does not match the log file
+	Err error
+}
+
+// integrityReader counts the bytes and lines of a log file download and computes its SHA-256 digest.
+// Once the download has been read completely it is verified, if that fails the error is returned instead of io.EOF.
+type integrityReader struct {
+	reader    io.Reader
+	hash      hash.Hash
+	integrity Integrity
+	lastByte  byte
+	// verify checks the number of bytes read against the log file
+	verify func(bytes int64) error
+}
+
+func newIntegrityReader(reader io.Reader, verify func(bytes int64) error) *integrityReader {
+	return &integrityReader{
+		reader: reader,
+		hash:   sha256.New(),
+		verify: verify,
+	}
+}
+
+func (r *integrityReader) Read(p []byte) (int, error) {
+	if r.integrity.Err != nil {
+		return 0, r.integrity.Err
+	}
+
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.hash.Write(p[:n])
+		r.integrity.Bytes += int64(n)
+		for _, b := range p[:n] {
+			if b == '\n' {
+				r.integrity.Lines++
+			}
+		}
+		r.lastByte = p[n-1]
+	}
+	if err == io.EOF {
+		r.integrity.Sha256 = hex.EncodeToString(r.hash.Sum(nil))
+		r.integrity.Err = r.finish()
+		if r.integrity.Err != nil {
+			return n, r.integrity.Err
+		}
+	}
+	return n, err
+}
+
+// Integrity returns the integrity of the data read so far
+func (r *integrityReader) Integrity() Integrity {
+	return r.integrity
+}
+
+// finish verifies the download once it has been read completely
+func (r *integrityReader) finish() error {
+	if r.integrity.Bytes > 0 && r.lastByte != '\n' {
+		return fmt.Errorf("last line of the download is incomplete after %d bytes", r.integrity.Bytes)
+	}
+	return r.verify(r.integrity.Bytes)
+}
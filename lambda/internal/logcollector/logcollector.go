@@ -1,10 +1,38 @@
 package logcollector
 
-import "io"
+import (
+	"context"
+	"io"
+)
 
 type LogCollector interface {
-	GetLogs(logFileTimestamp int64) (io.Reader, bool, int64, error)
-	ValidateAndPrepareRDSInstance() error
+	// GetLogs returns the data of the next rotated log file newer than logFileTimestamp or nil if there is none.
+	// The data is streamed while it is read and must be closed by the caller.
+	// Log files written at logFileTimestamp are skipped if their identity is one of processedLogFiles.
+	GetLogs(ctx context.Context, logFileTimestamp int64, processedLogFiles []string) (*LogFileReader, error)
+	// GetActiveLogs returns the data of the active log file after marker or nil if the active file can't be tailed.
+	// offset is the number of bytes of the active log file which have already been read.
+	GetActiveLogs(ctx context.Context, marker string, offset int64) (*LogFileReader, error)
+	ValidateAndPrepareRDSInstance(ctx context.Context) error
+	DBType() string
+}
+
+// LogFileReader streams the data of a single log file
+type LogFileReader struct {
+	io.ReadCloser
+	LogFileName      string
+	LogFileTimestamp int64
+	Size             int64
+	// Identity identifies the log file independent of its name, it is only set for rotated log files
+	Identity string
+	// MissingPredecessor is set if the log file processed before is not retained anymore,
+	// log files written in between may have been lost
+	MissingPredecessor bool
+	// Marker returns the position after the data read so far, it is only set for active log files
+	Marker func() string
+	// Integrity returns the integrity of the data read so far, it is only set for rotated log files.
+	// Err is set if the download is incomplete, reading the log file fails with the same error then.
+	Integrity func() Integrity
 }
 
 type GetLogsCallback func(logLine string, logFileTimestamp int64)
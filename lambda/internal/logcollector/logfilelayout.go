@@ -0,0 +1,70 @@
+package logcollector
+
+import (
+	"regexp"
+	"strings"
+)
+
+// logFileLayout describes how a database engine names and rotates its audit log files
+type logFileLayout struct {
+	// dbType is the format of the audit log data written by the engine
+	dbType string
+	// prefix is the common prefix of all audit log file names
+	prefix string
+	// rotatedFile matches the names of audit log files which can be rotated.
+	// If it has a submatch, the submatch identifies the stream the file belongs to.
+	rotatedFile *regexp.Regexp
+	// renamedOnRotation is set if the active file is renamed on rotation (server_audit.log -> server_audit.log.1).
+	// Otherwise files keep their name and only the most recently written file of each stream is still active.
+	renamedOnRotation bool
+}
+
+var (
+	// mariaDBAuditPluginLayout is used by RDS MariaDB and RDS MySQL with the MARIADB_AUDIT_PLUGIN option
+	mariaDBAuditPluginLayout = logFileLayout{
+		dbType:            "mysql",
+		prefix:            "audit/server_audit.log",
+		rotatedFile:       regexp.MustCompile(`^audit/server_audit\.log\.\d+$`),
+		renamedOnRotation: true,
+	}
+
+	// auroraMySQLLayout is used by Aurora MySQL advanced auditing, eg. audit/audit.log.0.2024-01-01-10-30.0
+	auroraMySQLLayout = logFileLayout{
+		dbType:      "mysql",
+		prefix:      "audit/audit.log",
+		rotatedFile: regexp.MustCompile(`^(audit/audit\.log\.\d+)\.\d{4}-\d{2}-\d{2}-\d{2}-\d{2}\.\d+$`),
+	}
+
+	// postgresLayout is used by RDS for PostgreSQL and Aurora PostgreSQL, eg. error/postgresql.log.2024-01-01-10
+	postgresLayout = logFileLayout{
+		dbType:      "postgres",
+		prefix:      "error/postgresql.log.",
+		rotatedFile: regexp.MustCompile(`^(error/postgresql\.log)\.\d{4}-\d{2}-\d{2}-\d{2,4}$`),
+	}
+)
+
+// engineLogFileLayouts maps the RDS engine names to the layout of their audit log files
+var engineLogFileLayouts = map[string]logFileLayout{
+	"mariadb":           mariaDBAuditPluginLayout,
+	"mysql":             mariaDBAuditPluginLayout,
+	"aurora-mysql":      auroraMySQLLayout,
+	"postgres":          postgresLayout,
+	"aurora-postgresql": postgresLayout,
+}
+
+// matches returns true if the log file is an audit log file of this layout
+func (l *logFileLayout) matches(logFile LogFile) bool {
+	return strings.HasPrefix(logFile.LogFileName, l.prefix)
+}
+
+// stream returns the stream a log file belongs to, an empty string means it's not a rotatable file
+func (l *logFileLayout) stream(logFileName string) string {
+	match := l.rotatedFile.FindStringSubmatch(logFileName)
+	if match == nil {
+		return ""
+	}
+	if len(match) > 1 {
+		return match[1]
+	}
+	return match[0]
+}
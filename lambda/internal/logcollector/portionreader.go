@@ -0,0 +1,74 @@
+package logcollector
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/aws/aws-sdk-go/service/rds/rdsiface"
+)
+
+// portionReader reads a log file using DownloadDBLogFilePortion, the next portion is only requested once
+// the previous one has been read
+type portionReader struct {
+	ctx                context.Context
+	rds                rdsiface.RDSAPI
+	instanceIdentifier string
+	logFileName        string
+	marker             string
+	buf                []byte
+	done               bool
+}
+
+func newPortionReader(ctx context.Context, api rdsiface.RDSAPI, instanceIdentifier string, logFileName string, marker string) *portionReader {
+	if marker == "" {
+		marker = "0"
+	}
+	return &portionReader{
+		ctx:                ctx,
+		rds:                api,
+		instanceIdentifier: instanceIdentifier,
+		logFileName:        logFileName,
+		marker:             marker,
+	}
+}
+
+func (r *portionReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+
+		output, err := r.rds.DownloadDBLogFilePortionWithContext(r.ctx, &rds.DownloadDBLogFilePortionInput{
+			DBInstanceIdentifier: aws.String(r.instanceIdentifier),
+			LogFileName:          aws.String(r.logFileName),
+			Marker:               aws.String(r.marker),
+		})
+		if err != nil {
+			return 0, fmt.Errorf("could not download log file portion: %v", err)
+		}
+
+		r.buf = []byte(aws.StringValue(output.LogFileData))
+		if output.Marker != nil {
+			r.marker = *output.Marker
+		}
+		r.done = !aws.BoolValue(output.AdditionalDataPending)
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *portionReader) Close() error {
+	r.buf = nil
+	r.done = true
+	return nil
+}
+
+// Marker returns the marker of the last downloaded portion
+func (r *portionReader) Marker() string {
+	return r.marker
+}
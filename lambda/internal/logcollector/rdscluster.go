@@ -0,0 +1,57 @@
+package logcollector
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/aws/aws-sdk-go/service/rds/rdsiface"
+)
+
+// ClusterMember is an instance which is part of an Aurora cluster
+type ClusterMember struct {
+	InstanceIdentifier string
+	IsWriter           bool
+}
+
+// ClusterMemberLister lists the current members of a cluster
+type ClusterMemberLister interface {
+	ListClusterMembers(ctx context.Context) ([]ClusterMember, error)
+}
+
+// RdsClusterMemberLister lists the members of an Aurora cluster using the RDS API
+type RdsClusterMemberLister struct {
+	rds               rdsiface.RDSAPI
+	clusterIdentifier string
+}
+
+func NewRdsClusterMemberLister(api rdsiface.RDSAPI, clusterIdentifier string) *RdsClusterMemberLister {
+	return &RdsClusterMemberLister{
+		rds:               api,
+		clusterIdentifier: clusterIdentifier,
+	}
+}
+
+func (l *RdsClusterMemberLister) ListClusterMembers(ctx context.Context) ([]ClusterMember, error) {
+	output, err := l.rds.DescribeDBClustersWithContext(ctx, &rds.DescribeDBClustersInput{
+		DBClusterIdentifier: aws.String(l.clusterIdentifier),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not describe db cluster: %v", err)
+	}
+
+	if len(output.DBClusters) == 0 {
+		return nil, fmt.Errorf("could not find db cluster: %v", l.clusterIdentifier)
+	}
+
+	var members []ClusterMember
+	for _, m := range output.DBClusters[0].DBClusterMembers {
+		members = append(members, ClusterMember{
+			InstanceIdentifier: aws.StringValue(m.DBInstanceIdentifier),
+			IsWriter:           aws.BoolValue(m.IsClusterWriter),
+		})
+	}
+
+	return members, nil
+}
@@ -0,0 +1,60 @@
+package logcollector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	TestRdsClusterIdentifier = "my-rds-cluster"
+)
+
+func (m *mockRdsClient) DescribeDBClustersWithContext(ctx aws.Context, input *rds.DescribeDBClustersInput, opts ...request.Option) (*rds.DescribeDBClustersOutput, error) {
+	args := m.MethodCalled("DescribeDBClusters", input)
+	return args.Get(0).(*rds.DescribeDBClustersOutput), args.Error(1)
+}
+
+func TestListClusterMembers(t *testing.T) {
+	rdsClient := new(mockRdsClient)
+	lister := NewRdsClusterMemberLister(rdsClient, TestRdsClusterIdentifier)
+
+	rdsClient.On("DescribeDBClusters", &rds.DescribeDBClustersInput{
+		DBClusterIdentifier: aws.String(TestRdsClusterIdentifier),
+	}).Return(&rds.DescribeDBClustersOutput{
+		DBClusters: []*rds.DBCluster{
+			{
+				DBClusterIdentifier: aws.String(TestRdsClusterIdentifier),
+				DBClusterMembers: []*rds.DBClusterMember{
+					{DBInstanceIdentifier: aws.String("my-rds-instance-1"), IsClusterWriter: aws.Bool(true)},
+					{DBInstanceIdentifier: aws.String("my-rds-instance-2"), IsClusterWriter: aws.Bool(false)},
+				},
+			},
+		},
+	}, nil)
+
+	members, err := lister.ListClusterMembers(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []ClusterMember{
+		{InstanceIdentifier: "my-rds-instance-1", IsWriter: true},
+		{InstanceIdentifier: "my-rds-instance-2", IsWriter: false},
+	}, members)
+
+	rdsClient.AssertExpectations(t)
+}
+
+func TestListClusterMembersNotFound(t *testing.T) {
+	rdsClient := new(mockRdsClient)
+	lister := NewRdsClusterMemberLister(rdsClient, TestRdsClusterIdentifier)
+
+	rdsClient.On("DescribeDBClusters", &rds.DescribeDBClustersInput{
+		DBClusterIdentifier: aws.String(TestRdsClusterIdentifier),
+	}).Return(&rds.DescribeDBClustersOutput{}, nil)
+
+	_, err := lister.ListClusterMembers(context.Background())
+	assert.Error(t, err)
+}
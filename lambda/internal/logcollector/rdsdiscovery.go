@@ -0,0 +1,90 @@
+package logcollector
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/aws/aws-sdk-go/service/rds/rdsiface"
+	log "github.com/sirupsen/logrus"
+)
+
+// DiscoveredInstance is an RDS instance which has been tagged for getting its audit logs
+type DiscoveredInstance struct {
+	InstanceIdentifier string
+	// Overrides holds the per instance settings given by tags named "<tag key>:<setting>"
+	Overrides map[string]string
+	// Err is set if the tags of the instance could not be listed, it is unknown if the instance is tagged then
+	Err error
+}
+
+// InstanceDiscoverer finds the RDS instances to get audit logs for
+type InstanceDiscoverer interface {
+	DiscoverInstances(ctx context.Context) ([]DiscoveredInstance, error)
+}
+
+// RdsTagInstanceDiscoverer finds all RDS instances having a tag with the given key and value
+type RdsTagInstanceDiscoverer struct {
+	rds      rdsiface.RDSAPI
+	tagKey   string
+	tagValue string
+}
+
+func NewRdsTagInstanceDiscoverer(api rdsiface.RDSAPI, tagKey string, tagValue string) *RdsTagInstanceDiscoverer {
+	return &RdsTagInstanceDiscoverer{
+		rds:      api,
+		tagKey:   tagKey,
+		tagValue: tagValue,
+	}
+}
+
+func (d *RdsTagInstanceDiscoverer) DiscoverInstances(ctx context.Context) ([]DiscoveredInstance, error) {
+	var dbInstances []*rds.DBInstance
+	err := d.rds.DescribeDBInstancesPagesWithContext(ctx, &rds.DescribeDBInstancesInput{}, func(output *rds.DescribeDBInstancesOutput, lastPage bool) bool {
+		dbInstances = append(dbInstances, output.DBInstances...)
+		return !lastPage
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not describe db instances: %v", err)
+	}
+
+	var instances []DiscoveredInstance
+	for _, dbInstance := range dbInstances {
+		output, err := d.rds.ListTagsForResourceWithContext(ctx, &rds.ListTagsForResourceInput{
+			ResourceName: dbInstance.DBInstanceArn,
+		})
+		if err != nil {
+			// The other instances are still discovered, the caller decides whether to keep the instance
+			log.WithField("instance", aws.StringValue(dbInstance.DBInstanceIdentifier)).WithError(err).Warn("Could not list tags of db instance")
+			instances = append(instances, DiscoveredInstance{
+				InstanceIdentifier: aws.StringValue(dbInstance.DBInstanceIdentifier),
+				Err:                fmt.Errorf("could not list tags: %v", err),
+			})
+			continue
+		}
+
+		enabled := false
+		overrides := make(map[string]string)
+		for _, tag := range output.TagList {
+			key := aws.StringValue(tag.Key)
+			value := aws.StringValue(tag.Value)
+			if key == d.tagKey && value == d.tagValue {
+				enabled = true
+			}
+			if strings.HasPrefix(key, d.tagKey+":") {
+				overrides[strings.TrimPrefix(key, d.tagKey+":")] = value
+			}
+		}
+
+		if enabled {
+			instances = append(instances, DiscoveredInstance{
+				InstanceIdentifier: aws.StringValue(dbInstance.DBInstanceIdentifier),
+				Overrides:          overrides,
+			})
+		}
+	}
+
+	return instances, nil
+}
@@ -0,0 +1,112 @@
+package logcollector
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func (m *mockRdsClient) DescribeDBInstancesPagesWithContext(ctx aws.Context, input *rds.DescribeDBInstancesInput, callback func(output *rds.DescribeDBInstancesOutput, lastPage bool) bool, opts ...request.Option) error {
+	args := m.MethodCalled("DescribeDBInstancesPages", input, callback)
+	return args.Error(0)
+}
+
+func (m *mockRdsClient) ListTagsForResourceWithContext(ctx aws.Context, input *rds.ListTagsForResourceInput, opts ...request.Option) (*rds.ListTagsForResourceOutput, error) {
+	args := m.MethodCalled("ListTagsForResource", input)
+	return args.Get(0).(*rds.ListTagsForResourceOutput), args.Error(1)
+}
+
+func TestDiscoverInstances(t *testing.T) {
+	rdsClient := new(mockRdsClient)
+	discoverer := NewRdsTagInstanceDiscoverer(rdsClient, "audit-logs-s3", "enabled")
+
+	rdsClient.On("DescribeDBInstancesPages", &rds.DescribeDBInstancesInput{}, mock.AnythingOfType("func(*rds.DescribeDBInstancesOutput, bool) bool")).Return(nil).Run(func(args mock.Arguments) {
+		cb := args.Get(1).(func(*rds.DescribeDBInstancesOutput, bool) bool)
+		cb(&rds.DescribeDBInstancesOutput{
+			DBInstances: []*rds.DBInstance{
+				{DBInstanceIdentifier: aws.String("my-rds-instance-1"), DBInstanceArn: aws.String("arn:aws:rds:eu-central-1:123456789012:db:my-rds-instance-1")},
+				{DBInstanceIdentifier: aws.String("my-rds-instance-2"), DBInstanceArn: aws.String("arn:aws:rds:eu-central-1:123456789012:db:my-rds-instance-2")},
+			},
+		}, false)
+		cb(&rds.DescribeDBInstancesOutput{
+			DBInstances: []*rds.DBInstance{
+				{DBInstanceIdentifier: aws.String("my-rds-instance-3"), DBInstanceArn: aws.String("arn:aws:rds:eu-central-1:123456789012:db:my-rds-instance-3")},
+			},
+		}, true)
+	})
+
+	rdsClient.On("ListTagsForResource", &rds.ListTagsForResourceInput{
+		ResourceName: aws.String("arn:aws:rds:eu-central-1:123456789012:db:my-rds-instance-1"),
+	}).Return(&rds.ListTagsForResourceOutput{
+		TagList: []*rds.Tag{
+			{Key: aws.String("audit-logs-s3"), Value: aws.String("enabled")},
+			{Key: aws.String("audit-logs-s3:s3-prefix"), Value: aws.String("custom/prefix")},
+			{Key: aws.String("team"), Value: aws.String("payments")},
+		},
+	}, nil)
+	rdsClient.On("ListTagsForResource", &rds.ListTagsForResourceInput{
+		ResourceName: aws.String("arn:aws:rds:eu-central-1:123456789012:db:my-rds-instance-2"),
+	}).Return(&rds.ListTagsForResourceOutput{
+		TagList: []*rds.Tag{
+			{Key: aws.String("audit-logs-s3"), Value: aws.String("disabled")},
+		},
+	}, nil)
+	rdsClient.On("ListTagsForResource", &rds.ListTagsForResourceInput{
+		ResourceName: aws.String("arn:aws:rds:eu-central-1:123456789012:db:my-rds-instance-3"),
+	}).Return(&rds.ListTagsForResourceOutput{
+		TagList: []*rds.Tag{
+			{Key: aws.String("audit-logs-s3"), Value: aws.String("enabled")},
+		},
+	}, nil)
+
+	instances, err := discoverer.DiscoverInstances(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []DiscoveredInstance{
+		{InstanceIdentifier: "my-rds-instance-1", Overrides: map[string]string{"s3-prefix": "custom/prefix"}},
+		{InstanceIdentifier: "my-rds-instance-3", Overrides: map[string]string{}},
+	}, instances)
+
+	rdsClient.AssertExpectations(t)
+}
+
+func TestDiscoverInstancesWithoutTags(t *testing.T) {
+	rdsClient := new(mockRdsClient)
+	discoverer := NewRdsTagInstanceDiscoverer(rdsClient, "audit-logs-s3", "enabled")
+
+	rdsClient.On("DescribeDBInstancesPages", &rds.DescribeDBInstancesInput{}, mock.AnythingOfType("func(*rds.DescribeDBInstancesOutput, bool) bool")).Return(nil).Run(func(args mock.Arguments) {
+		cb := args.Get(1).(func(*rds.DescribeDBInstancesOutput, bool) bool)
+		cb(&rds.DescribeDBInstancesOutput{
+			DBInstances: []*rds.DBInstance{
+				{DBInstanceIdentifier: aws.String("my-rds-instance-1"), DBInstanceArn: aws.String("arn:aws:rds:eu-central-1:123456789012:db:my-rds-instance-1")},
+				{DBInstanceIdentifier: aws.String("my-rds-instance-2"), DBInstanceArn: aws.String("arn:aws:rds:eu-central-1:123456789012:db:my-rds-instance-2")},
+			},
+		}, true)
+	})
+
+	rdsClient.On("ListTagsForResource", &rds.ListTagsForResourceInput{
+		ResourceName: aws.String("arn:aws:rds:eu-central-1:123456789012:db:my-rds-instance-1"),
+	}).Return((*rds.ListTagsForResourceOutput)(nil), fmt.Errorf("AccessDenied"))
+	rdsClient.On("ListTagsForResource", &rds.ListTagsForResourceInput{
+		ResourceName: aws.String("arn:aws:rds:eu-central-1:123456789012:db:my-rds-instance-2"),
+	}).Return(&rds.ListTagsForResourceOutput{
+		TagList: []*rds.Tag{
+			{Key: aws.String("audit-logs-s3"), Value: aws.String("enabled")},
+			{Key: aws.String("audit-logs-s3:output-format"), Value: aws.String("json")},
+		},
+	}, nil)
+
+	instances, err := discoverer.DiscoverInstances(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []DiscoveredInstance{
+		{InstanceIdentifier: "my-rds-instance-1", Err: fmt.Errorf("could not list tags: AccessDenied")},
+		{InstanceIdentifier: "my-rds-instance-2", Overrides: map[string]string{"output-format": "json"}},
+	}, instances)
+
+	rdsClient.AssertExpectations(t)
+}
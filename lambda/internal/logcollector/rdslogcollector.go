@@ -1,23 +1,25 @@
 package logcollector
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
-	"regexp"
 	"sort"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
 	"github.com/aws/aws-sdk-go/service/rds"
 	"github.com/aws/aws-sdk-go/service/rds/rdsiface"
 	log "github.com/sirupsen/logrus"
+	"rdsauditlogss3/internal/retry"
 )
 
-const maxRetries = 5
-
 // LogFile wraps the returned structure from AWS
 // "Size": 2196,
 // "LogFileName": "slowquery/mysql-slowquery.log.7",
@@ -34,13 +36,26 @@ func (l *LogFile) String() string {
 	return fmt.Sprintf("%-35s (date: %s, size: %d)", l.LogFileName, l.LastWrittenTime, l.Size)
 }
 
-func (l *LogFile) IsRotatedFile() bool {
-	matched, err := regexp.Match(`\.log\.\d+$`, []byte(l.LogFileName))
-	if err != nil {
-		log.Warnf("Error matching log file: %v", err)
+// IsRotatedFile returns true if the engine does not write to the log file anymore
+func (l *LogFile) IsRotatedFile(layout *logFileLayout, logFiles []LogFile) bool {
+	stream := layout.stream(l.LogFileName)
+	if stream == "" {
 		return false
 	}
-	return matched
+	if layout.renamedOnRotation {
+		return true
+	}
+
+	// Files keep their names, so the file is rotated once a newer file of the same stream exists
+	for _, other := range logFiles {
+		if other.LogFileName == l.LogFileName || layout.stream(other.LogFileName) != stream {
+			continue
+		}
+		if other.LastWritten > l.LastWritten || (other.LastWritten == l.LastWritten && other.LogFileName > l.LogFileName) {
+			return true
+		}
+	}
+	return false
 }
 
 // RdsLogCollectorOld contains handles to the provided LogCollectorOptions + aws.RDS struct
@@ -51,7 +66,16 @@ type RdsLogCollector struct {
 	instanceIdentifier string
 	dbType             string
 	logType            string
-	logFile            string
+	layout             logFileLayout
+	// Endpoint is the RDS endpoint used to download complete log files, it is resolved from the region by default
+	Endpoint string
+	// DownloadStrategy selects how rotated log files are downloaded, DownloadComplete by default
+	DownloadStrategy DownloadStrategy
+	// Retry is the policy for retrying rotated log files, empty listings and complete downloads.
+	// The RDS API calls are retried by the retryer of the RDS client, every failure is retried in one layer only.
+	Retry retry.Policy
+	// Fallbacks counts the failed complete downloads of DownloadAuto, it should be shared between invocations
+	Fallbacks *DownloadFallbacks
 }
 
 func NewRdsLogCollector(api rdsiface.RDSAPI, httpClient HTTPClient, region string, rdsInstanceIdentifier string, dbType string) *RdsLogCollector {
@@ -60,17 +84,84 @@ func NewRdsLogCollector(api rdsiface.RDSAPI, httpClient HTTPClient, region strin
 		region:             region,
 		httpClient:         httpClient,
 		dbType:             dbType,
-		logFile:            "audit/server_audit.log",
+		layout:             mariaDBAuditPluginLayout,
 		instanceIdentifier: rdsInstanceIdentifier,
+		Endpoint:           defaultRdsEndpoint(region),
+		DownloadStrategy:   DownloadComplete,
+		Retry:              retry.DefaultPolicy(),
+		Fallbacks:          NewDownloadFallbacks(),
+	}
+}
+
+// defaultRdsEndpoint returns the RDS endpoint of the region, taking the partition (eg. China or GovCloud) into account
+func defaultRdsEndpoint(region string) string {
+	endpoint, err := endpoints.DefaultResolver().EndpointFor(rds.EndpointsID, region)
+	if err != nil {
+		return fmt.Sprintf("https://rds.%s.amazonaws.com", region)
+	}
+	return endpoint.URL
+}
+
+func (c *RdsLogCollector) GetLogs(ctx context.Context, logFileTimestamp int64, processedLogFiles []string) (*LogFileReader, error) {
+	var logFile *LogFileReader
+	err := c.Retry.Do(ctx, "get logs", func() error {
+		var rotated bool
+		var err error
+		logFile, rotated, err = c.getLogs(ctx, logFileTimestamp, processedLogFiles)
+		if err != nil {
+			// Listing and downloading the log files has been retried already
+			return retry.WithClass(err, retry.Permanent)
+		}
+		if rotated {
+			return retry.WithClass(fmt.Errorf("file was rotated when getting the logs"), retry.Retryable)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	return logFile, nil
 }
 
-func (c *RdsLogCollector) GetLogs(logFileTimestamp int64) (io.Reader, bool, int64, error) {
-	return c.getLogs(logFileTimestamp, maxRetries)
+func (c *RdsLogCollector) GetActiveLogs(ctx context.Context, marker string, offset int64) (*LogFileReader, error) {
+	logFiles, err := c.getLogFiles(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get log files: %v", err)
+	}
+
+	var activeLogFiles []LogFile
+	for _, lf := range logFiles {
+		if !lf.IsRotatedFile(&c.layout, logFiles) {
+			activeLogFiles = append(activeLogFiles, lf)
+		}
+	}
+	if len(activeLogFiles) != 1 {
+		// Several streams are written at the same time, only rotated files can be processed
+		log.WithField("active_logfiles", len(activeLogFiles)).Debug("Not tailing active log file")
+		return nil, nil
+	}
+	activeLogFile := activeLogFiles[0]
+
+	if activeLogFile.Size < offset {
+		// The tailed file has been rotated, it is processed as rotated file first
+		log.WithField("logfile_name", activeLogFile.LogFileName).Debug("Active log file is smaller than tailed data")
+		return nil, nil
+	}
+
+	log.WithField("logfile_name", activeLogFile.LogFileName).WithField("marker", marker).Info("Tailing active log file")
+
+	reader := newPortionReader(ctx, c.rds, c.instanceIdentifier, activeLogFile.LogFileName, marker)
+	return &LogFileReader{
+		ReadCloser:       reader,
+		LogFileName:      activeLogFile.LogFileName,
+		LogFileTimestamp: activeLogFile.LastWritten,
+		Size:             activeLogFile.Size,
+		Marker:           reader.Marker,
+	}, nil
 }
 
-func (c *RdsLogCollector) ValidateAndPrepareRDSInstance() error {
-	output, err := c.rds.DescribeDBInstances(&rds.DescribeDBInstancesInput{
+func (c *RdsLogCollector) ValidateAndPrepareRDSInstance(ctx context.Context) error {
+	output, err := c.rds.DescribeDBInstancesWithContext(ctx, &rds.DescribeDBInstancesInput{
 		DBInstanceIdentifier: aws.String(c.instanceIdentifier),
 		MaxRecords:           aws.Int64(20),
 	})
@@ -91,115 +182,183 @@ func (c *RdsLogCollector) ValidateAndPrepareRDSInstance() error {
 	return nil
 }
 
-func (c *RdsLogCollector) getLogs(logFileTimestamp int64, retries int) (io.Reader, bool, int64, error) {
-	currentLogFile, err := c.getCurrentLogFileNewerThanTimestamp(logFileTimestamp)
+// DBType returns the format of the audit log data, it is known after ValidateAndPrepareRDSInstance
+func (c *RdsLogCollector) DBType() string {
+	return c.dbType
+}
 
+// getLogs opens the oldest rotated log file which has not been processed yet.
+// rotated is set if the log files have been rotated while it was opened, it must be retried then.
+func (c *RdsLogCollector) getLogs(ctx context.Context, logFileTimestamp int64, processedLogFiles []string) (logFile *LogFileReader, rotated bool, err error) {
+	logFiles, err := c.getLogFiles(ctx)
 	if err != nil {
-		return nil, false, 0, fmt.Errorf("could not get current log file: %v", err)
+		return nil, false, fmt.Errorf("cannot get log files: %v", err)
+	}
+
+	for _, candidate := range findLogFilesNotOlderThanTimestamp(&c.layout, logFiles, logFileTimestamp) {
+		mightBeProcessed := hasIdentityPrefix(processedLogFiles, candidate)
+		if candidate.LastWritten == logFileTimestamp && len(processedLogFiles) == 0 {
+			// Checkpoints without identities only tell that the files written at the checkpoint have been processed
+			continue
+		}
+
+		log.WithField("logfile_timestamp", logFileTimestamp).WithField("logfile_name", candidate.LogFileName).Info("Getting logs")
+
+		logFile, err = c.openLogFile(ctx, candidate)
+		if err != nil {
+			return nil, false, fmt.Errorf("could not get log data: %v", err)
+		}
+		if mightBeProcessed && containsString(processedLogFiles, logFile.Identity) {
+			// The same file has been processed before, possibly under a different name
+			log.WithField("logfile_name", candidate.LogFileName).WithField("identity", logFile.Identity).Info("Skipping already processed log file")
+			logFile.Close()
+			logFile = nil
+			continue
+		}
+		break
 	}
-	if currentLogFile == nil {
+	if logFile == nil {
 		// No newer logs are available
-		return nil, false, 0, nil
+		return nil, false, nil
 	}
 
-	log.WithField("logfile_timestamp", logFileTimestamp).WithField("logfile_name", currentLogFile.LogFileName).Info("Getting logs")
-
-	resp, err := c.downloadLogFile(*currentLogFile)
+	// Check if the file was not rotated in the meantime, only its first line has been read so far
+	newLogFiles, err := c.getLogFiles(ctx)
 	if err != nil {
-		return nil, false, 0, fmt.Errorf("could not get log data: %v", err)
+		logFile.Close()
+		return nil, false, fmt.Errorf("cannot get log files: %v", err)
+	}
+	if !containsLogFile(newLogFiles, logFile.LogFileName, logFile.LogFileTimestamp, logFile.Size) {
+		logFile.Close()
+		return nil, true, nil
 	}
-	defer resp.Close()
 
-	// Check if file was not rotated in the meantime
-	newCurrentLogFile, err := c.getCurrentLogFileNewerThanTimestamp(logFileTimestamp)
+	logFile.MissingPredecessor = isPredecessorMissing(logFiles, logFileTimestamp)
+	return logFile, false, nil
+}
+
+// openLogFile starts downloading a log file and determines its identity from its first line
+func (c *RdsLogCollector) openLogFile(ctx context.Context, logFile LogFile) (*LogFileReader, error) {
+	resp, err := c.download(ctx, logFile)
 	if err != nil {
-		return nil, false, 0, fmt.Errorf("could not get current log file: %v", err)
+		return nil, err
 	}
-	if newCurrentLogFile.LogFileName != currentLogFile.LogFileName {
-		// File was rotated in the meantime -> retry it
-		if retries >= 1 {
-			return c.getLogs(logFileTimestamp, retries-1)
-		}
-		return nil, false, 0, fmt.Errorf("file was rotated when getting the logs")
+
+	data := bufio.NewReaderSize(resp, maxIdentityLineLength)
+	firstLine, err := data.Peek(maxIdentityLineLength)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		resp.Close()
+		return nil, fmt.Errorf("could not read first line of %s: %v", logFile.LogFileName, err)
+	}
+	if i := bytes.IndexByte(firstLine, '\n'); i >= 0 {
+		firstLine = firstLine[:i]
 	}
 
-	//_, err = io.Copy(buf, resp)
-	buf := new(bytes.Buffer)
-	_, err = buf.ReadFrom(resp)
+	integrity := newIntegrityReader(data, func(bytes int64) error {
+		return c.verifyLogFileSize(ctx, logFile, bytes)
+	})
+	return &LogFileReader{
+		ReadCloser: struct {
+			io.Reader
+			io.Closer
+		}{integrity, resp},
+		LogFileName:      logFile.LogFileName,
+		LogFileTimestamp: logFile.LastWritten,
+		Size:             logFile.Size,
+		Identity:         logFileIdentity(logFile, firstLine),
+		Integrity:        integrity.Integrity,
+	}, nil
+}
+
+// verifyLogFileSize checks if the number of bytes downloaded matches the size of the log file.
+// If more bytes have been downloaded, the file may have grown after it was listed. This is accepted if
+// the file is listed with the downloaded size now.
+func (c *RdsLogCollector) verifyLogFileSize(ctx context.Context, logFile LogFile, bytes int64) error {
+	if bytes == logFile.Size {
+		return nil
+	}
+	if bytes < logFile.Size {
+		return fmt.Errorf("download of %s is truncated, got %d of %d bytes", logFile.LogFileName, bytes, logFile.Size)
+	}
+
+	logFiles, err := c.getLogFiles(ctx)
 	if err != nil {
-		if retries >= 1 {
-			log.WithField("logfile_timestamp", logFileTimestamp).WithField("retries", retries-1).Warn("Retrying because of error reading response body")
-			time.Sleep(1 * time.Second)
-			return c.getLogs(logFileTimestamp, retries-1)
+		return fmt.Errorf("could not verify size of %s: %v", logFile.LogFileName, err)
+	}
+	for _, l := range logFiles {
+		if l.LogFileName == logFile.LogFileName && l.Size == bytes {
+			log.WithFields(log.Fields{"logfile_name": logFile.LogFileName, "listed_size": logFile.Size, "size": bytes}).Warn("Log file has grown after it was listed")
+			return nil
 		}
-		return nil, false, 0, fmt.Errorf("could not read response from log data: %v", err)
 	}
-
-	return buf, true, currentLogFile.LastWritten, nil
+	return fmt.Errorf("download of %s has %d bytes, but the file has %d bytes", logFile.LogFileName, bytes, logFile.Size)
 }
 
 // downloadLogFile will download a full RDS log at once from the AWS
 // REST API Endpoint that is not available through the Go SDK.
 // It will return an absolute string path to the file.
-func (c *RdsLogCollector) downloadLogFile(currentLogFile LogFile) (io.ReadCloser, error) {
+func (c *RdsLogCollector) downloadLogFile(ctx context.Context, currentLogFile LogFile) (io.ReadCloser, error) {
 	client := c.httpClient
-	host := fmt.Sprintf("https://rds.%s.amazonaws.com", c.region)
 
-	req, err := http.NewRequest("GET", host, nil)
-	if err != nil {
-		return nil, err
-	}
+	var resp *http.Response
+	err := c.Retry.Do(ctx, "download log file", func() error {
+		req, err := http.NewRequestWithContext(ctx, "GET", c.Endpoint, nil)
+		if err != nil {
+			return err
+		}
 
-	req.URL.Path = fmt.Sprintf("/v13/downloadCompleteLogFile/%s/%s", c.instanceIdentifier, currentLogFile.LogFileName)
-	req.Close = true
+		req.URL.Path = fmt.Sprintf("%s/v13/downloadCompleteLogFile/%s/%s", strings.TrimSuffix(req.URL.Path, "/"), c.instanceIdentifier, currentLogFile.LogFileName)
+		req.Close = true
 
-	resp, err := client.Do(req)
+		resp, err = client.Do(req)
+		if err != nil {
+			return err
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			err = fmt.Errorf("could not download log file %s, status code is %d", currentLogFile.LogFileName, resp.StatusCode)
+			return retry.WithClass(err, retry.ClassifyStatusCode(resp.StatusCode))
+		}
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("could not download log file %s, status code is %d", currentLogFile.LogFileName, resp.StatusCode)
-	}
-
-	fmt.Printf("Download request completed with status: %d > %s \n", resp.StatusCode, req.URL.Path)
-
-	//defer resp.Body.Close()
-
+	log.WithFields(log.Fields{"logfile_name": currentLogFile.LogFileName, "status_code": resp.StatusCode}).Debug("Download request completed")
 	return resp.Body, nil
 }
 
 func (c *RdsLogCollector) setRdsInstanceDBType(instance *rds.DBInstance) error {
 	engine := *instance.Engine
 
-	var dbType string
-	switch engine {
-	case "mariadb":
-		dbType = "mysql"
-	case "postgres":
-		dbType = "postgres"
-	default:
+	layout, ok := engineLogFileLayouts[engine]
+	if !ok {
 		return fmt.Errorf("unsupported engine %s", engine)
 	}
 
-	c.dbType = dbType
+	c.dbType = layout.dbType
+	c.layout = layout
 	return nil
 }
 
-func (c *RdsLogCollector) getCurrentLogFileNewerThanTimestamp(logFileTimestamp int64) (*LogFile, error) {
-	logFiles, err := c.getLogFiles(maxRetries)
-	if err != nil {
-		return nil, fmt.Errorf("cannot get log files: %v", err)
-	}
-
-	return findLogFileNewerThanTimestamp(logFiles, logFileTimestamp)
+// getLogFiles returns a list of all audit log files of the engine's log file layout
+func (c *RdsLogCollector) getLogFiles(ctx context.Context) ([]LogFile, error) {
+	var logFiles []LogFile
+	err := c.Retry.Do(ctx, "list log files", func() error {
+		var err error
+		logFiles, err = c.listLogFiles(ctx)
+		return err
+	})
+	return logFiles, err
 }
 
-// getLogFiles returns a list of all log files based on the LogCollectorOptions.LogFile pattern
-func (c *RdsLogCollector) getLogFiles(retries int) ([]LogFile, error) {
+// listLogFiles lists the audit log files once, an empty result is a retryable error
+func (c *RdsLogCollector) listLogFiles(ctx context.Context) ([]LogFile, error) {
 	var logFiles []LogFile
 
-	err := c.rds.DescribeDBLogFilesPages(&rds.DescribeDBLogFilesInput{
+	err := c.rds.DescribeDBLogFilesPagesWithContext(ctx, &rds.DescribeDBLogFilesInput{
 		DBInstanceIdentifier: &c.instanceIdentifier,
 	}, func(output *rds.DescribeDBLogFilesOutput, lastPage bool) bool {
 		// assign go timestamp from msec epoch time, rebuild as a list
@@ -215,12 +374,13 @@ func (c *RdsLogCollector) getLogFiles(retries int) ([]LogFile, error) {
 		return lastPage
 	})
 	if err != nil {
-		return nil, fmt.Errorf("error getting db log files: %v", err)
+		// The request has been retried by the retryer of the RDS client already
+		return nil, retry.WithClass(fmt.Errorf("error getting db log files: %v", err), retry.Permanent)
 	}
 
 	var matchingLogFiles []LogFile
 	for _, lf := range logFiles {
-		if strings.HasPrefix(lf.LogFileName, c.logFile) {
+		if c.layout.matches(lf) {
 			matchingLogFiles = append(matchingLogFiles, lf)
 		}
 	}
@@ -229,23 +389,75 @@ func (c *RdsLogCollector) getLogFiles(retries int) ([]LogFile, error) {
 
 	if len(matchingLogFiles) == 0 {
 		// sometimes the API returns empty results. Handle that with a retry to make sure it's really empty
-		if retries >= 1 {
-			return c.getLogFiles(retries - 1)
-		}
-		return nil, fmt.Errorf("No log file with the given prefix found. Number of log files: %v", len(logFiles))
+		return nil, retry.WithClass(fmt.Errorf("No log file with the given prefix found. Number of log files: %v", len(logFiles)), retry.Retryable)
 	}
 
 	return matchingLogFiles, nil
 }
 
-func findLogFileNewerThanTimestamp(logFiles []LogFile, finishedLogFileTimestamp int64) (*LogFile, error) {
+// isPredecessorMissing returns true if the log file processed last is not retained anymore.
+// Log files are deleted oldest first, so as long as it is retained no newer log file can have been lost.
+func isPredecessorMissing(logFiles []LogFile, finishedLogFileTimestamp int64) bool {
+	if finishedLogFileTimestamp == 0 {
+		// Nothing has been processed yet
+		return false
+	}
+	for _, l := range logFiles {
+		if l.LastWritten <= finishedLogFileTimestamp {
+			return false
+		}
+	}
+	return true
+}
+
+// maxActiveFileIdle is the time since the last write to any log file after which an active log file
+// does not hold back the rotated files of other streams anymore
+const maxActiveFileIdle = time.Hour
+
+// findLogFilesNotOlderThanTimestamp returns the rotated log files written at or after finishedLogFileTimestamp, oldest first.
+// Files written exactly at finishedLogFileTimestamp may have been processed already, their identity tells.
+func findLogFilesNotOlderThanTimestamp(layout *logFileLayout, logFiles []LogFile, finishedLogFileTimestamp int64) []LogFile {
 	sort.SliceStable(logFiles, func(i, j int) bool { return logFiles[i].LastWritten < logFiles[j].LastWritten })
 
+	// If several streams are written at the same time, a rotated file must not be processed before
+	// the active files of the other streams. Otherwise these would end up behind the checkpoint once they are rotated.
+	// Idle streams don't hold back the others, their active file is only rotated after it has been written again.
+	oldestActiveFile := int64(math.MaxInt64)
+	if !layout.renamedOnRotation && len(logFiles) > 0 {
+		newest := logFiles[len(logFiles)-1].LastWritten
+		for _, l := range logFiles {
+			idle := time.Duration(newest-l.LastWritten) * time.Millisecond
+			if !l.IsRotatedFile(layout, logFiles) && idle <= maxActiveFileIdle && l.LastWritten < oldestActiveFile {
+				oldestActiveFile = l.LastWritten
+			}
+		}
+	}
+
+	var candidates []LogFile
 	for _, l := range logFiles {
-		if l.LastWritten > finishedLogFileTimestamp && l.IsRotatedFile() {
-			return &l, nil
+		if l.LastWritten >= finishedLogFileTimestamp && l.LastWritten < oldestActiveFile && l.IsRotatedFile(layout, logFiles) {
+			candidates = append(candidates, l)
 		}
 	}
 
-	return nil, nil
+	return candidates
+}
+
+// containsLogFile returns true if logFiles contains the file with the given name, last written time and size
+func containsLogFile(logFiles []LogFile, logFileName string, lastWritten int64, size int64) bool {
+	for _, l := range logFiles {
+		if l.LogFileName == logFileName && l.LastWritten == lastWritten && l.Size == size {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
 }
@@ -1,6 +1,8 @@
 package logcollector
 
 import (
+	"context"
+	"crypto/sha256"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -9,10 +11,13 @@ import (
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/rds"
 	"github.com/aws/aws-sdk-go/service/rds/rdsiface"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"rdsauditlogss3/internal/retry"
 )
 
 type mockRdsClient struct {
@@ -20,13 +25,13 @@ type mockRdsClient struct {
 	mock.Mock
 }
 
-func (m *mockRdsClient) DownloadDBLogFilePortion(input *rds.DownloadDBLogFilePortionInput) (*rds.DownloadDBLogFilePortionOutput, error) {
-	args := m.Called(input)
+func (m *mockRdsClient) DownloadDBLogFilePortionWithContext(ctx aws.Context, input *rds.DownloadDBLogFilePortionInput, opts ...request.Option) (*rds.DownloadDBLogFilePortionOutput, error) {
+	args := m.MethodCalled("DownloadDBLogFilePortion", input)
 	return args.Get(0).(*rds.DownloadDBLogFilePortionOutput), args.Error(1)
 }
 
-func (m *mockRdsClient) DescribeDBLogFilesPages(input *rds.DescribeDBLogFilesInput, callback func(output *rds.DescribeDBLogFilesOutput, lastPage bool) bool) error {
-	args := m.Called(input, callback)
+func (m *mockRdsClient) DescribeDBLogFilesPagesWithContext(ctx aws.Context, input *rds.DescribeDBLogFilesInput, callback func(output *rds.DescribeDBLogFilesOutput, lastPage bool) bool, opts ...request.Option) error {
+	args := m.MethodCalled("DescribeDBLogFilesPages", input, callback)
 	return args.Error(0)
 }
 
@@ -44,7 +49,7 @@ const (
 	TestRdsInstanceIdentifier = "my-rds-instance"
 )
 
-func TestFindLogFileNewerThanTimestamp(t *testing.T) {
+func TestFindLogFilesNotOlderThanTimestamp(t *testing.T) {
 
 	logFiles := []LogFile{
 		{
@@ -69,17 +74,215 @@ func TestFindLogFileNewerThanTimestamp(t *testing.T) {
 		},
 	}
 
-	log, err := findLogFileNewerThanTimestamp(logFiles, 1595253008000)
-	assert.NoError(t, err)
-	assert.Equal(t, int64(1595256406000), log.LastWritten)
+	logs := findLogFilesNotOlderThanTimestamp(&mariaDBAuditPluginLayout, logFiles, 1595253008000)
+	assert.Equal(t, []string{"audit/server_audit.log.3", "audit/server_audit.log.2", "audit/server_audit.log.1"}, logFileNames(logs))
+
+	logsZero := findLogFilesNotOlderThanTimestamp(&mariaDBAuditPluginLayout, logFiles, 0)
+	assert.Equal(t, int64(1595253008000), logsZero[0].LastWritten)
+
+	logsNonRotated := findLogFilesNotOlderThanTimestamp(&mariaDBAuditPluginLayout, logFiles, 1595259825000)
+	assert.Empty(t, logsNonRotated)
+}
+
+func logFileNames(logFiles []LogFile) []string {
+	var names []string
+	for _, l := range logFiles {
+		names = append(names, l.LogFileName)
+	}
+	return names
+}
+
+func TestFindLogFilesNotOlderThanTimestampAurora(t *testing.T) {
+
+	logFiles := []LogFile{
+		{
+			LastWritten: 1704105000000,
+			LogFileName: "audit/audit.log.0.2024-01-01-10-30.0",
+			Size:        104857600,
+		},
+		{
+			LastWritten: 1704106800000,
+			LogFileName: "audit/audit.log.0.2024-01-01-10-30.1",
+			Size:        104857600,
+		},
+		{
+			LastWritten: 1704108600000,
+			LogFileName: "audit/audit.log.0.2024-01-01-11-00.2",
+			Size:        2048,
+		},
+		{
+			LastWritten: 1704107700000,
+			LogFileName: "audit/audit.log.1.2024-01-01-10-30.0",
+			Size:        4096,
+		},
+	}
+
+	logs := findLogFilesNotOlderThanTimestamp(&auroraMySQLLayout, logFiles, 0)
+	assert.Equal(t, []string{"audit/audit.log.0.2024-01-01-10-30.0", "audit/audit.log.0.2024-01-01-10-30.1"}, logFileNames(logs))
+
+	logsNext := findLogFilesNotOlderThanTimestamp(&auroraMySQLLayout, logFiles, 1704105000001)
+	assert.Equal(t, []string{"audit/audit.log.0.2024-01-01-10-30.1"}, logFileNames(logsNext))
+
+	// audit.log.1 is still active and written before audit.log.0.2024-01-01-11-00.2
+	logsNonRotated := findLogFilesNotOlderThanTimestamp(&auroraMySQLLayout, logFiles, 1704106800001)
+	assert.Empty(t, logsNonRotated)
+}
+
+func TestFindLogFilesNotOlderThanTimestampAuroraIdleStream(t *testing.T) {
+	logFiles := []LogFile{
+		{
+			LastWritten: 1704067200000,
+			LogFileName: "audit/audit.log.1.2024-01-01-00-00.0",
+			Size:        4096,
+		},
+		{
+			LastWritten: 1704105000000,
+			LogFileName: "audit/audit.log.0.2024-01-01-10-30.0",
+			Size:        104857600,
+		},
+		{
+			LastWritten: 1704108600000,
+			LogFileName: "audit/audit.log.0.2024-01-01-11-00.1",
+			Size:        2048,
+		},
+	}
+
+	// audit.log.1 has not been written for hours, it does not hold back the rotated files of audit.log.0
+	logs := findLogFilesNotOlderThanTimestamp(&auroraMySQLLayout, logFiles, 0)
+	assert.Equal(t, []string{"audit/audit.log.0.2024-01-01-10-30.0"}, logFileNames(logs))
+}
+
+func TestFindLogFilesNotOlderThanTimestampPostgres(t *testing.T) {
+
+	logFiles := []LogFile{
+		{
+			LastWritten: 1704110399000,
+			LogFileName: "error/postgresql.log.2024-01-01-10",
+			Size:        3000,
+		},
+		{
+			LastWritten: 1704113999000,
+			LogFileName: "error/postgresql.log.2024-01-01-11",
+			Size:        2000,
+		},
+		{
+			LastWritten: 1704114600000,
+			LogFileName: "error/postgresql.log.2024-01-01-12",
+			Size:        1000,
+		},
+	}
 
-	logZero, err := findLogFileNewerThanTimestamp(logFiles, 0)
+	logs := findLogFilesNotOlderThanTimestamp(&postgresLayout, logFiles, 1704110399001)
+	assert.Equal(t, []string{"error/postgresql.log.2024-01-01-11"}, logFileNames(logs))
+
+	logsNonRotated := findLogFilesNotOlderThanTimestamp(&postgresLayout, logFiles, 1704113999001)
+	assert.Empty(t, logsNonRotated)
+}
+
+func TestIsRotatedFile(t *testing.T) {
+	mariaDBLogFiles := []LogFile{
+		{LastWritten: 2, LogFileName: "audit/server_audit.log"},
+		{LastWritten: 1, LogFileName: "audit/server_audit.log.1"},
+	}
+	assert.False(t, mariaDBLogFiles[0].IsRotatedFile(&mariaDBAuditPluginLayout, mariaDBLogFiles))
+	assert.True(t, mariaDBLogFiles[1].IsRotatedFile(&mariaDBAuditPluginLayout, mariaDBLogFiles))
+
+	auroraLogFiles := []LogFile{
+		{LastWritten: 1, LogFileName: "audit/audit.log.0.2024-01-01-10-30.0"},
+		{LastWritten: 2, LogFileName: "audit/audit.log.0.2024-01-01-10-30.1"},
+		{LastWritten: 3, LogFileName: "audit/audit.log.1.2024-01-01-10-30.0"},
+	}
+	assert.True(t, auroraLogFiles[0].IsRotatedFile(&auroraMySQLLayout, auroraLogFiles))
+	assert.False(t, auroraLogFiles[1].IsRotatedFile(&auroraMySQLLayout, auroraLogFiles))
+	assert.False(t, auroraLogFiles[2].IsRotatedFile(&auroraMySQLLayout, auroraLogFiles))
+}
+
+func TestIsPredecessorMissing(t *testing.T) {
+	logFiles := []LogFile{
+		{LastWritten: 30, LogFileName: "audit/server_audit.log"},
+		{LastWritten: 20, LogFileName: "audit/server_audit.log.1"},
+		{LastWritten: 10, LogFileName: "audit/server_audit.log.2"},
+	}
+	assert.False(t, isPredecessorMissing(logFiles, 0))
+	assert.False(t, isPredecessorMissing(logFiles, 10))
+	assert.False(t, isPredecessorMissing(logFiles, 15))
+	assert.True(t, isPredecessorMissing(logFiles, 5))
+}
+
+func TestRdsEndpoint(t *testing.T) {
+	assert.Equal(t, "https://rds.eu-central-1.amazonaws.com", NewRdsLogCollector(new(mockRdsClient), new(mockHttpClient), "eu-central-1", TestRdsInstanceIdentifier, "mysql").Endpoint)
+	assert.Equal(t, "https://rds.cn-north-1.amazonaws.com.cn", NewRdsLogCollector(new(mockRdsClient), new(mockHttpClient), "cn-north-1", TestRdsInstanceIdentifier, "mysql").Endpoint)
+	assert.Equal(t, "https://rds.us-gov-west-1.amazonaws.com", NewRdsLogCollector(new(mockRdsClient), new(mockHttpClient), "us-gov-west-1", TestRdsInstanceIdentifier, "mysql").Endpoint)
+
+	httpClient := new(mockHttpClient)
+	collector := NewRdsLogCollector(new(mockRdsClient), httpClient, "eu-central-1", TestRdsInstanceIdentifier, "mysql")
+	collector.Endpoint = "http://localhost:4566/rds/"
+
+	httpClient.On("Do", mock.MatchedBy(func(i *http.Request) bool {
+		return i.URL.String() == fmt.Sprintf("http://localhost:4566/rds/v13/downloadCompleteLogFile/%s/audit/server_audit.log.1", TestRdsInstanceIdentifier)
+	})).Return(&http.Response{
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+		StatusCode: 200,
+	}, nil)
+
+	_, err := collector.downloadLogFile(context.Background(), LogFile{LogFileName: "audit/server_audit.log.1"})
 	assert.NoError(t, err)
-	assert.Equal(t, int64(1595253008000), logZero.LastWritten)
+	httpClient.AssertExpectations(t)
+}
 
-	logNonRotated, err := findLogFileNewerThanTimestamp(logFiles, 1595259824000)
+func TestDownloadLogFileRetry(t *testing.T) {
+	httpClient := new(mockHttpClient)
+	collector := NewRdsLogCollector(new(mockRdsClient), httpClient, "eu-central-1", TestRdsInstanceIdentifier, "mysql")
+	collector.Retry = retry.Policy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+
+	httpClient.On("Do", mock.Anything).Return(&http.Response{
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+		StatusCode: 503,
+	}, nil).Once()
+	httpClient.On("Do", mock.Anything).Return(&http.Response{
+		Body:       ioutil.NopCloser(strings.NewReader("data")),
+		StatusCode: 200,
+	}, nil).Once()
+
+	body, err := collector.downloadLogFile(context.Background(), LogFile{LogFileName: "audit/server_audit.log.1"})
 	assert.NoError(t, err)
-	assert.Nil(t, logNonRotated)
+	data, _ := ioutil.ReadAll(body)
+	assert.Equal(t, "data", string(data))
+
+	// Client errors are not retried
+	httpClient.On("Do", mock.Anything).Return(&http.Response{
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+		StatusCode: 403,
+	}, nil).Once()
+	_, err = collector.downloadLogFile(context.Background(), LogFile{LogFileName: "audit/server_audit.log.1"})
+	assert.EqualError(t, err, "could not download log file audit/server_audit.log.1, status code is 403")
+
+	httpClient.AssertExpectations(t)
+}
+
+func TestSetRdsInstanceDBType(t *testing.T) {
+	collector := NewRdsLogCollector(new(mockRdsClient), new(mockHttpClient), "eu-central-1", TestRdsInstanceIdentifier, "mysql")
+
+	for engine, expectedPrefix := range map[string]string{
+		"mariadb":      "audit/server_audit.log",
+		"mysql":        "audit/server_audit.log",
+		"aurora-mysql": "audit/audit.log",
+	} {
+		err := collector.setRdsInstanceDBType(&rds.DBInstance{Engine: aws.String(engine)})
+		assert.NoError(t, err)
+		assert.Equal(t, "mysql", collector.DBType())
+		assert.Equal(t, expectedPrefix, collector.layout.prefix)
+	}
+
+	for _, engine := range []string{"postgres", "aurora-postgresql"} {
+		err := collector.setRdsInstanceDBType(&rds.DBInstance{Engine: aws.String(engine)})
+		assert.NoError(t, err)
+		assert.Equal(t, "postgres", collector.DBType())
+		assert.Equal(t, "error/postgresql.log.", collector.layout.prefix)
+	}
+
+	err := collector.setRdsInstanceDBType(&rds.DBInstance{Engine: aws.String("sqlserver-ee")})
+	assert.Error(t, err)
 }
 
 func TestGetLogFiles(t *testing.T) {
@@ -135,7 +338,7 @@ func TestGetLogFiles(t *testing.T) {
 		cb(ddlfOutput, true)
 	})
 
-	logFiles, err := collector.getLogFiles(maxRetries)
+	logFiles, err := collector.getLogFiles(context.Background())
 	assert.NoError(t, err)
 
 	expectedLogfiles := []LogFile{
@@ -205,7 +408,7 @@ func TestGetLogFilesWithRetry(t *testing.T) {
 		cb(ddlfOutput, true)
 	})
 
-	logFiles, err := collector.getLogFiles(maxRetries)
+	logFiles, err := collector.getLogFiles(context.Background())
 	assert.NoError(t, err)
 
 	expectedLogfiles := []LogFile{
@@ -229,6 +432,42 @@ func TestGetLogFilesWithRetry(t *testing.T) {
 	rdsClient.AssertExpectations(t)
 }
 
+func TestGetLogsDoesNotRetryFailedRequests(t *testing.T) {
+	rdsClient := new(mockRdsClient)
+	collector := NewRdsLogCollector(rdsClient, new(mockHttpClient), "eu-central-1", TestRdsInstanceIdentifier, "mysql")
+	collector.Retry = retry.Policy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+
+	// The retryer of the RDS client has retried the throttled request already
+	throttled := awserr.New("Throttling", "Rate exceeded", nil)
+	rdsClient.On("DescribeDBLogFilesPages", mock.Anything, mock.Anything).Return(throttled).Once()
+
+	_, err := collector.GetLogs(context.Background(), 0, nil)
+	assert.EqualError(t, err, "cannot get log files: error getting db log files: Throttling: Rate exceeded")
+
+	// The download is retried by downloadLogFile only
+	httpClient := new(mockHttpClient)
+	collector.httpClient = httpClient
+	rdsClient.On("DescribeDBLogFilesPages", mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		cb := args.Get(1).(func(*rds.DescribeDBLogFilesOutput, bool) bool)
+		cb(&rds.DescribeDBLogFilesOutput{
+			DescribeDBLogFiles: []*rds.DescribeDBLogFilesDetails{
+				{LastWritten: aws.Int64(2), LogFileName: aws.String("audit/server_audit.log"), Size: aws.Int64(10)},
+				{LastWritten: aws.Int64(1), LogFileName: aws.String("audit/server_audit.log.1"), Size: aws.Int64(10)},
+			},
+		}, true)
+	}).Once()
+	httpClient.On("Do", mock.Anything).Return(&http.Response{
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+		StatusCode: 503,
+	}, nil).Times(3)
+
+	_, err = collector.GetLogs(context.Background(), 0, nil)
+	assert.Error(t, err)
+
+	rdsClient.AssertExpectations(t)
+	httpClient.AssertExpectations(t)
+}
+
 func TestGetLogsZeroTimestamp(t *testing.T) {
 	rdsClient := new(mockRdsClient)
 	httpClient := new(mockHttpClient)
@@ -272,10 +511,11 @@ func TestGetLogsZeroTimestamp(t *testing.T) {
 		StatusCode: 200,
 	}, nil)
 
-	logLines, _, logFileTimestamp, err := collector.GetLogs(int64(0))
+	logLines, err := collector.GetLogs(context.Background(), int64(0), nil)
 	assert.NoError(t, err)
 	logLinesBytes, _ := ioutil.ReadAll(logLines)
-	assert.Equal(t, int64(1595256406000), logFileTimestamp)
+	assert.Equal(t, int64(1595256406000), logLines.LogFileTimestamp)
+	assert.Equal(t, "audit/server_audit.log.2", logLines.LogFileName)
 	assert.Equal(t, logFileData1, string(logLinesBytes))
 
 	rdsClient.AssertExpectations(t)
@@ -324,10 +564,10 @@ func TestGetLogsWithTimestamp(t *testing.T) {
 		StatusCode: 200,
 	}, nil)
 
-	logLines, _, currentMarker, err := collector.GetLogs(int64(1595256406000))
+	logLines, err := collector.GetLogs(context.Background(), int64(1595256406000), nil)
 	assert.NoError(t, err)
 	logLinesBytes, _ := ioutil.ReadAll(logLines)
-	assert.Equal(t, int64(1595259824000), currentMarker)
+	assert.Equal(t, int64(1595259824000), logLines.LogFileTimestamp)
 	assert.Equal(t, logFileData, string(logLinesBytes))
 
 	rdsClient.AssertExpectations(t)
@@ -416,11 +656,336 @@ func TestGetLogsWithTimestampRotatedInBetween(t *testing.T) {
 		StatusCode: 200,
 	}, nil)
 
-	logLines, _, currentMarker, err := collector.GetLogs(int64(1595256406000))
+	logLines, err := collector.GetLogs(context.Background(), int64(1595256406000), nil)
 	assert.NoError(t, err)
 	logLinesBytes, _ := ioutil.ReadAll(logLines)
-	assert.Equal(t, int64(1595259824000), currentMarker)
+	assert.Equal(t, int64(1595259824000), logLines.LogFileTimestamp)
 	assert.Equal(t, logFileData, string(logLinesBytes))
 
 	rdsClient.AssertExpectations(t)
 }
+
+func TestGetActiveLogs(t *testing.T) {
+	rdsClient := new(mockRdsClient)
+	httpClient := new(mockHttpClient)
+	collector := NewRdsLogCollector(rdsClient, httpClient, "eu-central-1", TestRdsInstanceIdentifier, "mysql")
+
+	ddlfInput := &rds.DescribeDBLogFilesInput{
+		DBInstanceIdentifier: aws.String(TestRdsInstanceIdentifier),
+	}
+	ddlfOutput := &rds.DescribeDBLogFilesOutput{
+		DescribeDBLogFiles: []*rds.DescribeDBLogFilesDetails{
+			{
+				LastWritten: aws.Int64(1595262837000),
+				LogFileName: aws.String("audit/server_audit.log"),
+				Size:        aws.Int64(2000),
+			},
+			{
+				LastWritten: aws.Int64(1595259824000),
+				LogFileName: aws.String("audit/server_audit.log.1"),
+				Size:        aws.Int64(1000159),
+			},
+		},
+	}
+	rdsClient.On("DescribeDBLogFilesPages", ddlfInput, mock.AnythingOfType("func(*rds.DescribeDBLogFilesOutput, bool) bool")).Return(nil).Run(func(args mock.Arguments) {
+		cb := args.Get(1).(func(*rds.DescribeDBLogFilesOutput, bool) bool)
+		cb(ddlfOutput, true)
+	})
+
+	rdsClient.On("DownloadDBLogFilePortion", &rds.DownloadDBLogFilePortionInput{
+		DBInstanceIdentifier: aws.String(TestRdsInstanceIdentifier),
+		LogFileName:          aws.String("audit/server_audit.log"),
+		Marker:               aws.String("1:1000"),
+	}).Return(&rds.DownloadDBLogFilePortionOutput{
+		LogFileData:           aws.String("line 1\n"),
+		Marker:                aws.String("1:1500"),
+		AdditionalDataPending: aws.Bool(true),
+	}, nil).Once()
+	rdsClient.On("DownloadDBLogFilePortion", &rds.DownloadDBLogFilePortionInput{
+		DBInstanceIdentifier: aws.String(TestRdsInstanceIdentifier),
+		LogFileName:          aws.String("audit/server_audit.log"),
+		Marker:               aws.String("1:1500"),
+	}).Return(&rds.DownloadDBLogFilePortionOutput{
+		LogFileData:           aws.String("line 2\nline"),
+		Marker:                aws.String("1:2000"),
+		AdditionalDataPending: aws.Bool(false),
+	}, nil).Once()
+
+	logLines, err := collector.GetActiveLogs(context.Background(), "1:1000", 1000)
+	assert.NoError(t, err)
+	logLinesBytes, err := ioutil.ReadAll(logLines)
+	assert.NoError(t, err)
+	assert.Equal(t, "line 1\nline 2\nline", string(logLinesBytes))
+	assert.Equal(t, "audit/server_audit.log", logLines.LogFileName)
+	assert.Equal(t, int64(1595262837000), logLines.LogFileTimestamp)
+	assert.Equal(t, "1:2000", logLines.Marker())
+
+	// The active file has been rotated since it was tailed
+	logLines, err = collector.GetActiveLogs(context.Background(), "1:2000", 3000)
+	assert.NoError(t, err)
+	assert.Nil(t, logLines)
+
+	rdsClient.AssertExpectations(t)
+}
+
+func TestGetLogsSkipsProcessedLogFile(t *testing.T) {
+	rdsClient := new(mockRdsClient)
+	httpClient := new(mockHttpClient)
+	collector := NewRdsLogCollector(rdsClient, httpClient, "eu-central-1", TestRdsInstanceIdentifier, "mysql")
+
+	// Both rotated files were last written at the same time, server_audit.log.2 has been processed as server_audit.log.1
+	ddlfInput := &rds.DescribeDBLogFilesInput{
+		DBInstanceIdentifier: aws.String(TestRdsInstanceIdentifier),
+	}
+	ddlfOutput := &rds.DescribeDBLogFilesOutput{
+		DescribeDBLogFiles: []*rds.DescribeDBLogFilesDetails{
+			{
+				LastWritten: aws.Int64(1595262837000),
+				LogFileName: aws.String("audit/server_audit.log"),
+				Size:        aws.Int64(901862),
+			},
+			{
+				LastWritten: aws.Int64(1595259824000),
+				LogFileName: aws.String("audit/server_audit.log.1"),
+				Size:        aws.Int64(28),
+			},
+			{
+				LastWritten: aws.Int64(1595259824000),
+				LogFileName: aws.String("audit/server_audit.log.2"),
+				Size:        aws.Int64(14),
+			},
+		},
+	}
+	rdsClient.On("DescribeDBLogFilesPages", ddlfInput, mock.AnythingOfType("func(*rds.DescribeDBLogFilesOutput, bool) bool")).Return(nil).Run(func(args mock.Arguments) {
+		cb := args.Get(1).(func(*rds.DescribeDBLogFilesOutput, bool) bool)
+		cb(ddlfOutput, true)
+	})
+
+	processedData := "first line 1\n"
+	processedIdentity := logFileIdentity(LogFile{LastWritten: 1595259824000, Size: 14}, []byte("first line 1"))
+	newData := "first line 2\nsecond line 2\n"
+
+	expectDownload := func(name string, data string) {
+		path := fmt.Sprintf("/v13/downloadCompleteLogFile/%s/%s", TestRdsInstanceIdentifier, name)
+		httpClient.On("Do", mock.MatchedBy(func(i *http.Request) bool { return i.URL.Path == path })).Return(&http.Response{
+			Body:       ioutil.NopCloser(strings.NewReader(data)),
+			StatusCode: 200,
+		}, nil).Once()
+	}
+
+	// server_audit.log.1 can't have been processed, its size differs
+	expectDownload("audit/server_audit.log.1", newData)
+	logLines, err := collector.GetLogs(context.Background(), int64(1595259824000), []string{processedIdentity})
+	assert.NoError(t, err)
+	logLinesBytes, _ := ioutil.ReadAll(logLines)
+	assert.Equal(t, "audit/server_audit.log.1", logLines.LogFileName)
+	assert.Equal(t, newData, string(logLinesBytes))
+	newIdentity := logFileIdentity(LogFile{LastWritten: 1595259824000, Size: 28}, []byte("first line 2"))
+	assert.Equal(t, newIdentity, logLines.Identity)
+
+	// Both files have been processed, their first lines are checked
+	expectDownload("audit/server_audit.log.1", newData)
+	expectDownload("audit/server_audit.log.2", processedData)
+	logLines, err = collector.GetLogs(context.Background(), int64(1595259824000), []string{processedIdentity, newIdentity})
+	assert.NoError(t, err)
+	assert.Nil(t, logLines)
+
+	httpClient.AssertExpectations(t)
+}
+
+func TestGetLogsIntegrity(t *testing.T) {
+	logFileData := "20200720 16:38:00,ip-172-27-1-97,rdsadmin,localhost,26,1337974,QUERY,mysql,'SELECT 1',0\n20200720 16:38:01,ip-172-27-1-97,rdsadmin,localhost,26,1337976,QUERY,mysql,'SELECT 1',0\n"
+
+	tests := []struct {
+		name        string
+		listedSizes []int64
+		data        string
+		err         string
+	}{
+		{name: "complete", listedSizes: []int64{int64(len(logFileData))}, data: logFileData},
+		{name: "truncated", listedSizes: []int64{int64(len(logFileData))}, data: logFileData[:100],
+			err: "last line of the download is incomplete after 100 bytes"},
+		{name: "truncated at line end", listedSizes: []int64{int64(len(logFileData) + 10)}, data: logFileData,
+			err: fmt.Sprintf("download of audit/server_audit.log.1 is truncated, got %d of %d bytes", len(logFileData), len(logFileData)+10)},
+		{name: "grown after listing", listedSizes: []int64{50, int64(len(logFileData))}, data: logFileData},
+		{name: "bigger than listed", listedSizes: []int64{50, 50}, data: logFileData,
+			err: fmt.Sprintf("download of audit/server_audit.log.1 has %d bytes, but the file has 50 bytes", len(logFileData))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rdsClient := new(mockRdsClient)
+			httpClient := new(mockHttpClient)
+			collector := NewRdsLogCollector(rdsClient, httpClient, "eu-central-1", TestRdsInstanceIdentifier, "mysql")
+
+			ddlfInput := &rds.DescribeDBLogFilesInput{
+				DBInstanceIdentifier: aws.String(TestRdsInstanceIdentifier),
+			}
+			listings := 0
+			rdsClient.On("DescribeDBLogFilesPages", ddlfInput, mock.AnythingOfType("func(*rds.DescribeDBLogFilesOutput, bool) bool")).Return(nil).Run(func(args mock.Arguments) {
+				// The first two listings are done before the download, the following ones when verifying it
+				size := tt.listedSizes[0]
+				if listings >= 2 {
+					size = tt.listedSizes[len(tt.listedSizes)-1]
+				}
+				listings++
+				cb := args.Get(1).(func(*rds.DescribeDBLogFilesOutput, bool) bool)
+				cb(&rds.DescribeDBLogFilesOutput{
+					DescribeDBLogFiles: []*rds.DescribeDBLogFilesDetails{
+						{
+							LastWritten: aws.Int64(1595262837000),
+							LogFileName: aws.String("audit/server_audit.log"),
+							Size:        aws.Int64(901862),
+						},
+						{
+							LastWritten: aws.Int64(1595259824000),
+							LogFileName: aws.String("audit/server_audit.log.1"),
+							Size:        aws.Int64(size),
+						},
+					},
+				}, true)
+			})
+			httpClient.On("Do", mock.Anything).Return(&http.Response{
+				Body:       ioutil.NopCloser(strings.NewReader(tt.data)),
+				StatusCode: 200,
+			}, nil)
+
+			logLines, err := collector.GetLogs(context.Background(), int64(0), nil)
+			assert.NoError(t, err)
+			_, err = ioutil.ReadAll(logLines)
+			integrity := logLines.Integrity()
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				assert.EqualError(t, integrity.Err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NoError(t, integrity.Err)
+			assert.Equal(t, int64(len(logFileData)), integrity.Bytes)
+			assert.Equal(t, int64(2), integrity.Lines)
+			assert.Equal(t, fmt.Sprintf("%x", sha256.Sum256([]byte(logFileData))), integrity.Sha256)
+		})
+	}
+}
+
+func TestGetLogsDownloadStrategies(t *testing.T) {
+	logFileData := "20200720 16:38:00,ip-172-27-1-97,rdsadmin,localhost,26,1337974,QUERY,mysql,'SELECT 1',0\n20200720 16:38:01,ip-172-27-1-97,rdsadmin,localhost,26,1337976,QUERY,mysql,'SELECT 1',0\n"
+
+	tests := []struct {
+		strategy        DownloadStrategy
+		completeStatus  int
+		completeCalls   int
+		portionDownload bool
+	}{
+		{strategy: DownloadComplete, completeStatus: 200, completeCalls: 1},
+		{strategy: DownloadPortion, portionDownload: true},
+		{strategy: DownloadAuto, completeStatus: 200, completeCalls: 1},
+		{strategy: DownloadAuto, completeStatus: 403, completeCalls: 1, portionDownload: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s-%d", tt.strategy, tt.completeStatus), func(t *testing.T) {
+			rdsClient := new(mockRdsClient)
+			httpClient := new(mockHttpClient)
+			collector := NewRdsLogCollector(rdsClient, httpClient, "eu-central-1", TestRdsInstanceIdentifier, "mysql")
+			collector.DownloadStrategy = tt.strategy
+
+			ddlfInput := &rds.DescribeDBLogFilesInput{
+				DBInstanceIdentifier: aws.String(TestRdsInstanceIdentifier),
+			}
+			rdsClient.On("DescribeDBLogFilesPages", ddlfInput, mock.AnythingOfType("func(*rds.DescribeDBLogFilesOutput, bool) bool")).Return(nil).Run(func(args mock.Arguments) {
+				cb := args.Get(1).(func(*rds.DescribeDBLogFilesOutput, bool) bool)
+				cb(&rds.DescribeDBLogFilesOutput{
+					DescribeDBLogFiles: []*rds.DescribeDBLogFilesDetails{
+						{
+							LastWritten: aws.Int64(1595262837000),
+							LogFileName: aws.String("audit/server_audit.log"),
+							Size:        aws.Int64(901862),
+						},
+						{
+							LastWritten: aws.Int64(1595259824000),
+							LogFileName: aws.String("audit/server_audit.log.1"),
+							Size:        aws.Int64(int64(len(logFileData))),
+						},
+					},
+				}, true)
+			})
+
+			if tt.completeCalls > 0 {
+				httpClient.On("Do", mock.Anything).Return(&http.Response{
+					Body:       ioutil.NopCloser(strings.NewReader(logFileData)),
+					StatusCode: tt.completeStatus,
+				}, nil).Times(tt.completeCalls)
+			}
+			if tt.portionDownload {
+				// The data is returned in two portions
+				rdsClient.On("DownloadDBLogFilePortion", &rds.DownloadDBLogFilePortionInput{
+					DBInstanceIdentifier: aws.String(TestRdsInstanceIdentifier),
+					LogFileName:          aws.String("audit/server_audit.log.1"),
+					Marker:               aws.String("0"),
+				}).Return(&rds.DownloadDBLogFilePortionOutput{
+					LogFileData:           aws.String(logFileData[:100]),
+					Marker:                aws.String("0:100"),
+					AdditionalDataPending: aws.Bool(true),
+				}, nil).Once()
+				rdsClient.On("DownloadDBLogFilePortion", &rds.DownloadDBLogFilePortionInput{
+					DBInstanceIdentifier: aws.String(TestRdsInstanceIdentifier),
+					LogFileName:          aws.String("audit/server_audit.log.1"),
+					Marker:               aws.String("0:100"),
+				}).Return(&rds.DownloadDBLogFilePortionOutput{
+					LogFileData:           aws.String(logFileData[100:]),
+					Marker:                aws.String("0:200"),
+					AdditionalDataPending: aws.Bool(false),
+				}, nil).Once()
+			}
+
+			logLines, err := collector.GetLogs(context.Background(), int64(0), nil)
+			assert.NoError(t, err)
+			logLinesBytes, err := ioutil.ReadAll(logLines)
+			assert.NoError(t, err)
+			assert.Equal(t, logFileData, string(logLinesBytes))
+			assert.Equal(t, fmt.Sprintf("%x", sha256.Sum256([]byte(logFileData))), logLines.Integrity().Sha256)
+
+			rdsClient.AssertExpectations(t)
+			httpClient.AssertExpectations(t)
+		})
+	}
+}
+
+func TestParseDownloadStrategy(t *testing.T) {
+	strategy, err := ParseDownloadStrategy("portion")
+	assert.NoError(t, err)
+	assert.Equal(t, DownloadPortion, strategy)
+
+	_, err = ParseDownloadStrategy("fast")
+	assert.EqualError(t, err, "unknown download strategy fast")
+}
+
+func TestDownloadAutoFallbackIsShared(t *testing.T) {
+	logFile := LogFile{LogFileName: "audit/server_audit.log.1", Size: 10}
+	fallbacks := NewDownloadFallbacks()
+
+	// Every invocation creates a new collector, the failures of the previous ones are kept
+	for i := 0; i < autoFallbackAttempts; i++ {
+		httpClient := new(mockHttpClient)
+		collector := NewRdsLogCollector(new(mockRdsClient), httpClient, "eu-central-1", TestRdsInstanceIdentifier, "mysql")
+		collector.DownloadStrategy = DownloadAuto
+		collector.Fallbacks = fallbacks
+		httpClient.On("Do", mock.Anything).Return(&http.Response{
+			Body:       ioutil.NopCloser(strings.NewReader("")),
+			StatusCode: 403,
+		}, nil).Once()
+
+		_, err := collector.download(context.Background(), logFile)
+		assert.NoError(t, err)
+		httpClient.AssertExpectations(t)
+	}
+
+	httpClient := new(mockHttpClient)
+	collector := NewRdsLogCollector(new(mockRdsClient), httpClient, "eu-central-1", TestRdsInstanceIdentifier, "mysql")
+	collector.DownloadStrategy = DownloadAuto
+	collector.Fallbacks = fallbacks
+	_, err := collector.download(context.Background(), logFile)
+	assert.NoError(t, err)
+	httpClient.AssertNotCalled(t, "Do", mock.Anything)
+}
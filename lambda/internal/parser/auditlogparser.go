@@ -2,10 +2,10 @@ package parser
 
 import (
 	"bufio"
-	"bytes"
 	"fmt"
-	"rdsauditlogss3/internal/entity"
 	"io"
+	"rdsauditlogss3/internal/entity"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -17,53 +17,208 @@ func NewAuditLogParser() *AuditLogParser {
 	return &AuditLogParser{}
 }
 
-func (p *AuditLogParser) ParseEntries(data io.Reader, logFileTimestamp int64) ([]*entity.LogEntry, error) {
-	var entries []*entity.LogEntry
-	var currentEntry *entity.LogEntry
+func (p *AuditLogParser) ParseEntries(data io.Reader, logFileTimestamp int64) EntryReader {
+	records := newAuditRecordReader(data)
+	return newEntryReader(func() (*entity.AuditEvent, error) {
+		for {
+			txt, fields, err := records.read()
+			if err != nil {
+				return nil, err
+			}
+			if txt == "" {
+				continue
+			}
 
-	scanner := bufio.NewScanner(data)
-	for scanner.Scan() {
-		txt := scanner.Text()
-		if txt == "" {
-			continue
-		}
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("could not parse data")
+			}
 
-		record := strings.Split(txt,",")
+			ts, err := parseAuditLogTime(fields[0])
+			if err != nil {
+				return nil, fmt.Errorf("could not parse time: %v", err)
+			}
 
-		if len(record) < 2 {
-			return nil, fmt.Errorf("could not parse data")
+			event := newAuditLogEvent(ts, txt, fields)
+			event.Line = records.recordLine
+			return event, nil
 		}
+	}, logFileTimestamp)
+}
+
+// auditRecordReader splits an audit log into records and their fields. Fields are separated by commas
+// like in RFC 4180 but quoted with single quotes, a quoted field may contain commas and newlines.
+// Quotes within a quoted field are escaped with a backslash by MariaDB or doubled.
+type auditRecordReader struct {
+	data *bufio.Reader
+	// partial takes back a record cut off at the end of the data if the log file is still being written
+	partial PartialDataReader
+	text    []byte
+	// lines is the number of lines read so far, recordLine the number of the first line of the last record
+	lines      int64
+	recordLine int64
+}
 
-		ts, err := time.Parse("20060102 15:04:05", record[0])
+func newAuditRecordReader(data io.Reader) *auditRecordReader {
+	partial, _ := data.(PartialDataReader)
+	return &auditRecordReader{data: bufio.NewReader(data), partial: partial}
+}
+
+// unterminated returns the error for a record which ends within a quoted field
+func (r *auditRecordReader) unterminated() error {
+	if r.partial != nil {
+		// The rest of the record is still being written
+		r.partial.Unread(r.text)
+		return io.EOF
+	}
+	return fmt.Errorf("could not parse data: unterminated quoted field")
+}
+
+// read returns the text of the next record without the trailing newline and its unquoted fields or io.EOF
+func (r *auditRecordReader) read() (string, []string, error) {
+	r.text = r.text[:0]
+	r.recordLine = r.lines + 1
+	var fields []string
+	var field strings.Builder
+	fieldStart := true
+	quoted := false
+
+	for {
+		c, err := r.data.ReadByte()
+		if err == io.EOF {
+			if quoted {
+				return "", nil, r.unterminated()
+			}
+			if len(r.text) == 0 {
+				return "", nil, io.EOF
+			}
+			break
+		}
 		if err != nil {
-			return nil, fmt.Errorf("could not parse time: %v", err)
+			return "", nil, fmt.Errorf("could not read data: %w", err)
 		}
-
-		newTS := entity.LogEntryTimestamp{
-			Year:  ts.Year(),
-			Month: int(ts.Month()),
-			Day:   ts.Day(),
-			Hour:  ts.Hour(),
+		if len(r.text) >= maxRecordSize {
+			return "", nil, fmt.Errorf("could not parse data: record exceeds %d bytes", maxRecordSize)
 		}
 
-		if currentEntry != nil && currentEntry.Timestamp != newTS {
-			entries = append(entries, currentEntry)
-			currentEntry = nil
+		if c == '\n' {
+			r.lines++
+			if !quoted {
+				break
+			}
 		}
+		r.text = append(r.text, c)
 
-		if currentEntry == nil {
-			currentEntry = &entity.LogEntry{
-				Timestamp:        newTS,
-				LogLine:          new(bytes.Buffer),
-				LogFileTimestamp: logFileTimestamp,
+		switch {
+		case quoted && c == '\\':
+			next, err := r.data.ReadByte()
+			if err == io.EOF {
+				return "", nil, r.unterminated()
+			}
+			if err != nil {
+				return "", nil, fmt.Errorf("could not read data: %w", err)
+			}
+			if next == '\n' {
+				r.lines++
 			}
+			r.text = append(r.text, next)
+			field.WriteByte(unescapeAuditLogByte(next))
+		case quoted && c == '\'':
+			next, err := r.data.Peek(1)
+			if err == nil && next[0] == '\'' {
+				// Doubled quote
+				r.text = append(r.text, '\'')
+				field.WriteByte('\'')
+				_, _ = r.data.ReadByte()
+				continue
+			}
+			quoted = false
+		case !quoted && c == '\'' && fieldStart:
+			quoted = true
+		case !quoted && c == ',':
+			fields = append(fields, field.String())
+			field.Reset()
+			fieldStart = true
+			continue
+		default:
+			field.WriteByte(c)
 		}
+		fieldStart = false
+	}
+
+	if n := len(r.text); n > 0 && r.text[n-1] == '\r' {
+		r.text = r.text[:n-1]
+		s := field.String()
+		field.Reset()
+		field.WriteString(strings.TrimSuffix(s, "\r"))
+	}
+	if len(r.text) == 0 {
+		return "", nil, nil
+	}
+	fields = append(fields, field.String())
+	return string(r.text), fields, nil
+}
 
-		currentEntry.LogLine.WriteString(txt)
-		currentEntry.LogLine.WriteString("\n")
+// unescapeAuditLogByte returns the byte escaped with a backslash in a quoted field
+func unescapeAuditLogByte(c byte) byte {
+	switch c {
+	case 'n':
+		return '\n'
+	case 'r':
+		return '\r'
+	case 't':
+		return '\t'
+	default:
+		return c
+	}
+}
+
+// auditLogFields are the fields of an audit log record after the timestamp
+const (
+	auditLogServerHost = iota + 1
+	auditLogUsername
+	auditLogHost
+	auditLogConnectionID
+	auditLogQueryID
+	auditLogOperation
+	auditLogDatabase
+	auditLogObject
+	auditLogRetCode
+)
+
+// newAuditLogEvent creates the audit event of a record. Missing or malformed fields are left empty
+// instead of failing the log file.
+func newAuditLogEvent(ts time.Time, txt string, fields []string) *entity.AuditEvent {
+	field := func(i int) string {
+		if i < len(fields) {
+			return fields[i]
+		}
+		return ""
+	}
+	number := func(i int) int64 {
+		n, _ := strconv.ParseInt(field(i), 10, 64)
+		return n
 	}
 
-	entries = append(entries, currentEntry)
+	return &entity.AuditEvent{
+		Timestamp:    ts,
+		ServerHost:   field(auditLogServerHost),
+		Username:     field(auditLogUsername),
+		Host:         field(auditLogHost),
+		ConnectionID: number(auditLogConnectionID),
+		QueryID:      number(auditLogQueryID),
+		Operation:    field(auditLogOperation),
+		Database:     field(auditLogDatabase),
+		Object:       field(auditLogObject),
+		RetCode:      int(number(auditLogRetCode)),
+		Raw:          txt,
+	}
+}
 
-	return entries, nil
+// parseAuditLogTime parses the timestamp of an audit log record. The MariaDB audit plugin writes
+// the time as "20060102 15:04:05", Aurora MySQL writes microseconds since epoch.
+func parseAuditLogTime(value string) (time.Time, error) {
+	if usec, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(0, usec*int64(time.Microsecond)).UTC(), nil
+	}
+	return time.Parse("20060102 15:04:05", value)
 }
@@ -2,24 +2,94 @@ package parser
 
 import (
 	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
 	"rdsauditlogss3/internal/entity"
 	"strings"
 	"testing"
+	"time"
 )
 
+// readLogEntry is a log entry with its data read
+type readLogEntry struct {
+	Timestamp        entity.LogEntryTimestamp
+	LogLine          string
+	LogFileTimestamp int64
+}
+
+func readEntries(entries EntryReader) ([]readLogEntry, error) {
+	var result []readLogEntry
+	for {
+		entry, err := entries.Next()
+		if err == io.EOF {
+			return result, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		logLine, err := ioutil.ReadAll(entry.LogLine)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, readLogEntry{
+			Timestamp:        entry.Timestamp,
+			LogLine:          string(logLine),
+			LogFileTimestamp: entry.LogFileTimestamp,
+		})
+	}
+}
+
+// readEvents reads the audit events of all entries
+func readEvents(entries EntryReader) ([]entity.AuditEvent, error) {
+	var result []entity.AuditEvent
+	for {
+		entry, err := entries.Next()
+		if err == io.EOF {
+			return result, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for {
+			event, err := entry.Events.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, *event)
+		}
+	}
+}
+
 func TestWriteLogEntrySingleLine(t *testing.T) {
 	parser := NewAuditLogParser()
 
 	logFileTimestamp := int64(1595332052)
 	logLine := "20200714 07:05:25,ip-172-27-1-97,rdsadmin,localhost,26,47141561040897,QUERY,mysql,'SELECT NAME, VALUE FROM mysql.rds_configuration',0"
-	entries, err := parser.ParseEntries(strings.NewReader(logLine), logFileTimestamp)
+	entries, err := readEntries(parser.ParseEntries(strings.NewReader(logLine), logFileTimestamp))
 	assert.NoError(t, err)
 
 	assert.Equal(t, entity.NewLogEntryTimestamp(2020, 7, 14, 7), entries[0].Timestamp)
-	assert.Equal(t, logLine + "\n", entries[0].LogLine.String())
+	assert.Equal(t, logLine + "\n", entries[0].LogLine)
 	assert.Equal(t, logFileTimestamp, entries[0].LogFileTimestamp)
 }
 
+func TestWriteLogEntryAuroraTimestamp(t *testing.T) {
+	parser := NewAuditLogParser()
+
+	logFileTimestamp := int64(1704105000000)
+	logLine := "1704104999123456,ip-172-27-1-97,admin,10.120.182.212,33303,161152,QUERY,rdslogstest,'select @@version_comment limit 1',0"
+	entries, err := readEntries(parser.ParseEntries(strings.NewReader(logLine), logFileTimestamp))
+	assert.NoError(t, err)
+
+	assert.Equal(t, entity.NewLogEntryTimestamp(2024, 1, 1, 10), entries[0].Timestamp)
+	assert.Equal(t, logLine + "\n", entries[0].LogLine)
+}
+
 func TestWriteLogEntryMultiLine(t *testing.T) {
 	parser := NewAuditLogParser()
 
@@ -51,11 +121,179 @@ func TestWriteLogEntryMultiLine(t *testing.T) {
 20200714 12:30:03,ip-172-27-1-97,rdsadmin,localhost,26,161171,QUERY,mysql,'SELECT 1',0
 `
 
-	entries, err := parser.ParseEntries(strings.NewReader(logLine), logFileTimestamp)
+	entries, err := readEntries(parser.ParseEntries(strings.NewReader(logLine), logFileTimestamp))
 	assert.NoError(t, err)
 	assert.Equal(t, entity.NewLogEntryTimestamp(2020, 7, 14, 10), entries[0].Timestamp)
 	assert.Equal(t, logFileTimestamp, entries[0].LogFileTimestamp)
 	assert.Len(t, entries, 3)
 
-	assert.Equal(t, "20200714 12:30:03,ip-172-27-1-97,rdsadmin,localhost,26,161171,QUERY,mysql,'SELECT 1',0" + "\n", entries[2].LogLine.String())
-}
\ No newline at end of file
+	assert.Equal(t, "20200714 12:30:03,ip-172-27-1-97,rdsadmin,localhost,26,161171,QUERY,mysql,'SELECT 1',0" + "\n", entries[2].LogLine)
+}
+
+func TestParseEntriesSkipUnreadEntry(t *testing.T) {
+	parser := NewAuditLogParser()
+
+	logLine := `20200714 10:30:02,ip-172-27-1-97,admin,10.120.182.212,33303,0,CONNECT,rdslogstest,,0
+20200714 10:30:03,ip-172-27-1-97,rdsadmin,localhost,26,161155,QUERY,mysql,'SELECT 1',0
+20200714 11:30:04,ip-172-27-1-97,admin,10.120.182.212,33304,0,CONNECT,rdslogstest,,0
+`
+	entries := parser.ParseEntries(strings.NewReader(logLine), int64(1))
+
+	first, err := entries.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, entity.NewLogEntryTimestamp(2020, 7, 14, 10), first.Timestamp)
+
+	second, err := entries.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, entity.NewLogEntryTimestamp(2020, 7, 14, 11), second.Timestamp)
+	secondLogLine, err := ioutil.ReadAll(second.LogLine)
+	assert.NoError(t, err)
+	assert.Equal(t, "20200714 11:30:04,ip-172-27-1-97,admin,10.120.182.212,33304,0,CONNECT,rdslogstest,,0\n", string(secondLogLine))
+
+	_, err = entries.Next()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestParseEntriesInvalidTime(t *testing.T) {
+	parser := NewAuditLogParser()
+
+	_, err := readEntries(parser.ParseEntries(strings.NewReader("2020-07-14 10:30:02,ip-172-27-1-97,admin\n"), int64(1)))
+	assert.Error(t, err)
+}
+
+func TestParseEntriesMultiLineQuery(t *testing.T) {
+	parser := NewAuditLogParser()
+
+	query := "20200714 10:59:59,ip-172-27-1-97,admin,10.120.182.212,33303,161152,QUERY,rdslogstest,'SELECT id,\n  name\nFROM users\nWHERE name = \\'O\\'\\'Brien, Jr.\\'',0"
+	logLine := query + "\n" +
+		"20200714 11:00:00,ip-172-27-1-97,admin,10.120.182.212,33303,161153,QUERY,rdslogstest,'SELECT ''a,\nb''',0\n"
+
+	entries, err := readEntries(parser.ParseEntries(strings.NewReader(logLine), int64(1)))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, entity.NewLogEntryTimestamp(2020, 7, 14, 10), entries[0].Timestamp)
+	assert.Equal(t, query+"\n", entries[0].LogLine)
+	assert.Equal(t, entity.NewLogEntryTimestamp(2020, 7, 14, 11), entries[1].Timestamp)
+	assert.Equal(t, "20200714 11:00:00,ip-172-27-1-97,admin,10.120.182.212,33303,161153,QUERY,rdslogstest,'SELECT ''a,\nb''',0\n", entries[1].LogLine)
+}
+
+func TestAuditRecordReaderFields(t *testing.T) {
+	records := newAuditRecordReader(strings.NewReader("20200714 10:30:02,host,admin,10.0.0.1,1,2,QUERY,db,'SELECT \\'a,\nb\\', ''c'', \\\\',0\r\n\n20200714 10:30:03,host,admin,10.0.0.1,1,0,CONNECT,db,,0"))
+
+	txt, fields, err := records.read()
+	assert.NoError(t, err)
+	assert.Equal(t, "20200714 10:30:02,host,admin,10.0.0.1,1,2,QUERY,db,'SELECT \\'a,\nb\\', ''c'', \\\\',0", txt)
+	assert.Equal(t, []string{"20200714 10:30:02", "host", "admin", "10.0.0.1", "1", "2", "QUERY", "db", "SELECT 'a,\nb', 'c', \\", "0"}, fields)
+
+	txt, _, err = records.read()
+	assert.NoError(t, err)
+	assert.Equal(t, "", txt)
+
+	_, fields, err = records.read()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"20200714 10:30:03", "host", "admin", "10.0.0.1", "1", "0", "CONNECT", "db", "", "0"}, fields)
+
+	_, _, err = records.read()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestAuditRecordReaderEscapedNewline(t *testing.T) {
+	records := newAuditRecordReader(strings.NewReader("20200714 10:30:02,host,admin,10.0.0.1,1,2,QUERY,db,'SELECT \\\n1',0\n" +
+		"20200714 10:30:03,host,admin,10.0.0.1,1,0,DISCONNECT,db,,0\n"))
+
+	_, fields, err := records.read()
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT \n1", fields[8])
+	assert.Equal(t, int64(1), records.recordLine)
+
+	// The escaped newline is counted as a line of the first record
+	_, _, err = records.read()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), records.recordLine)
+}
+
+func TestParseEntriesUnterminatedQuote(t *testing.T) {
+	parser := NewAuditLogParser()
+
+	_, err := readEntries(parser.ParseEntries(strings.NewReader("20200714 10:30:02,ip-172-27-1-97,admin,10.120.182.212,33303,161152,QUERY,rdslogstest,'SELECT 1,0\n"), int64(1)))
+	assert.EqualError(t, err, "could not parse data: unterminated quoted field")
+}
+
+// unreadingReader records the data handed back by the parser
+type unreadingReader struct {
+	io.Reader
+	unread []byte
+}
+
+func (r *unreadingReader) Unread(data []byte) {
+	r.unread = append(data, r.unread...)
+}
+
+func TestParseEntriesUnterminatedQuotePartialData(t *testing.T) {
+	parser := NewAuditLogParser()
+
+	logLine := "20200714 10:30:01,ip-172-27-1-97,admin,10.120.182.212,33303,161151,QUERY,rdslogstest,'SELECT 1',0\n"
+	partialRecord := "20200714 10:30:02,ip-172-27-1-97,admin,10.120.182.212,33303,161152,QUERY,rdslogstest,'SELECT\n1"
+	data := &unreadingReader{Reader: strings.NewReader(logLine + partialRecord)}
+
+	entries, err := readEntries(parser.ParseEntries(data, int64(1)))
+	assert.NoError(t, err)
+	assert.Equal(t, []readLogEntry{
+		{
+			Timestamp:        entity.NewLogEntryTimestamp(2020, 7, 14, 10),
+			LogLine:          logLine,
+			LogFileTimestamp: 1,
+		},
+	}, entries)
+	assert.Equal(t, partialRecord, string(data.unread))
+}
+
+func TestParseEntriesEvents(t *testing.T) {
+	parser := NewAuditLogParser()
+
+	logLine := `20200714 10:30:02,ip-172-27-1-97,admin,10.120.182.212,33303,0,CONNECT,rdslogstest,,0
+20200714 11:30:03,ip-172-27-1-97,admin,10.120.182.212,33303,161152,QUERY,rdslogstest,'SELECT \'a,
+b\'',1064
+20200714 11:30:04,ip-172-27-1-97,admin,10.120.182.212,33303,0,DISCONNECT,rdslogstest,,0
+`
+	events, err := readEvents(parser.ParseEntries(strings.NewReader(logLine), int64(1)))
+	assert.NoError(t, err)
+	assert.Equal(t, []entity.AuditEvent{
+		{
+			Timestamp:    time.Date(2020, 7, 14, 10, 30, 2, 0, time.UTC),
+			ServerHost:   "ip-172-27-1-97",
+			Username:     "admin",
+			Host:         "10.120.182.212",
+			ConnectionID: 33303,
+			Operation:    entity.OperationConnect,
+			Database:     "rdslogstest",
+			Raw:          "20200714 10:30:02,ip-172-27-1-97,admin,10.120.182.212,33303,0,CONNECT,rdslogstest,,0",
+			Line:         1,
+		},
+		{
+			Timestamp:    time.Date(2020, 7, 14, 11, 30, 3, 0, time.UTC),
+			ServerHost:   "ip-172-27-1-97",
+			Username:     "admin",
+			Host:         "10.120.182.212",
+			ConnectionID: 33303,
+			QueryID:      161152,
+			Operation:    entity.OperationQuery,
+			Database:     "rdslogstest",
+			Object:       "SELECT 'a,\nb'",
+			RetCode:      1064,
+			Raw:          "20200714 11:30:03,ip-172-27-1-97,admin,10.120.182.212,33303,161152,QUERY,rdslogstest,'SELECT \\'a,\nb\\'',1064",
+			Line:         2,
+		},
+		{
+			Timestamp:    time.Date(2020, 7, 14, 11, 30, 4, 0, time.UTC),
+			ServerHost:   "ip-172-27-1-97",
+			Username:     "admin",
+			Host:         "10.120.182.212",
+			ConnectionID: 33303,
+			Operation:    entity.OperationDisconnect,
+			Database:     "rdslogstest",
+			Raw:          "20200714 11:30:04,ip-172-27-1-97,admin,10.120.182.212,33303,0,DISCONNECT,rdslogstest,,0",
+			Line:         4,
+		},
+	}, events)
+}
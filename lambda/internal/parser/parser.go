@@ -1,10 +1,176 @@
 package parser
 
 import (
-	"rdsauditlogss3/internal/entity"
 	"io"
+	"io/ioutil"
+	"rdsauditlogss3/internal/entity"
+	"time"
 )
 
+// maxRecordSize is the maximum size of a single log line
+const maxRecordSize = 16 * 1024 * 1024
+
 type Parser interface {
-	ParseEntries(data io.Reader, logFileTimestamp int64) ([]*entity.LogEntry, error)
-}
\ No newline at end of file
+	ParseEntries(data io.Reader, logFileTimestamp int64) EntryReader
+}
+
+// PartialDataReader is implemented by readers of a log file which is still being written. A parser hands a record
+// which is cut off at the end of the data back with Unread instead of failing, so it is parsed once it is complete.
+type PartialDataReader interface {
+	io.Reader
+	// Unread returns the data of an incomplete record at the end of the reader
+	Unread(data []byte)
+}
+
+// Parsers maps db types to the parser for their audit log format
+type Parsers map[string]Parser
+
+// EntryReader returns the log entries of a log file one after another while the log file is read
+type EntryReader interface {
+	// Next returns the next log entry. The LogLine of the previous entry can't be read anymore afterwards.
+	// io.EOF is returned if there are no more entries.
+	Next() (*entity.LogEntry, error)
+}
+
+// recordSource returns the next record of a log file or io.EOF, the raw text of a record may span several lines
+type recordSource func() (*entity.AuditEvent, error)
+
+// entryReader groups consecutive records of the same hour into log entries.
+// Only a single record is held in memory, the LogLine and Events of an entry read the records from the source on demand.
+type entryReader struct {
+	source           recordSource
+	logFileTimestamp int64
+	pending          *entity.AuditEvent
+	current          *entryLineReader
+	err              error
+}
+
+func newEntryReader(source recordSource, logFileTimestamp int64) *entryReader {
+	return &entryReader{
+		source:           source,
+		logFileTimestamp: logFileTimestamp,
+	}
+}
+
+func (r *entryReader) Next() (*entity.LogEntry, error) {
+	if r.current != nil {
+		// Skip whatever has not been read from the previous entry
+		_, err := io.Copy(ioutil.Discard, r.current)
+		if err != nil {
+			return nil, err
+		}
+		r.current = nil
+	}
+
+	err := r.fill()
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp := newLogEntryTimestamp(r.pending.Timestamp)
+	r.current = &entryLineReader{
+		entries:   r,
+		timestamp: timestamp,
+	}
+
+	return &entity.LogEntry{
+		Timestamp:        timestamp,
+		LogLine:          r.current,
+		Events:           &entryEventReader{entries: r, timestamp: timestamp},
+		LogFileTimestamp: r.logFileTimestamp,
+		FirstRecordTime:  r.pending.Timestamp,
+	}, nil
+}
+
+// fill makes sure there is a pending record
+func (r *entryReader) fill() error {
+	if r.err != nil {
+		return r.err
+	}
+	if r.pending != nil {
+		return nil
+	}
+
+	event, err := r.source()
+	if err != nil {
+		r.err = err
+		return err
+	}
+	r.pending = event
+	return nil
+}
+
+// next returns the pending record if it belongs to the hour of timestamp, otherwise io.EOF
+func (r *entryReader) next(timestamp entity.LogEntryTimestamp) (*entity.AuditEvent, error) {
+	err := r.fill()
+	if err != nil {
+		return nil, err
+	}
+	if newLogEntryTimestamp(r.pending.Timestamp) != timestamp {
+		return nil, io.EOF
+	}
+
+	event := r.pending
+	r.pending = nil
+	return event, nil
+}
+
+// entryLineReader reads the lines of all records belonging to the hour of a log entry
+type entryLineReader struct {
+	entries   *entryReader
+	timestamp entity.LogEntryTimestamp
+	buf       []byte
+	done      bool
+}
+
+func (l *entryLineReader) Read(p []byte) (int, error) {
+	for len(l.buf) == 0 {
+		if l.done {
+			return 0, io.EOF
+		}
+
+		event, err := l.entries.next(l.timestamp)
+		if err == io.EOF {
+			l.done = true
+			return 0, io.EOF
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		l.buf = append(l.buf[:0], event.Raw...)
+		l.buf = append(l.buf, '\n')
+	}
+
+	n := copy(p, l.buf)
+	l.buf = l.buf[n:]
+	return n, nil
+}
+
+// entryEventReader reads the audit events of all records belonging to the hour of a log entry
+type entryEventReader struct {
+	entries   *entryReader
+	timestamp entity.LogEntryTimestamp
+	done      bool
+}
+
+func (e *entryEventReader) Next() (*entity.AuditEvent, error) {
+	if e.done {
+		return nil, io.EOF
+	}
+
+	event, err := e.entries.next(e.timestamp)
+	if err == io.EOF {
+		e.done = true
+	}
+	return event, err
+}
+
+func newLogEntryTimestamp(ts time.Time) entity.LogEntryTimestamp {
+	return entity.LogEntryTimestamp{
+		Year:  ts.Year(),
+		Month: int(ts.Month()),
+		Day:   ts.Day(),
+		Hour:  ts.Hour(),
+	}
+}
@@ -0,0 +1,293 @@
+package parser
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"rdsauditlogss3/internal/entity"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultPgLogLinePrefix is the log_line_prefix used by RDS for PostgreSQL
+const DefaultPgLogLinePrefix = "%t:%r:%u@%d:[%p]:"
+
+// DefaultPgLogTimezone is the log_timezone used by RDS for PostgreSQL
+const DefaultPgLogTimezone = "UTC"
+
+// pgAuditMessagePrefixes are the beginnings of log messages written by pgaudit
+var pgAuditMessagePrefixes = []string{"AUDIT: SESSION,", "AUDIT: OBJECT,"}
+
+// PgAuditParser extracts pgaudit records from the PostgreSQL server log
+type PgAuditParser struct {
+	logLine    *regexp.Regexp
+	timeEscape byte
+	// location is the log_timezone, it resolves the zone abbreviations of %t and %m
+	location     *time.Location
+	timeIndex    int
+	messageIndex int
+	// Indexes of the optional submatches of the log_line_prefix, 0 if the escape is not used
+	userIndex     int
+	databaseIndex int
+	hostIndex     int
+	pidIndex      int
+}
+
+func NewPgAuditParser(logLinePrefix string, logTimezone string) (*PgAuditParser, error) {
+	logLine, timeEscape, err := compileLogLinePrefix(logLinePrefix)
+	if err != nil {
+		return nil, fmt.Errorf("could not compile log_line_prefix %q: %v", logLinePrefix, err)
+	}
+
+	location, err := time.LoadLocation(logTimezone)
+	if err != nil {
+		return nil, fmt.Errorf("could not load log_timezone %q: %v", logTimezone, err)
+	}
+
+	p := &PgAuditParser{
+		logLine:    logLine,
+		timeEscape: timeEscape,
+		location:   location,
+	}
+	for i, name := range logLine.SubexpNames() {
+		switch name {
+		case "time":
+			p.timeIndex = i
+		case "message":
+			p.messageIndex = i
+		case "user":
+			p.userIndex = i
+		case "database":
+			p.databaseIndex = i
+		case "host":
+			p.hostIndex = i
+		case "pid":
+			p.pidIndex = i
+		}
+	}
+
+	return p, nil
+}
+
+func (p *PgAuditParser) ParseEntries(data io.Reader, logFileTimestamp int64) EntryReader {
+	scanner := bufio.NewScanner(data)
+	scanner.Buffer(make([]byte, bufio.MaxScanTokenSize), maxRecordSize)
+
+	// Statements can span multiple lines, lines without log_line_prefix belong to the previous record.
+	// The first line of the following record is kept until the next call.
+	var nextLine *string
+	var lines int64
+
+	return newEntryReader(func() (*entity.AuditEvent, error) {
+		for {
+			if nextLine == nil {
+				if !scanner.Scan() {
+					if err := scanner.Err(); err != nil {
+						return nil, fmt.Errorf("could not read data: %w", err)
+					}
+					return nil, io.EOF
+				}
+				lines++
+				txt := scanner.Text()
+				nextLine = &txt
+			}
+
+			match := p.logLine.FindStringSubmatch(*nextLine)
+			if match == nil {
+				// Continuation line of a skipped record
+				nextLine = nil
+				continue
+			}
+
+			ts, err := p.parseTime(match[p.timeIndex])
+			if err != nil {
+				return nil, fmt.Errorf("could not parse time: %v", err)
+			}
+
+			// The message is at the end of the first line and continues on the following lines
+			messageStart := len(*nextLine) - len(match[p.messageIndex])
+
+			var text strings.Builder
+			text.WriteString(*nextLine)
+			nextLine = nil
+			line := lines
+
+			for scanner.Scan() {
+				lines++
+				txt := scanner.Text()
+				if p.logLine.MatchString(txt) {
+					nextLine = &txt
+					break
+				}
+				text.WriteString("\n")
+				text.WriteString(txt)
+			}
+			if err := scanner.Err(); err != nil {
+				return nil, fmt.Errorf("could not read data: %w", err)
+			}
+
+			if isPgAuditMessage(match[p.messageIndex]) {
+				event := p.newAuditEvent(ts, match, text.String(), messageStart)
+				event.Line = line
+				return event, nil
+			}
+		}
+	}, logFileTimestamp)
+}
+
+// newAuditEvent creates the audit event of a pgaudit record from the submatches of its log_line_prefix and its message:
+// AUDIT: <type>,<statement id>,<substatement id>,<class>,<command>,<object type>,<object name>,<statement>,<parameter>
+func (p *PgAuditParser) newAuditEvent(ts time.Time, match []string, txt string, messageStart int) *entity.AuditEvent {
+	submatch := func(i int) string {
+		if i == 0 {
+			return ""
+		}
+		return match[i]
+	}
+
+	event := &entity.AuditEvent{
+		Timestamp: ts,
+		Username:  submatch(p.userIndex),
+		Database:  submatch(p.databaseIndex),
+		Host:      strings.SplitN(submatch(p.hostIndex), "(", 2)[0],
+		Raw:       txt,
+	}
+	event.ConnectionID, _ = strconv.ParseInt(submatch(p.pidIndex), 10, 64)
+
+	message := csv.NewReader(strings.NewReader(strings.TrimPrefix(txt[messageStart:], "AUDIT: ")))
+	message.FieldsPerRecord = -1
+	message.LazyQuotes = true
+	fields, err := message.Read()
+	if err != nil || len(fields) < 8 {
+		// Keep the record, the raw text is still available
+		return event
+	}
+	event.QueryID, _ = strconv.ParseInt(fields[1], 10, 64)
+	event.Operation = pgAuditOperation(fields[3])
+	event.Object = fields[7]
+	return event
+}
+
+// pgAuditOperation returns the operation of the audit event of a statement of a pgaudit class,
+// pgaudit logs statements, so all classes map to query operations
+func pgAuditOperation(class string) string {
+	switch class {
+	case "READ":
+		return entity.OperationQueryDML
+	case "WRITE":
+		return entity.OperationQueryDMLNoSelect
+	case "DDL":
+		return entity.OperationQueryDDL
+	case "ROLE":
+		return entity.OperationQueryDCL
+	default:
+		return entity.OperationQuery
+	}
+}
+
+func (p *PgAuditParser) parseTime(value string) (time.Time, error) {
+	switch p.timeEscape {
+	case 'm':
+		return p.parseTimeInLocation("2006-01-02 15:04:05.000 MST", value)
+	case 'n':
+		seconds, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(0, int64(seconds*float64(time.Second))).UTC(), nil
+	default:
+		return p.parseTimeInLocation("2006-01-02 15:04:05 MST", value)
+	}
+}
+
+// parseTimeInLocation parses a time with a zone abbreviation of the log_timezone.
+// Abbreviations unknown to the log_timezone would be parsed with a zero offset, so they are rejected.
+func (p *PgAuditParser) parseTimeInLocation(layout string, value string) (time.Time, error) {
+	ts, err := time.ParseInLocation(layout, value, p.location)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if zone, _ := ts.Zone(); ts.Location() != p.location && zone != "UTC" && zone != "GMT" {
+		return time.Time{}, fmt.Errorf("time zone %s of %q is not known in log_timezone %s", zone, value, p.location)
+	}
+	return ts.UTC(), nil
+}
+
+func isPgAuditMessage(message string) bool {
+	for _, prefix := range pgAuditMessagePrefixes {
+		if strings.HasPrefix(message, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// logLinePrefixSubmatches names the submatches of the log_line_prefix escapes which are part of audit events
+var logLinePrefixSubmatches = map[byte]string{
+	'u': "user",
+	'd': "database",
+	'r': "host",
+	'h': "host",
+	'p': "pid",
+}
+
+// compileLogLinePrefix converts a PostgreSQL log_line_prefix into a regular expression matching the beginning of a log record.
+// It returns the escape (t, m or n) of the timestamp used by the log_line_prefix.
+func compileLogLinePrefix(logLinePrefix string) (*regexp.Regexp, byte, error) {
+	var expr strings.Builder
+	var timeEscape byte
+
+	expr.WriteString("^")
+	for i := 0; i < len(logLinePrefix); i++ {
+		c := logLinePrefix[i]
+		if c != '%' || i+1 == len(logLinePrefix) {
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+			continue
+		}
+
+		i++
+		escape := logLinePrefix[i]
+		switch escape {
+		case 't', 'm', 'n':
+			if timeEscape != 0 {
+				expr.WriteString(`.*?`)
+				continue
+			}
+			timeEscape = escape
+			switch escape {
+			case 't':
+				expr.WriteString(`(?P<time>\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2} [A-Za-z0-9+-]+)`)
+			case 'm':
+				expr.WriteString(`(?P<time>\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}\.\d{3} [A-Za-z0-9+-]+)`)
+			case 'n':
+				expr.WriteString(`(?P<time>\d+\.\d{3})`)
+			}
+		case 'u', 'd', 'r', 'h', 'p':
+			name := logLinePrefixSubmatches[escape]
+			if strings.Contains(expr.String(), "(?P<"+name+">") {
+				expr.WriteString(`.*?`)
+				continue
+			}
+			expr.WriteString(`(?P<` + name + `>.*?)`)
+		case '%':
+			expr.WriteString(`%`)
+		default:
+			expr.WriteString(`.*?`)
+		}
+	}
+	expr.WriteString(`[A-Z]+:\s+(?P<message>.*)$`)
+
+	if timeEscape == 0 {
+		return nil, 0, fmt.Errorf("log_line_prefix must contain %%t, %%m or %%n")
+	}
+
+	logLine, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return logLine, timeEscape, nil
+}
@@ -0,0 +1,118 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"rdsauditlogss3/internal/entity"
+)
+
+func TestPgAuditParseEntries(t *testing.T) {
+	parser, err := NewPgAuditParser(DefaultPgLogLinePrefix, DefaultPgLogTimezone)
+	assert.NoError(t, err)
+
+	logFileTimestamp := int64(1704110400000)
+	logData := `2024-01-01 10:59:58 UTC::@:[5678]:LOG:  checkpoint starting: time
+2024-01-01 10:59:59 UTC:10.0.0.1(52314):admin@app:[1234]:LOG:  AUDIT: SESSION,1,1,READ,SELECT,,,select 1,<not logged>
+2024-01-01 11:00:01 UTC:10.0.0.1(52314):admin@app:[1234]:LOG:  AUDIT: SESSION,2,1,WRITE,UPDATE,,,"update users
+	set name = 'x'
+	where id = 1",<not logged>
+2024-01-01 11:00:01 UTC:10.0.0.1(52314):admin@app:[1234]:LOG:  AUDIT: OBJECT,3,1,READ,SELECT,TABLE,public.users,select * from users,<not logged>
+2024-01-01 11:00:02 UTC:10.0.0.1(52314):admin@app:[1234]:ERROR:  relation "foo" does not exist at character 15
+2024-01-01 11:00:02 UTC:10.0.0.1(52314):admin@app:[1234]:STATEMENT:  select * from foo
+`
+	entries, err := readEntries(parser.ParseEntries(strings.NewReader(logData), logFileTimestamp))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	assert.Equal(t, entity.NewLogEntryTimestamp(2024, 1, 1, 10), entries[0].Timestamp)
+	assert.Equal(t, logFileTimestamp, entries[0].LogFileTimestamp)
+	assert.Equal(t, "2024-01-01 10:59:59 UTC:10.0.0.1(52314):admin@app:[1234]:LOG:  AUDIT: SESSION,1,1,READ,SELECT,,,select 1,<not logged>\n", entries[0].LogLine)
+
+	assert.Equal(t, entity.NewLogEntryTimestamp(2024, 1, 1, 11), entries[1].Timestamp)
+	assert.Equal(t, `2024-01-01 11:00:01 UTC:10.0.0.1(52314):admin@app:[1234]:LOG:  AUDIT: SESSION,2,1,WRITE,UPDATE,,,"update users
+	set name = 'x'
+	where id = 1",<not logged>
+2024-01-01 11:00:01 UTC:10.0.0.1(52314):admin@app:[1234]:LOG:  AUDIT: OBJECT,3,1,READ,SELECT,TABLE,public.users,select * from users,<not logged>
+`, entries[1].LogLine)
+}
+
+func TestPgAuditParseEntriesCustomPrefix(t *testing.T) {
+	parser, err := NewPgAuditParser("%m [%p] %q%u@%d ", DefaultPgLogTimezone)
+	assert.NoError(t, err)
+
+	logData := "2024-01-01 10:30:00.123 UTC [1234] admin@app LOG:  AUDIT: SESSION,1,1,DDL,CREATE TABLE,,,create table t (id int),<not logged>\n"
+	entries, err := readEntries(parser.ParseEntries(strings.NewReader(logData), int64(1)))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, entity.NewLogEntryTimestamp(2024, 1, 1, 10), entries[0].Timestamp)
+	assert.Equal(t, logData, entries[0].LogLine)
+}
+
+func TestPgAuditParseEntriesLogTimezone(t *testing.T) {
+	parser, err := NewPgAuditParser(DefaultPgLogLinePrefix, "Europe/Berlin")
+	assert.NoError(t, err)
+
+	logData := `2024-01-01 00:30:00 CET:10.0.0.1(52314):admin@app:[1234]:LOG:  AUDIT: SESSION,1,1,READ,SELECT,,,select 1,<not logged>
+2024-07-01 12:30:00 CEST:10.0.0.1(52314):admin@app:[1234]:LOG:  AUDIT: SESSION,2,1,READ,SELECT,,,select 2,<not logged>
+`
+	events, err := readEvents(parser.ParseEntries(strings.NewReader(logData), int64(1)))
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+	assert.Equal(t, time.Date(2023, 12, 31, 23, 30, 0, 0, time.UTC), events[0].Timestamp)
+	assert.Equal(t, time.Date(2024, 7, 1, 10, 30, 0, 0, time.UTC), events[1].Timestamp)
+}
+
+func TestPgAuditParseEntriesUnknownTimezone(t *testing.T) {
+	parser, err := NewPgAuditParser(DefaultPgLogLinePrefix, DefaultPgLogTimezone)
+	assert.NoError(t, err)
+
+	logData := "2024-01-01 00:30:00 CET:10.0.0.1(52314):admin@app:[1234]:LOG:  AUDIT: SESSION,1,1,READ,SELECT,,,select 1,<not logged>\n"
+	_, err = readEntries(parser.ParseEntries(strings.NewReader(logData), int64(1)))
+	assert.Error(t, err)
+}
+
+func TestNewPgAuditParserInvalidTimezone(t *testing.T) {
+	_, err := NewPgAuditParser(DefaultPgLogLinePrefix, "Europe/Nowhere")
+	assert.Error(t, err)
+}
+
+func TestPgAuditParseEntriesNoAuditRecords(t *testing.T) {
+	parser, err := NewPgAuditParser(DefaultPgLogLinePrefix, DefaultPgLogTimezone)
+	assert.NoError(t, err)
+
+	entries, err := readEntries(parser.ParseEntries(strings.NewReader("2024-01-01 10:59:58 UTC::@:[5678]:LOG:  checkpoint starting: time\n"), int64(1)))
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestNewPgAuditParserWithoutTime(t *testing.T) {
+	_, err := NewPgAuditParser("%u@%d:[%p]:", DefaultPgLogTimezone)
+	assert.Error(t, err)
+}
+
+func TestPgAuditParseEntriesEvents(t *testing.T) {
+	parser, err := NewPgAuditParser(DefaultPgLogLinePrefix, DefaultPgLogTimezone)
+	assert.NoError(t, err)
+
+	record := `2024-01-01 11:00:01 UTC:10.0.0.1(52314):admin@app:[1234]:LOG:  AUDIT: SESSION,2,1,WRITE,UPDATE,,,"update users
+	set name = 'x, y'
+	where id = 1",<not logged>`
+	logData := "2024-01-01 10:59:58 UTC::@:[5678]:LOG:  checkpoint starting: time\n" + record + "\n"
+	events, err := readEvents(parser.ParseEntries(strings.NewReader(logData), int64(1)))
+	assert.NoError(t, err)
+	assert.Equal(t, []entity.AuditEvent{{
+		Timestamp:    time.Date(2024, 1, 1, 11, 0, 1, 0, time.UTC),
+		Username:     "admin",
+		Host:         "10.0.0.1",
+		ConnectionID: 1234,
+		QueryID:      2,
+		Operation:    entity.OperationQueryDMLNoSelect,
+		Database:     "app",
+		Object:       "update users\n\tset name = 'x, y'\n\twhere id = 1",
+		Raw:          record,
+		Line:         2,
+	}}, events)
+}
@@ -0,0 +1,87 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+	"rdsauditlogss3/internal/database"
+	"rdsauditlogss3/internal/logcollector"
+)
+
+// LogProcessor processes the audit logs of one or more RDS instances.
+// The status tells if processing stopped before the deadline of ctx, it is StatusFailed if an error is returned.
+type LogProcessor interface {
+	Process(ctx context.Context) (Status, error)
+}
+
+// GroupProcessor processes the audit logs of a group of RDS instances
+type GroupProcessor interface {
+	LogProcessor
+	// ProcessInstances only processes the given members of the group, eg. the instances continued from the previous
+	// invocation. Instances which are not members anymore are ignored.
+	ProcessInstances(ctx context.Context, rdsInstanceIdentifiers []string) (Status, error)
+}
+
+// InstanceProcessorFactory creates the processor for a single RDS instance
+type InstanceProcessorFactory func(rdsInstanceIdentifier string) LogProcessor
+
+// ClusterProcessor processes the audit logs of all instances of an Aurora cluster
+type ClusterProcessor struct {
+	database             database.Database
+	members              logcollector.ClusterMemberLister
+	newInstanceProcessor InstanceProcessorFactory
+	concurrency          int
+	ClusterIdentifier    string
+}
+
+func NewClusterProcessor(db database.Database, members logcollector.ClusterMemberLister, newInstanceProcessor InstanceProcessorFactory, concurrency int, clusterIdentifier string) *ClusterProcessor {
+	return &ClusterProcessor{
+		database:             db,
+		members:              members,
+		newInstanceProcessor: newInstanceProcessor,
+		concurrency:          concurrency,
+		ClusterIdentifier:    clusterIdentifier,
+	}
+}
+
+func (c *ClusterProcessor) Process(ctx context.Context) (Status, error) {
+	return c.process(ctx, nil)
+}
+
+func (c *ClusterProcessor) ProcessInstances(ctx context.Context, rdsInstanceIdentifiers []string) (Status, error) {
+	return c.process(ctx, rdsInstanceIdentifiers)
+}
+
+// process processes the given cluster members or all of them if selected is nil
+func (c *ClusterProcessor) process(ctx context.Context, selected []string) (Status, error) {
+	members, err := c.members.ListClusterMembers(ctx)
+	if err != nil {
+		return StatusFailed, fmt.Errorf("error listing cluster members: %v", err)
+	}
+
+	var currentMembers []string
+	for _, m := range members {
+		logrus.WithFields(logrus.Fields{"cluster": c.ClusterIdentifier, "instance": m.InstanceIdentifier, "writer": m.IsWriter}).Debug("Found cluster member")
+		currentMembers = append(currentMembers, m.InstanceIdentifier)
+	}
+	sort.Strings(currentMembers)
+
+	if selected == nil {
+		// Compare with the members known from the previous run
+		id := fmt.Sprintf("%s:%s", c.ClusterIdentifier, "members")
+		err = updateMembership(ctx, c.database, id, currentMembers, logrus.Fields{"cluster": c.ClusterIdentifier})
+		if err != nil {
+			return StatusFailed, fmt.Errorf("could not update cluster members: %v", err)
+		}
+	} else {
+		currentMembers = selectInstances(currentMembers, selected)
+	}
+
+	// Process the logs of every member, a failing member does not stop the others
+	summary := processInstances(ctx, c.newInstanceProcessor, c.concurrency, currentMembers)
+	summary.Log()
+
+	return summary.Status(), summary.Err()
+}
@@ -0,0 +1,148 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"rdsauditlogss3/internal/entity"
+	"rdsauditlogss3/internal/logcollector"
+)
+
+const (
+	TestClusterIdentifier = "my-cluster"
+)
+
+func (m *mockDatabase) StoreMembership(ctx context.Context, record *entity.MembershipRecord) error {
+	args := m.Called(record)
+	return args.Error(0)
+}
+
+func (m *mockDatabase) GetMembership(ctx context.Context, id string) (*entity.MembershipRecord, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*entity.MembershipRecord), args.Error(1)
+}
+
+type mockClusterMemberLister struct {
+	mock.Mock
+}
+
+func (m *mockClusterMemberLister) ListClusterMembers(ctx context.Context) ([]logcollector.ClusterMember, error) {
+	args := m.Called()
+	return args.Get(0).([]logcollector.ClusterMember), args.Error(1)
+}
+
+type mockLogProcessor struct {
+	mock.Mock
+}
+
+func (m *mockLogProcessor) Process(ctx context.Context) (Status, error) {
+	args := m.Called()
+	return args.Get(0).(Status), args.Error(1)
+}
+
+func TestClusterProcessMembersChanged(t *testing.T) {
+	db := new(mockDatabase)
+	members := new(mockClusterMemberLister)
+
+	id := fmt.Sprintf("%s:%s", TestClusterIdentifier, "members")
+	db.On("GetMembership", id).Return(&entity.MembershipRecord{
+		Id:      id,
+		Members: []string{"my-instance-1", "my-instance-2"},
+	}, nil)
+	db.On("StoreMembership", &entity.MembershipRecord{
+		Id:      id,
+		Members: []string{"my-instance-1", "my-instance-3"},
+	}).Return(nil)
+
+	members.On("ListClusterMembers").Return([]logcollector.ClusterMember{
+		{InstanceIdentifier: "my-instance-3", IsWriter: true},
+		{InstanceIdentifier: "my-instance-1", IsWriter: false},
+	}, nil)
+
+	instanceProcessors := map[string]*mockLogProcessor{
+		"my-instance-1": new(mockLogProcessor),
+		"my-instance-3": new(mockLogProcessor),
+	}
+	instanceProcessors["my-instance-1"].On("Process").Return(StatusComplete, nil).Once()
+	instanceProcessors["my-instance-3"].On("Process").Return(StatusComplete, nil).Once()
+
+	processor := NewClusterProcessor(db, members, func(rdsInstanceIdentifier string) LogProcessor {
+		return instanceProcessors[rdsInstanceIdentifier]
+	}, 1, TestClusterIdentifier)
+	_, err := processor.Process(context.Background())
+	assert.NoError(t, err)
+
+	db.AssertExpectations(t)
+	members.AssertExpectations(t)
+	for _, p := range instanceProcessors {
+		p.AssertExpectations(t)
+	}
+}
+
+func TestClusterProcessMemberFailure(t *testing.T) {
+	db := new(mockDatabase)
+	members := new(mockClusterMemberLister)
+
+	id := fmt.Sprintf("%s:%s", TestClusterIdentifier, "members")
+	db.On("GetMembership", id).Return(&entity.MembershipRecord{
+		Id:      id,
+		Members: []string{"my-instance-1", "my-instance-2"},
+	}, nil)
+
+	members.On("ListClusterMembers").Return([]logcollector.ClusterMember{
+		{InstanceIdentifier: "my-instance-1", IsWriter: true},
+		{InstanceIdentifier: "my-instance-2", IsWriter: false},
+	}, nil)
+
+	instanceProcessors := map[string]*mockLogProcessor{
+		"my-instance-1": new(mockLogProcessor),
+		"my-instance-2": new(mockLogProcessor),
+	}
+	instanceProcessors["my-instance-1"].On("Process").Return(StatusFailed, fmt.Errorf("some error")).Once()
+	instanceProcessors["my-instance-2"].On("Process").Return(StatusComplete, nil).Once()
+
+	processor := NewClusterProcessor(db, members, func(rdsInstanceIdentifier string) LogProcessor {
+		return instanceProcessors[rdsInstanceIdentifier]
+	}, 1, TestClusterIdentifier)
+	_, err := processor.Process(context.Background())
+	assert.EqualError(t, err, "could not process instances: my-instance-1")
+
+	db.AssertExpectations(t)
+	members.AssertExpectations(t)
+	for _, p := range instanceProcessors {
+		p.AssertExpectations(t)
+	}
+}
+
+func TestClusterProcessInstances(t *testing.T) {
+	db := new(mockDatabase)
+	members := new(mockClusterMemberLister)
+
+	// Continued invocations don't compare the members, the scheduled invocations do
+	members.On("ListClusterMembers").Return([]logcollector.ClusterMember{
+		{InstanceIdentifier: "my-instance-1", IsWriter: true},
+		{InstanceIdentifier: "my-instance-2", IsWriter: false},
+	}, nil)
+
+	instanceProcessor := new(mockLogProcessor)
+	instanceProcessor.On("Process").Return(StatusComplete, nil).Once()
+
+	var processed []string
+	processor := NewClusterProcessor(db, members, func(rdsInstanceIdentifier string) LogProcessor {
+		processed = append(processed, rdsInstanceIdentifier)
+		return instanceProcessor
+	}, 1, TestClusterIdentifier)
+	_, err := processor.ProcessInstances(context.Background(), []string{"my-instance-2"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"my-instance-2"}, processed)
+
+	db.AssertExpectations(t)
+	members.AssertExpectations(t)
+	instanceProcessor.AssertExpectations(t)
+}
@@ -0,0 +1,30 @@
+package processor
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultDeadlineMargin is the time left before the deadline of the context at which no new log file is started
+const DefaultDeadlineMargin = time.Minute
+
+// Status tells if all available audit logs have been processed
+type Status string
+
+const (
+	// StatusComplete is returned if all available audit logs have been processed
+	StatusComplete Status = "complete"
+	// StatusPartial is returned if processing stopped before the deadline, the next run continues at the checkpoint
+	StatusPartial Status = "partial"
+	// StatusFailed is returned together with an error
+	StatusFailed Status = "failed"
+)
+
+// deadlineReached returns true if less than margin is left until the deadline of ctx
+func deadlineReached(ctx context.Context, margin time.Duration) bool {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return false
+	}
+	return time.Until(deadline) < margin
+}
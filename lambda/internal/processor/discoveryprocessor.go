@@ -0,0 +1,111 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+	"rdsauditlogss3/internal/database"
+	"rdsauditlogss3/internal/logcollector"
+)
+
+// DiscoveredInstanceProcessorFactory creates the processor for a single discovered RDS instance
+type DiscoveredInstanceProcessorFactory func(instance logcollector.DiscoveredInstance) LogProcessor
+
+// DiscoveryProcessor processes the audit logs of all RDS instances found by an InstanceDiscoverer
+type DiscoveryProcessor struct {
+	database             database.Database
+	discoverer           logcollector.InstanceDiscoverer
+	newInstanceProcessor DiscoveredInstanceProcessorFactory
+	concurrency          int
+	DiscoveryName        string
+}
+
+func NewDiscoveryProcessor(db database.Database, discoverer logcollector.InstanceDiscoverer, newInstanceProcessor DiscoveredInstanceProcessorFactory, concurrency int, discoveryName string) *DiscoveryProcessor {
+	return &DiscoveryProcessor{
+		database:             db,
+		discoverer:           discoverer,
+		newInstanceProcessor: newInstanceProcessor,
+		concurrency:          concurrency,
+		DiscoveryName:        discoveryName,
+	}
+}
+
+func (d *DiscoveryProcessor) Process(ctx context.Context) (Status, error) {
+	return d.process(ctx, nil)
+}
+
+func (d *DiscoveryProcessor) ProcessInstances(ctx context.Context, rdsInstanceIdentifiers []string) (Status, error) {
+	return d.process(ctx, rdsInstanceIdentifiers)
+}
+
+// process processes the given discovered instances or all of them if selected is nil
+func (d *DiscoveryProcessor) process(ctx context.Context, selected []string) (Status, error) {
+	instances, err := d.discoverer.DiscoverInstances(ctx)
+	if err != nil {
+		return StatusFailed, fmt.Errorf("error discovering instances: %v", err)
+	}
+
+	id := fmt.Sprintf("discovery:%s:%s", d.DiscoveryName, "members")
+	discovered := make(map[string]logcollector.DiscoveredInstance)
+	var currentMembers []string
+	var untagged []string
+	for _, instance := range instances {
+		if instance.Err != nil {
+			discovered[instance.InstanceIdentifier] = instance
+			untagged = append(untagged, instance.InstanceIdentifier)
+			continue
+		}
+		logrus.WithFields(logrus.Fields{"discovery": d.DiscoveryName, "instance": instance.InstanceIdentifier, "overrides": instance.Overrides}).Debug("Discovered instance")
+		discovered[instance.InstanceIdentifier] = instance
+		currentMembers = append(currentMembers, instance.InstanceIdentifier)
+	}
+	if len(untagged) > 0 {
+		// Instances whose tags can't be listed stay members if they have been discovered before, so membership
+		// doesn't change with transient errors. They fail until their tags can be listed again.
+		membershipRecord, err := d.database.GetMembership(ctx, id)
+		if err != nil {
+			return StatusFailed, fmt.Errorf("could not get discovered instances: %v", err)
+		}
+		knownMembers := make(map[string]bool)
+		if membershipRecord != nil {
+			for _, member := range membershipRecord.Members {
+				knownMembers[member] = true
+			}
+		}
+		for _, rdsInstanceIdentifier := range untagged {
+			fields := logrus.Fields{"discovery": d.DiscoveryName, "instance": rdsInstanceIdentifier}
+			if knownMembers[rdsInstanceIdentifier] {
+				logrus.WithFields(fields).Warn("Keeping discovered instance whose tags can't be listed")
+				currentMembers = append(currentMembers, rdsInstanceIdentifier)
+			} else {
+				logrus.WithFields(fields).Error("Skipping instance whose tags can't be listed")
+			}
+		}
+	}
+	sort.Strings(currentMembers)
+
+	if selected == nil {
+		// Compare with the instances discovered in the previous run, removed instances are not processed anymore
+		// but keep their checkpoint so they continue where they stopped if they are discovered again
+		err = updateMembership(ctx, d.database, id, currentMembers, logrus.Fields{"discovery": d.DiscoveryName})
+		if err != nil {
+			return StatusFailed, fmt.Errorf("could not update discovered instances: %v", err)
+		}
+	} else {
+		currentMembers = selectInstances(currentMembers, selected)
+	}
+
+	summary := processInstances(ctx, func(rdsInstanceIdentifier string) LogProcessor {
+		instance := discovered[rdsInstanceIdentifier]
+		if instance.Err != nil {
+			// Its overrides are unknown, eg. the prefix of its log objects
+			return NewFailedProcessor(instance.Err)
+		}
+		return d.newInstanceProcessor(instance)
+	}, d.concurrency, currentMembers)
+	summary.Log()
+
+	return summary.Status(), summary.Err()
+}
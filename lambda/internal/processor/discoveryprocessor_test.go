@@ -0,0 +1,103 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"rdsauditlogss3/internal/entity"
+	"rdsauditlogss3/internal/logcollector"
+)
+
+const (
+	TestDiscoveryName = "audit-logs-s3=enabled"
+)
+
+type mockInstanceDiscoverer struct {
+	mock.Mock
+}
+
+func (m *mockInstanceDiscoverer) DiscoverInstances(ctx context.Context) ([]logcollector.DiscoveredInstance, error) {
+	args := m.Called()
+	return args.Get(0).([]logcollector.DiscoveredInstance), args.Error(1)
+}
+
+func TestDiscoveryProcess(t *testing.T) {
+	db := new(mockDatabase)
+	discoverer := new(mockInstanceDiscoverer)
+
+	id := fmt.Sprintf("discovery:%s:%s", TestDiscoveryName, "members")
+	db.On("GetMembership", id).Return(&entity.MembershipRecord{
+		Id:      id,
+		Members: []string{"my-instance-1", "my-instance-2"},
+	}, nil)
+	db.On("StoreMembership", &entity.MembershipRecord{
+		Id:      id,
+		Members: []string{"my-instance-1", "my-instance-3"},
+	}).Return(nil)
+
+	discoverer.On("DiscoverInstances").Return([]logcollector.DiscoveredInstance{
+		{InstanceIdentifier: "my-instance-3", Overrides: map[string]string{"s3-prefix": "custom"}},
+		{InstanceIdentifier: "my-instance-1", Overrides: map[string]string{}},
+	}, nil)
+
+	instanceProcessors := map[string]*mockLogProcessor{
+		"my-instance-1": new(mockLogProcessor),
+		"my-instance-3": new(mockLogProcessor),
+	}
+	instanceProcessors["my-instance-1"].On("Process").Return(StatusComplete, nil).Once()
+	instanceProcessors["my-instance-3"].On("Process").Return(StatusComplete, nil).Once()
+
+	var overrides []map[string]string
+	processor := NewDiscoveryProcessor(db, discoverer, func(instance logcollector.DiscoveredInstance) LogProcessor {
+		overrides = append(overrides, instance.Overrides)
+		return instanceProcessors[instance.InstanceIdentifier]
+	}, 1, TestDiscoveryName)
+	_, err := processor.Process(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []map[string]string{{}, {"s3-prefix": "custom"}}, overrides)
+
+	db.AssertExpectations(t)
+	discoverer.AssertExpectations(t)
+	for _, p := range instanceProcessors {
+		p.AssertExpectations(t)
+	}
+}
+
+func TestDiscoveryProcessKeepsKnownInstanceWithoutTags(t *testing.T) {
+	db := new(mockDatabase)
+	discoverer := new(mockInstanceDiscoverer)
+
+	id := fmt.Sprintf("discovery:%s:%s", TestDiscoveryName, "members")
+	db.On("GetMembership", id).Return(&entity.MembershipRecord{
+		Id:      id,
+		Members: []string{"my-instance-1", "my-instance-2"},
+	}, nil)
+
+	discoverer.On("DiscoverInstances").Return([]logcollector.DiscoveredInstance{
+		{InstanceIdentifier: "my-instance-1", Overrides: map[string]string{}},
+		{InstanceIdentifier: "my-instance-2", Err: fmt.Errorf("could not list tags: Throttling")},
+		{InstanceIdentifier: "my-instance-3", Err: fmt.Errorf("could not list tags: Throttling")},
+	}, nil)
+
+	instanceProcessor := new(mockLogProcessor)
+	instanceProcessor.On("Process").Return(StatusComplete, nil).Once()
+
+	var processed []string
+	processor := NewDiscoveryProcessor(db, discoverer, func(instance logcollector.DiscoveredInstance) LogProcessor {
+		processed = append(processed, instance.InstanceIdentifier)
+		return instanceProcessor
+	}, 1, TestDiscoveryName)
+	status, err := processor.Process(context.Background())
+	assert.Error(t, err)
+	assert.Equal(t, StatusFailed, status)
+	assert.Equal(t, []string{"my-instance-1"}, processed)
+
+	// The membership is unchanged, so it isn't stored
+	db.AssertNotCalled(t, "StoreMembership", mock.Anything)
+	db.AssertExpectations(t)
+	discoverer.AssertExpectations(t)
+	instanceProcessor.AssertExpectations(t)
+}
@@ -0,0 +1,76 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"rdsauditlogss3/internal/entity"
+	"rdsauditlogss3/internal/logcollector"
+	"rdsauditlogss3/internal/parser"
+)
+
+// DefaultGapTolerance is the time between the last processed log file and the first record of the next one
+// which is not considered a gap
+const DefaultGapTolerance = time.Minute
+
+// firstRecordReader remembers the time of the first record returned by an EntryReader
+type firstRecordReader struct {
+	parser.EntryReader
+	firstRecordTime time.Time
+}
+
+func (r *firstRecordReader) Next() (*entity.LogEntry, error) {
+	entry, err := r.EntryReader.Next()
+	if err == nil && r.firstRecordTime.IsZero() {
+		r.firstRecordTime = entry.FirstRecordTime
+	}
+	return entry, err
+}
+
+// detectGap returns a gap record if audit logs may have been lost between the log file processed before
+// (finishedLogFileTimestamp) and logFile. firstRecordTime is the time of the first record of logFile.
+func (p *Processor) detectGap(finishedLogFileTimestamp int64, logFile *logcollector.LogFileReader, firstRecordTime time.Time) *entity.GapRecord {
+	if !logFile.MissingPredecessor {
+		return nil
+	}
+
+	to := logFile.LogFileTimestamp
+	if !firstRecordTime.IsZero() {
+		to = firstRecordTime.UnixNano() / int64(time.Millisecond)
+	}
+	if time.Duration(to-finishedLogFileTimestamp)*time.Millisecond <= p.GapTolerance {
+		// The next log file continues right after the one processed before
+		return nil
+	}
+
+	return &entity.GapRecord{
+		Id:                    fmt.Sprintf("%s:gap:%d", p.InstanceKey, finishedLogFileTimestamp),
+		RdsInstanceIdentifier: p.RdsInstanceIdentifier,
+		From:                  finishedLogFileTimestamp,
+		To:                    to,
+		LogFileName:           logFile.LogFileName,
+		DetectedAt:            time.Now().UnixNano() / int64(time.Millisecond),
+	}
+}
+
+// storeGap records a gap in DynamoDB and S3
+func (p *Processor) storeGap(ctx context.Context, gap *entity.GapRecord) error {
+	logrus.WithFields(logrus.Fields{
+		"instance":     gap.RdsInstanceIdentifier,
+		"from":         time.Unix(0, gap.From*int64(time.Millisecond)).UTC(),
+		"to":           time.Unix(0, gap.To*int64(time.Millisecond)).UTC(),
+		"logfile_name": gap.LogFileName,
+	}).Error("Audit logs may be missing, log files were deleted before they could be processed")
+
+	err := p.database.StoreGap(ctx, gap)
+	if err != nil {
+		return fmt.Errorf("could not save gap: %v", err)
+	}
+	err = p.S3Writer.WriteGapRecord(ctx, *gap)
+	if err != nil {
+		return fmt.Errorf("could not write gap: %v", err)
+	}
+	return nil
+}
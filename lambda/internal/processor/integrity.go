@@ -0,0 +1,117 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/sirupsen/logrus"
+	"rdsauditlogss3/internal/entity"
+	"rdsauditlogss3/internal/logcollector"
+	"rdsauditlogss3/internal/parser"
+)
+
+// maxIntegrityFailures is the number of times the download of a log file may fail verification before it is quarantined
+const maxIntegrityFailures = 3
+
+// integrityOf returns the integrity of the data read from a log file, it is empty if the log file is not verified
+func integrityOf(logFile *logcollector.LogFileReader) logcollector.Integrity {
+	if logFile.Integrity == nil {
+		return logcollector.Integrity{}
+	}
+	return logFile.Integrity()
+}
+
+// newManifestRecord describes the download of a log file after it has been read
+func (p *Processor) newManifestRecord(logFile *logcollector.LogFileReader) entity.ManifestRecord {
+	integrity := integrityOf(logFile)
+	manifest := entity.ManifestRecord{
+		RdsInstanceIdentifier: p.RdsInstanceIdentifier,
+		LogFileName:           logFile.LogFileName,
+		LogFileTimestamp:      logFile.LogFileTimestamp,
+		Identity:              logFile.Identity,
+		Size:                  logFile.Size,
+		Bytes:                 integrity.Bytes,
+		Lines:                 integrity.Lines,
+		Sha256:                integrity.Sha256,
+	}
+	if integrity.Err != nil {
+		manifest.Error = integrity.Err.Error()
+	}
+	return manifest
+}
+
+// quarantineLogFile writes the raw data of a log file which could not be verified to S3 instead of processing it.
+// The partial entries written by the failed attempts are deleted, so no unverified data is left in the archive.
+func (p *Processor) quarantineLogFile(ctx context.Context, logFile *logcollector.LogFileReader, reason error, partialEntries []entity.LogEntry) (entity.ManifestRecord, error) {
+	defer logFile.Close()
+
+	err := p.S3Writer.WriteQuarantine(ctx, entity.ManifestRecord{
+		LogFileName:      logFile.LogFileName,
+		LogFileTimestamp: logFile.LogFileTimestamp,
+		Size:             logFile.Size,
+		Error:            reason.Error(),
+	}, &unverifiedReader{logFile: logFile})
+	if err != nil {
+		return entity.ManifestRecord{}, err
+	}
+
+	deleted := make(map[entity.LogEntry]bool)
+	for _, entry := range partialEntries {
+		if deleted[entry] {
+			continue
+		}
+		err = p.S3Writer.DeleteLogEntry(ctx, entry)
+		if err != nil {
+			return entity.ManifestRecord{}, fmt.Errorf("could not delete partial log entry: %v", err)
+		}
+		deleted[entry] = true
+	}
+
+	manifest := p.newManifestRecord(logFile)
+	if manifest.Error == "" {
+		manifest.Error = reason.Error()
+	}
+	logrus.WithFields(logrus.Fields{
+		"logfile_name": manifest.LogFileName,
+		"size":         manifest.Size,
+		"bytes":        manifest.Bytes,
+		"sha256":       manifest.Sha256,
+	}).WithError(reason).Error("Log file could not be verified and has been quarantined")
+
+	return manifest, p.S3Writer.WriteManifest(ctx, manifest)
+}
+
+// recordingReader remembers the log entries returned by an EntryReader without their data
+type recordingReader struct {
+	parser.EntryReader
+	entries []entity.LogEntry
+}
+
+func (r *recordingReader) Next() (*entity.LogEntry, error) {
+	entry, err := r.EntryReader.Next()
+	if err == nil {
+		r.entries = append(r.entries, entity.LogEntry{
+			RdsInstanceIdentifier: entry.RdsInstanceIdentifier,
+			LogFileName:           entry.LogFileName,
+			LogFileIdentity:       entry.LogFileIdentity,
+			Timestamp:             entry.Timestamp,
+			LogFileTimestamp:      entry.LogFileTimestamp,
+			FirstRecordTime:       entry.FirstRecordTime,
+		})
+	}
+	return entry, err
+}
+
+// unverifiedReader reads all downloaded data of a log file, even if it can't be verified
+type unverifiedReader struct {
+	logFile *logcollector.LogFileReader
+}
+
+func (r *unverifiedReader) Read(p []byte) (int, error) {
+	n, err := r.logFile.Read(p)
+	if err != nil && err != io.EOF && integrityOf(r.logFile).Err != nil {
+		return n, io.EOF
+	}
+	return n, err
+}
@@ -0,0 +1,72 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"rdsauditlogss3/internal/database"
+	"rdsauditlogss3/internal/entity"
+)
+
+// updateMembership compares the current members of a group of RDS instances with the members known from the previous run.
+// Added and removed members are logged and the current members are stored if they changed.
+func updateMembership(ctx context.Context, db database.Database, id string, currentMembers []string, fields logrus.Fields) error {
+	membershipRecord, err := db.GetMembership(ctx, id)
+	if err != nil {
+		return fmt.Errorf("could not get members: %v", err)
+	}
+
+	var knownMembers []string
+	if membershipRecord != nil {
+		knownMembers = membershipRecord.Members
+	}
+
+	added, removed := diffMembers(knownMembers, currentMembers)
+	for _, m := range added {
+		logrus.WithFields(fields).WithField("instance", m).Info("Member added")
+	}
+	for _, m := range removed {
+		logrus.WithFields(fields).WithField("instance", m).Info("Member removed")
+	}
+
+	if len(added) == 0 && len(removed) == 0 {
+		return nil
+	}
+
+	err = db.StoreMembership(ctx, &entity.MembershipRecord{
+		Id:      id,
+		Members: currentMembers,
+	})
+	if err != nil {
+		return fmt.Errorf("could not save members: %v", err)
+	}
+
+	return nil
+}
+
+// diffMembers returns the members which are only in current (added) and the members which are only in known (removed)
+func diffMembers(known []string, current []string) ([]string, []string) {
+	knownSet := make(map[string]bool)
+	for _, m := range known {
+		knownSet[m] = true
+	}
+	currentSet := make(map[string]bool)
+	for _, m := range current {
+		currentSet[m] = true
+	}
+
+	var added, removed []string
+	for _, m := range current {
+		if !knownSet[m] {
+			added = append(added, m)
+		}
+	}
+	for _, m := range known {
+		if !currentSet[m] {
+			removed = append(removed, m)
+		}
+	}
+
+	return added, removed
+}
@@ -0,0 +1,172 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// InstanceResult is the outcome of processing the audit logs of a single RDS instance
+type InstanceResult struct {
+	RdsInstanceIdentifier string
+	Status                Status
+	Err                   error
+}
+
+// Summary holds the results of processing the audit logs of several RDS instances
+type Summary []InstanceResult
+
+// Failed returns the identifiers of all instances which could not be processed
+func (s Summary) Failed() []string {
+	var failed []string
+	for _, r := range s {
+		if r.Err != nil {
+			failed = append(failed, r.RdsInstanceIdentifier)
+		}
+	}
+	return failed
+}
+
+// Log writes the result of every instance and the totals to the log
+func (s Summary) Log() {
+	for _, r := range s {
+		logger := logrus.WithField("instance", r.RdsInstanceIdentifier)
+		if r.Err != nil {
+			logger.WithError(r.Err).Error("Processing instance failed")
+		} else if r.Status == StatusPartial {
+			logger.Warn("Processing instance stopped before the deadline")
+		} else {
+			logger.Info("Processing instance succeeded")
+		}
+	}
+
+	failed := len(s.Failed())
+	partial := len(s.Partial())
+	logrus.WithFields(logrus.Fields{"succeeded": len(s) - failed - partial, "partial": partial, "failed": failed}).Info("Processing instances is finished")
+}
+
+// Partial returns the identifiers of all instances which stopped before the deadline without an error
+func (s Summary) Partial() []string {
+	var partial []string
+	for _, r := range s {
+		if r.Err == nil && r.Status == StatusPartial {
+			partial = append(partial, r.RdsInstanceIdentifier)
+		}
+	}
+	return partial
+}
+
+// Status returns StatusFailed if any instance failed, StatusPartial if any instance stopped before the deadline
+// and StatusComplete otherwise
+func (s Summary) Status() Status {
+	if len(s.Failed()) > 0 {
+		return StatusFailed
+	}
+	if len(s.Partial()) > 0 {
+		return StatusPartial
+	}
+	return StatusComplete
+}
+
+// Err returns an error naming all failed instances or nil if all instances were processed
+func (s Summary) Err() error {
+	failed := s.Failed()
+	if len(failed) > 0 {
+		return fmt.Errorf("could not process instances: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// failedProcessor fails processing an RDS instance whose processor could not be created
+type failedProcessor struct {
+	err error
+}
+
+// NewFailedProcessor returns a processor which fails with err, so the other instances are still processed
+func NewFailedProcessor(err error) LogProcessor {
+	return &failedProcessor{err: err}
+}
+
+func (f *failedProcessor) Process(ctx context.Context) (Status, error) {
+	return StatusFailed, f.err
+}
+
+// MultiProcessor processes the audit logs of several RDS instances
+type MultiProcessor struct {
+	newInstanceProcessor   InstanceProcessorFactory
+	concurrency            int
+	RdsInstanceIdentifiers []string
+}
+
+func NewMultiProcessor(newInstanceProcessor InstanceProcessorFactory, concurrency int, rdsInstanceIdentifiers []string) *MultiProcessor {
+	return &MultiProcessor{
+		newInstanceProcessor:   newInstanceProcessor,
+		concurrency:            concurrency,
+		RdsInstanceIdentifiers: rdsInstanceIdentifiers,
+	}
+}
+
+func (m *MultiProcessor) Process(ctx context.Context) (Status, error) {
+	summary := processInstances(ctx, m.newInstanceProcessor, m.concurrency, m.RdsInstanceIdentifiers)
+	summary.Log()
+	return summary.Status(), summary.Err()
+}
+
+func (m *MultiProcessor) ProcessInstances(ctx context.Context, rdsInstanceIdentifiers []string) (Status, error) {
+	summary := processInstances(ctx, m.newInstanceProcessor, m.concurrency, selectInstances(m.RdsInstanceIdentifiers, rdsInstanceIdentifiers))
+	summary.Log()
+	return summary.Status(), summary.Err()
+}
+
+// selectInstances returns the instances which are selected, in the order of instances
+func selectInstances(instances []string, selected []string) []string {
+	selectedSet := make(map[string]bool)
+	for _, id := range selected {
+		selectedSet[id] = true
+	}
+
+	var result []string
+	for _, id := range instances {
+		if selectedSet[id] {
+			result = append(result, id)
+		} else {
+			logrus.WithField("instance", id).Debug("Instance is not selected")
+		}
+	}
+	return result
+}
+
+// processInstances runs the processors of the given instances with at most concurrency of them at the same time.
+// A failing instance does not stop the others, the results are returned in the order of rdsInstanceIdentifiers.
+func processInstances(ctx context.Context, newInstanceProcessor InstanceProcessorFactory, concurrency int, rdsInstanceIdentifiers []string) Summary {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	summary := make(Summary, len(rdsInstanceIdentifiers))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i, id := range rdsInstanceIdentifiers {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, id string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			logrus.WithField("instance", id).Info("Processing instance")
+			status, err := newInstanceProcessor(id).Process(ctx)
+			summary[i] = InstanceResult{
+				RdsInstanceIdentifier: id,
+				Status:                status,
+				Err:                   err,
+			}
+		}(i, id)
+	}
+	wg.Wait()
+
+	return summary
+}
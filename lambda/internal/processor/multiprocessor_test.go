@@ -0,0 +1,91 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMultiProcess(t *testing.T) {
+	instanceProcessors := map[string]*mockLogProcessor{
+		"my-instance-1": new(mockLogProcessor),
+		"my-instance-2": new(mockLogProcessor),
+		"my-instance-3": new(mockLogProcessor),
+	}
+	instanceProcessors["my-instance-1"].On("Process").Return(StatusComplete, nil).Once()
+	instanceProcessors["my-instance-2"].On("Process").Return(StatusFailed, fmt.Errorf("some error")).Once()
+	instanceProcessors["my-instance-3"].On("Process").Return(StatusComplete, nil).Once()
+
+	processor := NewMultiProcessor(func(rdsInstanceIdentifier string) LogProcessor {
+		return instanceProcessors[rdsInstanceIdentifier]
+	}, 2, []string{"my-instance-1", "my-instance-2", "my-instance-3"})
+	_, err := processor.Process(context.Background())
+	assert.EqualError(t, err, "could not process instances: my-instance-2")
+
+	for _, p := range instanceProcessors {
+		p.AssertExpectations(t)
+	}
+}
+
+func TestMultiProcessFailedProcessor(t *testing.T) {
+	instanceProcessor := new(mockLogProcessor)
+	instanceProcessor.On("Process").Return(StatusComplete, nil).Once()
+
+	processor := NewMultiProcessor(func(rdsInstanceIdentifier string) LogProcessor {
+		if rdsInstanceIdentifier == "my-instance-1" {
+			return NewFailedProcessor(fmt.Errorf("invalid output format"))
+		}
+		return instanceProcessor
+	}, 1, []string{"my-instance-1", "my-instance-2"})
+	status, err := processor.Process(context.Background())
+	assert.Equal(t, StatusFailed, status)
+	assert.EqualError(t, err, "could not process instances: my-instance-1")
+
+	instanceProcessor.AssertExpectations(t)
+}
+
+func TestMultiProcessInstances(t *testing.T) {
+	instanceProcessor := new(mockLogProcessor)
+	instanceProcessor.On("Process").Return(StatusComplete, nil).Once()
+
+	var processed []string
+	processor := NewMultiProcessor(func(rdsInstanceIdentifier string) LogProcessor {
+		processed = append(processed, rdsInstanceIdentifier)
+		return instanceProcessor
+	}, 1, []string{"my-instance-1", "my-instance-2", "my-instance-3"})
+	status, err := processor.ProcessInstances(context.Background(), []string{"my-instance-2", "my-removed-instance"})
+	assert.NoError(t, err)
+	assert.Equal(t, StatusComplete, status)
+	assert.Equal(t, []string{"my-instance-2"}, processed)
+
+	instanceProcessor.AssertExpectations(t)
+}
+
+func TestProcessInstancesSummary(t *testing.T) {
+	someErr := fmt.Errorf("some error")
+	instanceProcessors := map[string]*mockLogProcessor{
+		"my-instance-1": new(mockLogProcessor),
+		"my-instance-2": new(mockLogProcessor),
+		"my-instance-3": new(mockLogProcessor),
+	}
+	instanceProcessors["my-instance-1"].On("Process").Return(StatusFailed, someErr).Once()
+	instanceProcessors["my-instance-2"].On("Process").Return(StatusComplete, nil).Once()
+	instanceProcessors["my-instance-3"].On("Process").Return(StatusPartial, nil).Once()
+
+	summary := processInstances(context.Background(), func(rdsInstanceIdentifier string) LogProcessor {
+		return instanceProcessors[rdsInstanceIdentifier]
+	}, 0, []string{"my-instance-1", "my-instance-2", "my-instance-3"})
+
+	assert.Equal(t, Summary{
+		{RdsInstanceIdentifier: "my-instance-1", Status: StatusFailed, Err: someErr},
+		{RdsInstanceIdentifier: "my-instance-2", Status: StatusComplete, Err: nil},
+		{RdsInstanceIdentifier: "my-instance-3", Status: StatusPartial, Err: nil},
+	}, summary)
+	assert.Equal(t, []string{"my-instance-1"}, summary.Failed())
+	assert.Equal(t, []string{"my-instance-3"}, summary.Partial())
+	assert.Equal(t, StatusFailed, summary.Status())
+	assert.Equal(t, StatusPartial, summary[1:].Status())
+	assert.Equal(t, StatusComplete, summary[1:2].Status())
+}
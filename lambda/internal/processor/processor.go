@@ -1,9 +1,14 @@
 package processor
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
+	"rdsauditlogss3/internal/continuation"
 	"rdsauditlogss3/internal/database"
 	"rdsauditlogss3/internal/entity"
 	"rdsauditlogss3/internal/logcollector"
@@ -15,83 +20,210 @@ type Processor struct {
 	database              database.Database
 	logcollector          logcollector.LogCollector
 	S3Writer              s3writer.Writer
-	Parser                parser.Parser
+	Parsers               parser.Parsers
 	RdsInstanceIdentifier string
+	// InstanceKey identifies the instance in checkpoints, gaps and continuations. It is the RdsInstanceIdentifier
+	// unless the instance is qualified with its account, eg. if instances in several accounts have the same identifier.
+	InstanceKey string
+	// TailActiveLogFile enables processing the active log file before it is rotated
+	TailActiveLogFile bool
+	// GapTolerance is the time between two log files which is not reported as gap if log files have been lost
+	GapTolerance time.Duration
+	// DeadlineMargin is the time left before the deadline of the context at which no new log file is started
+	DeadlineMargin time.Duration
+	// Continuation records the checkpoint if processing stops before the deadline, it may be nil
+	Continuation *continuation.Recorder
 }
 
-func NewProcessor(db database.Database, lc logcollector.LogCollector, w s3writer.Writer, p parser.Parser, rdsInstanceIdentifier string) *Processor {
+func NewProcessor(db database.Database, lc logcollector.LogCollector, w s3writer.Writer, p parser.Parsers, rdsInstanceIdentifier string) *Processor {
 	return &Processor{
 		database:              db,
 		logcollector:          lc,
 		S3Writer:              w,
-		Parser:                p,
+		Parsers:               p,
 		RdsInstanceIdentifier: rdsInstanceIdentifier,
+		InstanceKey:           rdsInstanceIdentifier,
+		GapTolerance:          DefaultGapTolerance,
+		DeadlineMargin:        DefaultDeadlineMargin,
 	}
 }
 
-func (p *Processor) Process() error {
+// Process processes all rotated log files newer than the checkpoint and the active log file if it is tailed.
+// It stops with StatusPartial before a new log file is started if the deadline of ctx is less than DeadlineMargin away.
+func (p *Processor) Process(ctx context.Context) (Status, error) {
 	// Validate RDS instance
-	err := p.logcollector.ValidateAndPrepareRDSInstance()
+	err := p.logcollector.ValidateAndPrepareRDSInstance(ctx)
 	if err != nil {
-		return fmt.Errorf("error validating RDS instance: %v", err)
+		return StatusFailed, fmt.Errorf("error validating RDS instance: %v", err)
+	}
+
+	logParser, ok := p.Parsers[p.logcollector.DBType()]
+	if !ok {
+		return StatusFailed, fmt.Errorf("no parser for db type %s", p.logcollector.DBType())
 	}
 
 	// Get current checkpoint from database
-	id := fmt.Sprintf("%s:%s", p.RdsInstanceIdentifier, "audit")
-	checkpointRecord, err := p.database.GetCheckpoint(id)
+	id := fmt.Sprintf("%s:%s", p.InstanceKey, "audit")
+	checkpointRecord, err := p.database.GetCheckpoint(ctx, id)
 	if err != nil {
-		return fmt.Errorf("could not get marker: %v", err)
+		return StatusFailed, fmt.Errorf("could not get marker: %v", err)
 	}
 
-	currentLogFileTimestamp := int64(0)
+	checkpoint := entity.CheckpointRecord{Id: id}
 	if checkpointRecord != nil {
-		currentLogFileTimestamp = checkpointRecord.LogFileTimestamp
+		checkpoint = *checkpointRecord
 	}
 
 	processedLogFiles := 0
+	writtenLogEntries := 0
+	var gaps []*entity.GapRecord
+	var quarantined []string
+	integrityFailures := 0
+	var integrityErr error
+	// partialEntries are the log entries written while reading downloads which could not be verified
+	var partialEntries []entity.LogEntry
+	status := StatusComplete
 
 	for {
-		logLines, ok, logFileTimestamp, err := p.logcollector.GetLogs(currentLogFileTimestamp)
+		if deadlineReached(ctx, p.DeadlineMargin) {
+			// The checkpoint of the last log file has been stored, the next run continues there
+			logrus.WithField("logfile_timestamp", checkpoint.LogFileTimestamp).Warn("Deadline is close, stopping before the next log file")
+			status = StatusPartial
+			p.Continuation.Record(p.InstanceKey, checkpoint)
+			break
+		}
+
+		logFile, err := p.logcollector.GetLogs(ctx, checkpoint.LogFileTimestamp, checkpoint.ProcessedLogFiles)
 		if err != nil {
-			return fmt.Errorf("could not start logcollector: %v", err)
+			return StatusFailed, fmt.Errorf("could not start logcollector: %v", err)
 		}
-		if !ok {
+		if logFile == nil {
 			// No more logs available
 			break
 		}
-		
-		// d1 := []byte(logLines[0])
-		// err = ioutil.WriteFile(fmt.Sprintf("/tmp/%d", logFileTimestamp), d1, 0644)
 
-		currentLogFileTimestamp = logFileTimestamp
+		var manifest entity.ManifestRecord
+		if integrityFailures >= maxIntegrityFailures {
+			// The download could not be verified repeatedly, the log file is not processed but kept for investigation
+			manifest, err = p.quarantineLogFile(ctx, logFile, integrityErr, partialEntries)
+			if err != nil {
+				return StatusFailed, fmt.Errorf("could not quarantine log file: %v", err)
+			}
+			quarantined = append(quarantined, logFile.LogFileName)
+		} else {
+			var logLines io.Reader = logFile
+			var skippedLines int64
+			if checkpoint.ActiveLogFile.Offset > 0 {
+				// The beginning of the file has already been processed while it was the active log file
+				logLines, skippedLines, err = skipTailedData(logFile, checkpoint.ActiveLogFile.Offset)
+				if err != nil {
+					logFile.Close()
+					return StatusFailed, fmt.Errorf("could not skip tailed data: %v", err)
+				}
+			}
 
-		logEntries, err := p.Parser.ParseEntries(logLines, currentLogFileTimestamp)
-		if err != nil {
-			logrus.WithFields(logrus.Fields{"err": err}).Warn("Could not parse entries")
-			return fmt.Errorf("could not parse entries: %v", err)
-		}
+			recorded := &recordingReader{EntryReader: p.newSourceReader(logParser.ParseEntries(logLines, logFile.LogFileTimestamp), logFile, skippedLines)}
+			entries := &firstRecordReader{EntryReader: recorded}
+			writtenEntries, err := p.writeLogEntries(ctx, entries)
+			logFile.Close()
+			writtenLogEntries += writtenEntries
+
+			if integrityErr = integrityOf(logFile).Err; integrityErr != nil {
+				// The download is incomplete, the entries written so far are overwritten when it is processed again
+				// or deleted when it is quarantined
+				integrityFailures++
+				partialEntries = append(partialEntries, recorded.entries...)
+				logrus.WithField("logfile_name", logFile.LogFileName).WithError(integrityErr).Warn("Log file download could not be verified")
+				continue
+			}
+			if err != nil {
+				return StatusFailed, err
+			}
 
-		for _, entry := range logEntries {
-			processedLogFiles += 1
+			gap := p.detectGap(checkpoint.LogFileTimestamp, logFile, entries.firstRecordTime)
+			if gap != nil {
+				err = p.storeGap(ctx, gap)
+				if err != nil {
+					return StatusFailed, err
+				}
+				gaps = append(gaps, gap)
+			}
 
-			err := p.S3Writer.WriteLogEntry(*entry)
-			if err != nil {
-				logrus.WithError(err).Warn("Could not write log entry")
-				return fmt.Errorf("could not write log entry: %v", err)
+			manifest = p.newManifestRecord(logFile)
+			if manifest.Sha256 != "" {
+				err = p.S3Writer.WriteManifest(ctx, manifest)
+				if err != nil {
+					return StatusFailed, err
+				}
 			}
 		}
+		integrityFailures = 0
+		partialEntries = nil
+
+		checkpoint = entity.CheckpointRecord{
+			LogFileTimestamp:  logFile.LogFileTimestamp,
+			Id:                id,
+			ProcessedLogFiles: processedLogFileIdentities(checkpoint, logFile),
+			LogFileSha256:     manifest.Sha256,
+		}
+		logrus.WithField("logfile_timestamp", checkpoint.LogFileTimestamp).Info("StoreCheckpoint")
+		err = p.database.StoreCheckpoint(ctx, &checkpoint)
+		if err != nil {
+			return StatusFailed, fmt.Errorf("could not save marker: %v", err)
+		}
+		processedLogFiles++
+	}
 
-		logrus.WithField("logfile_timestamp", currentLogFileTimestamp).Info("StoreCheckpoint")
-		err = p.database.StoreCheckpoint(&entity.CheckpointRecord{
-			LogFileTimestamp: currentLogFileTimestamp,
-			Id:               id,
-		})
+	if p.TailActiveLogFile && status == StatusComplete {
+		writtenEntries, err := p.tailActiveLogFile(ctx, logParser, &checkpoint)
+		writtenLogEntries += writtenEntries
 		if err != nil {
-			return fmt.Errorf("could not save marker: %v", err)
+			return StatusFailed, err
 		}
 	}
 
-	logrus.WithFields(logrus.Fields{"processed_log_files": processedLogFiles}).Info("Processing logs is finished")
+	logrus.WithFields(logrus.Fields{"processed_log_files": processedLogFiles, "written_log_entries": writtenLogEntries, "status": status}).Info("Processing logs is finished")
+
+	if len(gaps) > 0 {
+		// The logs after the gaps have been processed, but the gaps must not go unnoticed
+		return StatusFailed, fmt.Errorf("audit logs may be missing, number of gaps: %d", len(gaps))
+	}
+	if len(quarantined) > 0 {
+		return StatusFailed, fmt.Errorf("log files could not be verified and have been quarantined: %s", strings.Join(quarantined, ", "))
+	}
+	return status, nil
+}
+
+// processedLogFileIdentities returns the identities of all processed log files written at the time of logFile
+func processedLogFileIdentities(checkpoint entity.CheckpointRecord, logFile *logcollector.LogFileReader) []string {
+	var identities []string
+	if logFile.LogFileTimestamp == checkpoint.LogFileTimestamp {
+		identities = append(identities, checkpoint.ProcessedLogFiles...)
+	}
+	if logFile.Identity != "" {
+		identities = append(identities, logFile.Identity)
+	}
+	return identities
+}
+
+// writeLogEntries writes all log entries to S3 while they are parsed and returns the number of written entries
+func (p *Processor) writeLogEntries(ctx context.Context, entries parser.EntryReader) (int, error) {
+	written := 0
+	for {
+		entry, err := entries.Next()
+		if err == io.EOF {
+			return written, nil
+		}
+		if err != nil {
+			logrus.WithFields(logrus.Fields{"err": err}).Warn("Could not parse entries")
+			return written, fmt.Errorf("could not parse entries: %v", err)
+		}
 
-	return nil
+		err = p.S3Writer.WriteLogEntry(ctx, *entry)
+		if err != nil {
+			logrus.WithError(err).Warn("Could not write log entry")
+			return written, fmt.Errorf("could not write log entry: %v", err)
+		}
+		written += 1
+	}
 }
@@ -1,17 +1,21 @@
 package processor
 
 import (
+	"context"
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"rdsauditlogss3/internal/continuation"
 	"rdsauditlogss3/internal/database"
 	"rdsauditlogss3/internal/entity"
 	"rdsauditlogss3/internal/logcollector"
 	parser "rdsauditlogss3/internal/parser"
 	"rdsauditlogss3/internal/s3writer"
 	"io"
+	"io/ioutil"
 	"strings"
 	"testing"
+	"time"
 )
 
 const (
@@ -23,46 +27,111 @@ type mockDatabase struct {
 	mock.Mock
 }
 
-func (m *mockDatabase) StoreCheckpoint(record *entity.CheckpointRecord) error {
+func (m *mockDatabase) StoreCheckpoint(ctx context.Context, record *entity.CheckpointRecord) error {
 	args := m.Called(record)
 	return args.Error(0)
 }
 
-func (m *mockDatabase) GetCheckpoint(id string) (*entity.CheckpointRecord, error) {
+func (m *mockDatabase) GetCheckpoint(ctx context.Context, id string) (*entity.CheckpointRecord, error) {
 	args := m.Called(id)
 	return args.Get(0).(*entity.CheckpointRecord), args.Error(1)
 }
 
+func (m *mockDatabase) StoreGap(ctx context.Context, record *entity.GapRecord) error {
+	args := m.Called(record)
+	return args.Error(0)
+}
+
 type mockLogCollector struct {
 	logcollector.LogCollector
 	mock.Mock
 }
 
-func (m *mockLogCollector) GetLogs(timestamp int64) (io.Reader, bool, int64, error) {
-	args := m.Called(timestamp)
+func (m *mockLogCollector) GetLogs(ctx context.Context, timestamp int64, processedLogFiles []string) (*logcollector.LogFileReader, error) {
+	args := m.Called(timestamp, processedLogFiles)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*logcollector.LogFileReader), args.Error(1)
+}
+
+func (m *mockLogCollector) GetActiveLogs(ctx context.Context, marker string, offset int64) (*logcollector.LogFileReader, error) {
+	args := m.Called(marker, offset)
 	if args.Get(0) == nil {
-		return nil, args.Get(1).(bool), args.Get(2).(int64), args.Error(3)
+		return nil, args.Error(1)
 	}
-	return args.Get(0).(io.Reader), args.Get(1).(bool), args.Get(2).(int64), args.Error(3)
+	return args.Get(0).(*logcollector.LogFileReader), args.Error(1)
 }
 
-func (m *mockLogCollector) ValidateAndPrepareRDSInstance() error {
+func (m *mockLogCollector) ValidateAndPrepareRDSInstance(ctx context.Context) error {
 	args := m.Called()
 	return args.Error(0)
 }
 
+func (m *mockLogCollector) DBType() string {
+	args := m.Called()
+	return args.String(0)
+}
+
+func newLogFileReader(data string, logFileTimestamp int64) *logcollector.LogFileReader {
+	return &logcollector.LogFileReader{
+		ReadCloser:       ioutil.NopCloser(strings.NewReader(data)),
+		LogFileTimestamp: logFileTimestamp,
+		Size:             int64(len(data)),
+	}
+}
+
 type mockWriter struct {
 	s3writer.Writer
 	mock.Mock
 }
 
-func (m *mockWriter) WriteLogEntry(data entity.LogEntry) error {
+// writtenLogEntry is a log entry with its data read, entity.LogEntry can only be read once
+type writtenLogEntry struct {
+	Timestamp        entity.LogEntryTimestamp
+	LogLine          string
+	LogFileTimestamp int64
+}
+
+func (m *mockWriter) WriteLogEntry(ctx context.Context, data entity.LogEntry) error {
+	logLine, err := ioutil.ReadAll(data.LogLine)
+	if err != nil {
+		return err
+	}
+	args := m.Called(writtenLogEntry{
+		Timestamp:        data.Timestamp,
+		LogLine:          string(logLine),
+		LogFileTimestamp: data.LogFileTimestamp,
+	})
+	return args.Error(0)
+}
+
+func (m *mockWriter) DeleteLogEntry(ctx context.Context, data entity.LogEntry) error {
 	args := m.Called(data)
 	return args.Error(0)
 }
 
+func (m *mockWriter) WriteGapRecord(ctx context.Context, gap entity.GapRecord) error {
+	args := m.Called(gap)
+	return args.Error(0)
+}
+
+func (m *mockWriter) WriteManifest(ctx context.Context, manifest entity.ManifestRecord) error {
+	args := m.Called(manifest)
+	return args.Error(0)
+}
+
+func (m *mockWriter) WriteQuarantine(ctx context.Context, manifest entity.ManifestRecord, data io.Reader) error {
+	content, err := ioutil.ReadAll(data)
+	if err != nil {
+		return err
+	}
+	args := m.Called(manifest, string(content))
+	return args.Error(0)
+}
+
 func TestProcessOneLogCallback(t *testing.T) {
-	p := parser.NewAuditLogParser()
+	p := parser.Parsers{"mysql": parser.NewAuditLogParser()}
 	db := new(mockDatabase)
 	lc := new(mockLogCollector)
 	w := new(mockWriter)
@@ -83,25 +152,51 @@ func TestProcessOneLogCallback(t *testing.T) {
 	}).Return(nil)
 
 	lc.On("ValidateAndPrepareRDSInstance").Return(nil)
-	lc.On("GetLogs", initialMarker).Return(strings.NewReader(logLine), true, nextMarker, nil).Once()
-	lc.On("GetLogs", nextMarker).Return(nil, false, int64(0), nil).Once()
+	lc.On("DBType").Return("mysql")
+	lc.On("GetLogs", initialMarker, []string(nil)).Return(newLogFileReader(logLine, nextMarker), nil).Once()
+	lc.On("GetLogs", nextMarker, []string(nil)).Return(nil, nil).Once()
 
-	expectedWriteLogEntryInput := mock.MatchedBy(func(data entity.LogEntry) bool {
-		return data.Timestamp == logLineDate && data.LogLine.String() == logLine+"\n" && data.LogFileTimestamp == nextMarker
-	})
-	w.On("WriteLogEntry", expectedWriteLogEntryInput).Return(nil)
+	w.On("WriteLogEntry", writtenLogEntry{
+		Timestamp:        logLineDate,
+		LogLine:          logLine + "\n",
+		LogFileTimestamp: nextMarker,
+	}).Return(nil)
 
 	processor := NewProcessor(db, lc, w, p, TestRdsInstanceIdentifier)
-	err := processor.Process()
+	status, err := processor.Process(context.Background())
 	assert.NoError(t, err)
+	assert.Equal(t, StatusComplete, status)
 
 	db.AssertExpectations(t)
 	lc.AssertExpectations(t)
 	w.AssertExpectations(t)
 }
 
+func TestProcessInstanceKey(t *testing.T) {
+	p := parser.Parsers{"mysql": parser.NewAuditLogParser()}
+	db := new(mockDatabase)
+	lc := new(mockLogCollector)
+	w := new(mockWriter)
+
+	// The checkpoint of an instance qualified with its account is not shared with instances of the same name
+	id := fmt.Sprintf("123456789012:%s:%s", TestRdsInstanceIdentifier, "audit")
+	db.On("GetCheckpoint", id).Return((*entity.CheckpointRecord)(nil), nil)
+
+	lc.On("ValidateAndPrepareRDSInstance").Return(nil)
+	lc.On("DBType").Return("mysql")
+	lc.On("GetLogs", int64(0), []string(nil)).Return(nil, nil).Once()
+
+	processor := NewProcessor(db, lc, w, p, TestRdsInstanceIdentifier)
+	processor.InstanceKey = "123456789012:" + TestRdsInstanceIdentifier
+	_, err := processor.Process(context.Background())
+	assert.NoError(t, err)
+
+	db.AssertExpectations(t)
+	lc.AssertExpectations(t)
+}
+
 func TestProcessMultiLogCallback(t *testing.T) {
-	p := parser.NewAuditLogParser()
+	p := parser.Parsers{"mysql": parser.NewAuditLogParser()}
 	db := new(mockDatabase)
 	lc := new(mockLogCollector)
 	w := new(mockWriter)
@@ -132,29 +227,546 @@ func TestProcessMultiLogCallback(t *testing.T) {
 	}).Return(nil)
 
 	lc.On("ValidateAndPrepareRDSInstance").Return(nil)
-	lc.On("GetLogs", logFileTimestamp1).Return(strings.NewReader(fmt.Sprintf("%s\n%s",logLine1,logLine2)), true, logFileTimestamp2, nil).Once()
-	lc.On("GetLogs", logFileTimestamp2).Return(strings.NewReader(logLine3), true, logFileTimestamp3, nil).Once()
-	lc.On("GetLogs", logFileTimestamp3).Return(nil, false, int64(0), nil).Once()
+	lc.On("DBType").Return("mysql")
+	lc.On("GetLogs", logFileTimestamp1, []string(nil)).Return(newLogFileReader(fmt.Sprintf("%s\n%s",logLine1,logLine2), logFileTimestamp2), nil).Once()
+	lc.On("GetLogs", logFileTimestamp2, []string(nil)).Return(newLogFileReader(logLine3, logFileTimestamp3), nil).Once()
+	lc.On("GetLogs", logFileTimestamp3, []string(nil)).Return(nil, nil).Once()
 
 
-	expectedWriteLogEntryInput := mock.MatchedBy(func(data entity.LogEntry) bool {
-		return data.Timestamp == logLine1Date && data.LogLine.String() == fmt.Sprintf("%s\n", logLine1) && data.LogFileTimestamp == logFileTimestamp2
-	})
-	w.On("WriteLogEntry", expectedWriteLogEntryInput).Return(nil)
-	expectedWriteLogEntryInput2 := mock.MatchedBy(func(data entity.LogEntry) bool {
-		return data.Timestamp == logLine2Date && data.LogLine.String() == fmt.Sprintf("%s\n", logLine2) && data.LogFileTimestamp == logFileTimestamp2
-	})
-	w.On("WriteLogEntry", expectedWriteLogEntryInput2).Return(nil)
-	expectedWriteLogEntryInput3 := mock.MatchedBy(func(data entity.LogEntry) bool {
-		return data.Timestamp == logLine3Date && data.LogLine.String() == fmt.Sprintf("%s\n", logLine3) && data.LogFileTimestamp == logFileTimestamp3
-	})
-	w.On("WriteLogEntry", expectedWriteLogEntryInput3).Return(nil)
+	w.On("WriteLogEntry", writtenLogEntry{
+		Timestamp:        logLine1Date,
+		LogLine:          fmt.Sprintf("%s\n", logLine1),
+		LogFileTimestamp: logFileTimestamp2,
+	}).Return(nil)
+	w.On("WriteLogEntry", writtenLogEntry{
+		Timestamp:        logLine2Date,
+		LogLine:          fmt.Sprintf("%s\n", logLine2),
+		LogFileTimestamp: logFileTimestamp2,
+	}).Return(nil)
+	w.On("WriteLogEntry", writtenLogEntry{
+		Timestamp:        logLine3Date,
+		LogLine:          fmt.Sprintf("%s\n", logLine3),
+		LogFileTimestamp: logFileTimestamp3,
+	}).Return(nil)
+
+	processor := NewProcessor(db, lc, w, p, TestRdsInstanceIdentifier)
+	_, err := processor.Process(context.Background())
+	assert.NoError(t, err)
+
+	db.AssertExpectations(t)
+	lc.AssertExpectations(t)
+	w.AssertExpectations(t)
+}
+
+func TestProcessUnsupportedDBType(t *testing.T) {
+	p := parser.Parsers{"mysql": parser.NewAuditLogParser()}
+	db := new(mockDatabase)
+	lc := new(mockLogCollector)
+	w := new(mockWriter)
+
+	lc.On("ValidateAndPrepareRDSInstance").Return(nil)
+	lc.On("DBType").Return("postgres")
+
+	processor := NewProcessor(db, lc, w, p, TestRdsInstanceIdentifier)
+	_, err := processor.Process(context.Background())
+	assert.EqualError(t, err, "no parser for db type postgres")
+
+	lc.AssertExpectations(t)
+}
+
+func TestProcessTailActiveLogFile(t *testing.T) {
+	p := parser.Parsers{"mysql": parser.NewAuditLogParser()}
+	db := new(mockDatabase)
+	lc := new(mockLogCollector)
+	w := new(mockWriter)
+
+	id := fmt.Sprintf("%s:%s", TestRdsInstanceIdentifier, "audit")
+	logFileTimestamp := int64(1)
+	activeLogFileTimestamp := int64(2)
+
+	logLine1Date := entity.NewLogEntryTimestamp(2020, 7, 14, 7)
+	logLine1 := "20200714 07:05:25,ip-172-27-1-97,rdsadmin,localhost,26,47141561040897,QUERY,mysql,'SELECT 1',0"
+	logLine2 := "20200714 07:05:30,ip-172-27-1-97,rdsadmin,localhost,26,47141561040897,QUERY,mysql,'SELECT 2',0"
+	partialLine := "20200714 07:05:"
+
+	// The partial line of the previous run is completed by the new data
+	db.On("GetCheckpoint", id).Return(&entity.CheckpointRecord{
+		LogFileTimestamp: logFileTimestamp,
+		Id:               id,
+		ActiveLogFile: entity.ActiveLogFileCheckpoint{
+			Marker:      "1:100",
+			Offset:      100,
+			PartialLine: logLine1[:10],
+			Lines:       5,
+		},
+	}, nil)
+	db.On("StoreCheckpoint", &entity.CheckpointRecord{
+		LogFileTimestamp: logFileTimestamp,
+		Id:               id,
+		ActiveLogFile: entity.ActiveLogFileCheckpoint{
+			Marker:      "1:300",
+			Offset:      100 + int64(len(logLine1)+len(logLine2)+2),
+			PartialLine: partialLine,
+			Lines:       7,
+		},
+	}).Return(nil)
+
+	activeLogFile := newLogFileReader(logLine1[10:]+"\n"+logLine2+"\n"+partialLine, activeLogFileTimestamp)
+	activeLogFile.Marker = func() string { return "1:300" }
+
+	lc.On("ValidateAndPrepareRDSInstance").Return(nil)
+	lc.On("DBType").Return("mysql")
+	lc.On("GetLogs", logFileTimestamp, []string(nil)).Return(nil, nil).Once()
+	lc.On("GetActiveLogs", "1:100", int64(110)).Return(activeLogFile, nil).Once()
+
+	w.On("WriteLogEntry", writtenLogEntry{
+		Timestamp:        logLine1Date,
+		LogLine:          fmt.Sprintf("%s\n%s\n", logLine1, logLine2),
+		LogFileTimestamp: activeLogFileTimestamp,
+	}).Return(nil)
+
+	processor := NewProcessor(db, lc, w, p, TestRdsInstanceIdentifier)
+	processor.TailActiveLogFile = true
+	processor.Continuation = continuation.NewRecorder()
+	_, err := processor.Process(context.Background())
+	assert.NoError(t, err)
+
+	db.AssertExpectations(t)
+	lc.AssertExpectations(t)
+	w.AssertExpectations(t)
+}
+
+func TestProcessTailActiveLogFilePartialRecord(t *testing.T) {
+	p := parser.Parsers{"mysql": parser.NewAuditLogParser()}
+	db := new(mockDatabase)
+	lc := new(mockLogCollector)
+	w := new(mockWriter)
+
+	id := fmt.Sprintf("%s:%s", TestRdsInstanceIdentifier, "audit")
+	logFileTimestamp := int64(1)
+	activeLogFileTimestamp := int64(2)
+
+	logLine1Date := entity.NewLogEntryTimestamp(2020, 7, 14, 7)
+	logLine1 := "20200714 07:05:25,ip-172-27-1-97,rdsadmin,localhost,26,47141561040897,QUERY,mysql,'SELECT 1',0"
+	// The query of the second record is still being written
+	partialRecord := "20200714 07:05:30,ip-172-27-1-97,rdsadmin,localhost,26,47141561040897,QUERY,mysql,'SELECT\n2"
+
+	db.On("GetCheckpoint", id).Return(&entity.CheckpointRecord{
+		LogFileTimestamp: logFileTimestamp,
+		Id:               id,
+		ActiveLogFile: entity.ActiveLogFileCheckpoint{
+			Marker: "1:100",
+			Offset: 100,
+			Lines:  5,
+		},
+	}, nil)
+	db.On("StoreCheckpoint", &entity.CheckpointRecord{
+		LogFileTimestamp: logFileTimestamp,
+		Id:               id,
+		ActiveLogFile: entity.ActiveLogFileCheckpoint{
+			Marker:      "1:300",
+			Offset:      100 + int64(len(logLine1)+1),
+			PartialLine: partialRecord,
+			Lines:       6,
+		},
+	}).Return(nil)
+
+	activeLogFile := newLogFileReader(logLine1+"\n"+partialRecord, activeLogFileTimestamp)
+	activeLogFile.Marker = func() string { return "1:300" }
+
+	lc.On("ValidateAndPrepareRDSInstance").Return(nil)
+	lc.On("DBType").Return("mysql")
+	lc.On("GetLogs", logFileTimestamp, []string(nil)).Return(nil, nil).Once()
+	lc.On("GetActiveLogs", "1:100", int64(100)).Return(activeLogFile, nil).Once()
+
+	w.On("WriteLogEntry", writtenLogEntry{
+		Timestamp:        logLine1Date,
+		LogLine:          logLine1 + "\n",
+		LogFileTimestamp: activeLogFileTimestamp,
+	}).Return(nil)
+
+	processor := NewProcessor(db, lc, w, p, TestRdsInstanceIdentifier)
+	processor.TailActiveLogFile = true
+	processor.Continuation = continuation.NewRecorder()
+	_, err := processor.Process(context.Background())
+	assert.NoError(t, err)
+
+	db.AssertExpectations(t)
+	lc.AssertExpectations(t)
+	w.AssertExpectations(t)
+}
+
+func TestProcessRotatedTailedLogFile(t *testing.T) {
+	p := parser.Parsers{"mysql": parser.NewAuditLogParser()}
+	db := new(mockDatabase)
+	lc := new(mockLogCollector)
+	w := new(mockWriter)
+
+	id := fmt.Sprintf("%s:%s", TestRdsInstanceIdentifier, "audit")
+	logFileTimestamp1 := int64(1)
+	logFileTimestamp2 := int64(2)
+
+	logLine1 := "20200714 07:05:25,ip-172-27-1-97,rdsadmin,localhost,26,47141561040897,QUERY,mysql,'SELECT 1',0"
+	logLine2Date := entity.NewLogEntryTimestamp(2020, 7, 14, 8)
+	logLine2 := "20200714 08:05:30,ip-172-27-1-97,rdsadmin,localhost,26,47141561040897,QUERY,mysql,'SELECT 2',0"
+
+	// The first line has been processed while the file was active
+	db.On("GetCheckpoint", id).Return(&entity.CheckpointRecord{
+		LogFileTimestamp: logFileTimestamp1,
+		Id:               id,
+		ActiveLogFile: entity.ActiveLogFileCheckpoint{
+			Marker: "1:100",
+			Offset: int64(len(logLine1) + 1),
+		},
+	}, nil)
+	db.On("StoreCheckpoint", &entity.CheckpointRecord{
+		LogFileTimestamp: logFileTimestamp2,
+		Id:               id,
+	}).Return(nil)
+
+	lc.On("ValidateAndPrepareRDSInstance").Return(nil)
+	lc.On("DBType").Return("mysql")
+	lc.On("GetLogs", logFileTimestamp1, []string(nil)).Return(newLogFileReader(logLine1+"\n"+logLine2+"\n", logFileTimestamp2), nil).Once()
+	lc.On("GetLogs", logFileTimestamp2, []string(nil)).Return(nil, nil).Once()
+
+	w.On("WriteLogEntry", writtenLogEntry{
+		Timestamp:        logLine2Date,
+		LogLine:          logLine2 + "\n",
+		LogFileTimestamp: logFileTimestamp2,
+	}).Return(nil)
+
+	processor := NewProcessor(db, lc, w, p, TestRdsInstanceIdentifier)
+	_, err := processor.Process(context.Background())
+	assert.NoError(t, err)
+
+	db.AssertExpectations(t)
+	lc.AssertExpectations(t)
+	w.AssertExpectations(t)
+}
+
+func TestProcessGap(t *testing.T) {
+	p := parser.Parsers{"mysql": parser.NewAuditLogParser()}
+	db := new(mockDatabase)
+	lc := new(mockLogCollector)
+	w := new(mockWriter)
+
+	id := fmt.Sprintf("%s:%s", TestRdsInstanceIdentifier, "audit")
+	logFileTimestamp1 := int64(1594710000000) // 2020-07-14 07:00:00
+	logFileTimestamp2 := int64(1594713600000)
+	logFileTimestamp3 := int64(1594717200000)
+
+	logLine1 := "20200714 07:00:30,ip-172-27-1-97,rdsadmin,localhost,26,47141561040897,QUERY,mysql,'SELECT 1',0"
+	logLine2 := "20200714 08:00:10,ip-172-27-1-97,rdsadmin,localhost,26,47141561040897,QUERY,mysql,'SELECT 2',0"
+
+	db.On("GetCheckpoint", id).Return(&entity.CheckpointRecord{
+		LogFileTimestamp: logFileTimestamp1,
+		Id:               id,
+	}, nil)
+	db.On("StoreCheckpoint", mock.Anything).Return(nil)
+	expectedGap := func(gap *entity.GapRecord) bool {
+		return gap.Id == fmt.Sprintf("%s:gap:%d", TestRdsInstanceIdentifier, logFileTimestamp1) &&
+			gap.From == logFileTimestamp1 && gap.To == 1594710030000 && gap.LogFileName == "audit/server_audit.log.2"
+	}
+	db.On("StoreGap", mock.MatchedBy(expectedGap)).Return(nil).Once()
+
+	// The log file processed before has been deleted, the first record of the next file is 30s later
+	logFile2 := newLogFileReader(logLine1, logFileTimestamp2)
+	logFile2.LogFileName = "audit/server_audit.log.2"
+	logFile2.MissingPredecessor = true
+	// The log file processed before has been deleted, but the next file continues right after it
+	logFile3 := newLogFileReader(logLine2, logFileTimestamp3)
+	logFile3.LogFileName = "audit/server_audit.log.1"
+	logFile3.MissingPredecessor = true
+
+	lc.On("ValidateAndPrepareRDSInstance").Return(nil)
+	lc.On("DBType").Return("mysql")
+	lc.On("GetLogs", logFileTimestamp1, []string(nil)).Return(logFile2, nil).Once()
+	lc.On("GetLogs", logFileTimestamp2, []string(nil)).Return(logFile3, nil).Once()
+	lc.On("GetLogs", logFileTimestamp3, []string(nil)).Return(nil, nil).Once()
+
+	w.On("WriteLogEntry", mock.Anything).Return(nil)
+	w.On("WriteGapRecord", mock.MatchedBy(func(gap entity.GapRecord) bool { return expectedGap(&gap) })).Return(nil).Once()
 
 	processor := NewProcessor(db, lc, w, p, TestRdsInstanceIdentifier)
-	err := processor.Process()
+	processor.GapTolerance = 20 * time.Second
+	_, err := processor.Process(context.Background())
+	assert.EqualError(t, err, "audit logs may be missing, number of gaps: 1")
+
+	db.AssertExpectations(t)
+	lc.AssertExpectations(t)
+	w.AssertExpectations(t)
+}
+
+func TestProcessStoresLogFileIdentities(t *testing.T) {
+	p := parser.Parsers{"mysql": parser.NewAuditLogParser()}
+	db := new(mockDatabase)
+	lc := new(mockLogCollector)
+	w := new(mockWriter)
+
+	id := fmt.Sprintf("%s:%s", TestRdsInstanceIdentifier, "audit")
+	logFileTimestamp1 := int64(1)
+	logFileTimestamp2 := int64(2)
+
+	logLine := "20200714 07:05:25,ip-172-27-1-97,rdsadmin,localhost,26,47141561040897,QUERY,mysql,'SELECT 1',0"
+
+	db.On("GetCheckpoint", id).Return(&entity.CheckpointRecord{
+		LogFileTimestamp:  logFileTimestamp1,
+		Id:                id,
+		ProcessedLogFiles: []string{"identity-1"},
+	}, nil)
+	// A file written at the same time as the one processed before, its identity is added
+	db.On("StoreCheckpoint", &entity.CheckpointRecord{
+		LogFileTimestamp:  logFileTimestamp1,
+		Id:                id,
+		ProcessedLogFiles: []string{"identity-1", "identity-2"},
+	}).Return(nil).Once()
+	// A file written later replaces the identities
+	db.On("StoreCheckpoint", &entity.CheckpointRecord{
+		LogFileTimestamp:  logFileTimestamp2,
+		Id:                id,
+		ProcessedLogFiles: []string{"identity-3"},
+	}).Return(nil).Once()
+
+	logFile2 := newLogFileReader(logLine, logFileTimestamp1)
+	logFile2.Identity = "identity-2"
+	logFile3 := newLogFileReader(logLine, logFileTimestamp2)
+	logFile3.Identity = "identity-3"
+
+	lc.On("ValidateAndPrepareRDSInstance").Return(nil)
+	lc.On("DBType").Return("mysql")
+	lc.On("GetLogs", logFileTimestamp1, []string{"identity-1"}).Return(logFile2, nil).Once()
+	lc.On("GetLogs", logFileTimestamp1, []string{"identity-1", "identity-2"}).Return(logFile3, nil).Once()
+	lc.On("GetLogs", logFileTimestamp2, []string{"identity-3"}).Return(nil, nil).Once()
+
+	w.On("WriteLogEntry", mock.Anything).Return(nil)
+
+	processor := NewProcessor(db, lc, w, p, TestRdsInstanceIdentifier)
+	_, err := processor.Process(context.Background())
+	assert.NoError(t, err)
+
+	db.AssertExpectations(t)
+	lc.AssertExpectations(t)
+}
+
+// newVerifiedLogFileReader returns a log file whose download fails verification with verifyErr once it has been read
+func newVerifiedLogFileReader(data string, logFileTimestamp int64, verifyErr error) *logcollector.LogFileReader {
+	logFile := newLogFileReader(data, logFileTimestamp)
+	logFile.LogFileName = "audit/server_audit.log.1"
+	reader := logFile.ReadCloser
+	done := false
+	logFile.ReadCloser = ioutil.NopCloser(readerFunc(func(p []byte) (int, error) {
+		n, err := reader.Read(p)
+		if err == io.EOF {
+			done = true
+			if verifyErr != nil {
+				return n, verifyErr
+			}
+		}
+		return n, err
+	}))
+	logFile.Integrity = func() logcollector.Integrity {
+		if !done {
+			return logcollector.Integrity{}
+		}
+		return logcollector.Integrity{Bytes: int64(len(data)), Lines: 1, Sha256: "abc", Err: verifyErr}
+	}
+	return logFile
+}
+
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) {
+	return f(p)
+}
+
+func TestProcessWritesManifest(t *testing.T) {
+	p := parser.Parsers{"mysql": parser.NewAuditLogParser()}
+	db := new(mockDatabase)
+	lc := new(mockLogCollector)
+	w := new(mockWriter)
+
+	id := fmt.Sprintf("%s:%s", TestRdsInstanceIdentifier, "audit")
+	logLine := "20200714 07:05:25,ip-172-27-1-97,rdsadmin,localhost,26,47141561040897,QUERY,mysql,'SELECT 1',0\n"
+
+	db.On("GetCheckpoint", id).Return(&entity.CheckpointRecord{Id: id}, nil)
+	db.On("StoreCheckpoint", &entity.CheckpointRecord{
+		LogFileTimestamp: 2,
+		Id:               id,
+		LogFileSha256:    "abc",
+	}).Return(nil).Once()
+
+	lc.On("ValidateAndPrepareRDSInstance").Return(nil)
+	lc.On("DBType").Return("mysql")
+	lc.On("GetLogs", int64(0), []string(nil)).Return(newVerifiedLogFileReader(logLine, 2, nil), nil).Once()
+	lc.On("GetLogs", int64(2), []string(nil)).Return(nil, nil).Once()
+
+	w.On("WriteLogEntry", mock.Anything).Return(nil)
+	w.On("WriteManifest", entity.ManifestRecord{
+		RdsInstanceIdentifier: TestRdsInstanceIdentifier,
+		LogFileName:           "audit/server_audit.log.1",
+		LogFileTimestamp:      2,
+		Size:                  int64(len(logLine)),
+		Bytes:                 int64(len(logLine)),
+		Lines:                 1,
+		Sha256:                "abc",
+	}).Return(nil).Once()
+
+	processor := NewProcessor(db, lc, w, p, TestRdsInstanceIdentifier)
+	_, err := processor.Process(context.Background())
+	assert.NoError(t, err)
+
+	db.AssertExpectations(t)
+	lc.AssertExpectations(t)
+	w.AssertExpectations(t)
+}
+
+func TestProcessQuarantine(t *testing.T) {
+	p := parser.Parsers{"mysql": parser.NewAuditLogParser()}
+	db := new(mockDatabase)
+	lc := new(mockLogCollector)
+	w := new(mockWriter)
+
+	id := fmt.Sprintf("%s:%s", TestRdsInstanceIdentifier, "audit")
+	logLine := "20200714 07:05:25,ip-172-27-1-97,rdsadmin,localhost,26,47141561040897,QUERY,mysql,'SELECT 1',0\n"
+	verifyErr := fmt.Errorf("download of audit/server_audit.log.1 is truncated")
+
+	db.On("GetCheckpoint", id).Return(&entity.CheckpointRecord{Id: id}, nil)
+	db.On("StoreCheckpoint", &entity.CheckpointRecord{
+		LogFileTimestamp: 2,
+		Id:               id,
+		LogFileSha256:    "abc",
+	}).Return(nil).Once()
+
+	// The download fails verification every time, it is quarantined after the last attempt
+	lc.On("ValidateAndPrepareRDSInstance").Return(nil)
+	lc.On("DBType").Return("mysql")
+	for i := 0; i < maxIntegrityFailures+1; i++ {
+		lc.On("GetLogs", int64(0), []string(nil)).Return(newVerifiedLogFileReader(logLine, 2, verifyErr), nil).Once()
+	}
+	lc.On("GetLogs", int64(2), []string(nil)).Return(nil, nil).Once()
+
+	// Entries which have been read completely before the download failed may be written
+	w.On("WriteLogEntry", mock.Anything).Return(nil).Maybe()
+	w.On("DeleteLogEntry", mock.Anything).Return(nil).Maybe()
+	w.On("WriteQuarantine", entity.ManifestRecord{
+		LogFileName:      "audit/server_audit.log.1",
+		LogFileTimestamp: 2,
+		Size:             int64(len(logLine)),
+		Error:            verifyErr.Error(),
+	}, logLine).Return(nil).Once()
+	w.On("WriteManifest", entity.ManifestRecord{
+		RdsInstanceIdentifier: TestRdsInstanceIdentifier,
+		LogFileName:           "audit/server_audit.log.1",
+		LogFileTimestamp:      2,
+		Size:                  int64(len(logLine)),
+		Bytes:                 int64(len(logLine)),
+		Lines:                 1,
+		Sha256:                "abc",
+		Error:                 verifyErr.Error(),
+	}).Return(nil).Once()
+
+	processor := NewProcessor(db, lc, w, p, TestRdsInstanceIdentifier)
+	_, err := processor.Process(context.Background())
+	assert.EqualError(t, err, "log files could not be verified and have been quarantined: audit/server_audit.log.1")
+
+	db.AssertExpectations(t)
+	lc.AssertExpectations(t)
+	w.AssertExpectations(t)
+}
+
+func TestProcessQuarantineDeletesPartialEntries(t *testing.T) {
+	p := parser.Parsers{"mysql": parser.NewAuditLogParser()}
+	db := new(mockDatabase)
+	lc := new(mockLogCollector)
+	w := new(mockWriter)
+
+	id := fmt.Sprintf("%s:%s", TestRdsInstanceIdentifier, "audit")
+	logLine1 := "20200714 07:05:25,ip-172-27-1-97,rdsadmin,localhost,26,47141561040897,QUERY,mysql,'SELECT 1',0\n"
+	logLine2 := "20200714 08:05:25,ip-172-27-1-97,rdsadmin,localhost,26,47141561040898,QUERY,mysql,'SELECT 1',0\n"
+	verifyErr := fmt.Errorf("download of audit/server_audit.log.1 is truncated")
+
+	db.On("GetCheckpoint", id).Return(&entity.CheckpointRecord{Id: id}, nil)
+	db.On("StoreCheckpoint", mock.Anything).Return(nil).Once()
+
+	lc.On("ValidateAndPrepareRDSInstance").Return(nil)
+	lc.On("DBType").Return("mysql")
+	for i := 0; i < maxIntegrityFailures+1; i++ {
+		logFile := newVerifiedLogFileReader(logLine1+logLine2, 2, verifyErr)
+		logFile.Identity = "2-200-abc"
+		lc.On("GetLogs", int64(0), []string(nil)).Return(logFile, nil).Once()
+	}
+	lc.On("GetLogs", int64(2), []string{"2-200-abc"}).Return(nil, nil).Once()
+
+	// The entries written by every attempt are deleted once, when the log file is quarantined. The identity of the
+	// log file is part of their keys, so objects of other log files last written at the same time are kept.
+	w.On("WriteLogEntry", mock.Anything).Return(nil)
+	for _, hour := range []int{7, 8} {
+		w.On("DeleteLogEntry", entity.LogEntry{
+			RdsInstanceIdentifier: TestRdsInstanceIdentifier,
+			LogFileName:           "audit/server_audit.log.1",
+			LogFileIdentity:       "2-200-abc",
+			Timestamp:             entity.NewLogEntryTimestamp(2020, 7, 14, hour),
+			LogFileTimestamp:      2,
+			FirstRecordTime:       time.Date(2020, 7, 14, hour, 5, 25, 0, time.UTC),
+		}).Return(nil).Once()
+	}
+	w.On("WriteQuarantine", mock.Anything, logLine1+logLine2).Return(nil).Once()
+	w.On("WriteManifest", mock.Anything).Return(nil).Once()
+
+	processor := NewProcessor(db, lc, w, p, TestRdsInstanceIdentifier)
+	_, err := processor.Process(context.Background())
+	assert.EqualError(t, err, "log files could not be verified and have been quarantined: audit/server_audit.log.1")
+
+	db.AssertExpectations(t)
+	lc.AssertExpectations(t)
+	w.AssertExpectations(t)
+}
+
+func TestProcessStopsBeforeDeadline(t *testing.T) {
+	p := parser.Parsers{"mysql": parser.NewAuditLogParser()}
+	db := new(mockDatabase)
+	lc := new(mockLogCollector)
+	w := new(mockWriter)
+
+	id := fmt.Sprintf("%s:%s", TestRdsInstanceIdentifier, "audit")
+	logFileTimestamp1 := int64(1)
+	logFileTimestamp2 := int64(2)
+	logLine := "20200714 07:05:25,ip-172-27-1-97,rdsadmin,localhost,26,47141561040897,QUERY,mysql,'SELECT 1',0"
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	processor := NewProcessor(db, lc, w, p, TestRdsInstanceIdentifier)
+	processor.TailActiveLogFile = true
+	processor.Continuation = continuation.NewRecorder()
+
+	db.On("GetCheckpoint", id).Return(&entity.CheckpointRecord{
+		LogFileTimestamp: logFileTimestamp1,
+		Id:               id,
+	}, nil)
+	// The log file which has been started is finished and its checkpoint is stored
+	db.On("StoreCheckpoint", &entity.CheckpointRecord{
+		LogFileTimestamp: logFileTimestamp2,
+		Id:               id,
+	}).Return(nil).Once()
+
+	lc.On("ValidateAndPrepareRDSInstance").Return(nil)
+	lc.On("DBType").Return("mysql")
+	lc.On("GetLogs", logFileTimestamp1, []string(nil)).Return(newLogFileReader(logLine, logFileTimestamp2), nil).Once()
+
+	w.On("WriteLogEntry", mock.Anything).Run(func(mock.Arguments) {
+		// The deadline comes closer than the margin while the log file is processed
+		processor.DeadlineMargin = 2 * time.Hour
+	}).Return(nil).Once()
+
+	status, err := processor.Process(ctx)
 	assert.NoError(t, err)
+	assert.Equal(t, StatusPartial, status)
+	assert.Equal(t, []continuation.Instance{
+		{RdsInstanceIdentifier: TestRdsInstanceIdentifier, LogFileTimestamp: logFileTimestamp2},
+	}, processor.Continuation.Instances())
 
 	db.AssertExpectations(t)
 	lc.AssertExpectations(t)
+	lc.AssertNotCalled(t, "GetActiveLogs", mock.Anything, mock.Anything)
 	w.AssertExpectations(t)
 }
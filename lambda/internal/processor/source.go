@@ -0,0 +1,57 @@
+package processor
+
+import (
+	"rdsauditlogss3/internal/entity"
+	"rdsauditlogss3/internal/logcollector"
+	"rdsauditlogss3/internal/parser"
+)
+
+// sourceReader sets the instance and log file of the log entries read from a log file
+type sourceReader struct {
+	parser.EntryReader
+	rdsInstanceIdentifier string
+	logFileName           string
+	logFileIdentity       string
+	// skippedLines is the number of lines of the log file before the parsed data, eg. if it has been tailed before
+	skippedLines int64
+}
+
+func (p *Processor) newSourceReader(entries parser.EntryReader, logFile *logcollector.LogFileReader, skippedLines int64) *sourceReader {
+	return &sourceReader{
+		EntryReader:           entries,
+		rdsInstanceIdentifier: p.RdsInstanceIdentifier,
+		logFileName:           logFile.LogFileName,
+		logFileIdentity:       logFile.Identity,
+		skippedLines:          skippedLines,
+	}
+}
+
+func (r *sourceReader) Next() (*entity.LogEntry, error) {
+	entry, err := r.EntryReader.Next()
+	if err != nil {
+		return nil, err
+	}
+
+	entry.RdsInstanceIdentifier = r.rdsInstanceIdentifier
+	entry.LogFileName = r.logFileName
+	entry.LogFileIdentity = r.logFileIdentity
+	if r.skippedLines > 0 && entry.Events != nil {
+		entry.Events = &lineOffsetReader{AuditEventReader: entry.Events, offset: r.skippedLines}
+	}
+	return entry, nil
+}
+
+// lineOffsetReader counts the lines of audit events from the beginning of the log file
+type lineOffsetReader struct {
+	entity.AuditEventReader
+	offset int64
+}
+
+func (r *lineOffsetReader) Next() (*entity.AuditEvent, error) {
+	event, err := r.AuditEventReader.Next()
+	if err != nil {
+		return nil, err
+	}
+	event.Line += r.offset
+	return event, nil
+}
@@ -0,0 +1,32 @@
+package processor
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"rdsauditlogss3/internal/parser"
+)
+
+func TestSourceReader(t *testing.T) {
+	logLines := `20200714 07:05:30,ip-172-27-1-97,rdsadmin,localhost,26,161155,QUERY,mysql,'SELECT 2',0
+20200714 07:05:31,ip-172-27-1-97,rdsadmin,localhost,26,161156,QUERY,mysql,'SELECT 3',0
+`
+	logFile := newLogFileReader(logLines, 2)
+	logFile.LogFileName = "audit/server_audit.log.1"
+	processor := NewProcessor(nil, nil, nil, nil, TestRdsInstanceIdentifier)
+
+	entries := processor.newSourceReader(parser.NewAuditLogParser().ParseEntries(logFile, logFile.LogFileTimestamp), logFile, 1)
+	entry, err := entries.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, TestRdsInstanceIdentifier, entry.RdsInstanceIdentifier)
+	assert.Equal(t, "audit/server_audit.log.1", entry.LogFileName)
+
+	event, err := entry.Events.Next()
+	assert.NoError(t, err)
+	assert.True(t, strings.HasSuffix(event.Raw, "'SELECT 2',0"))
+	assert.Equal(t, int64(2), event.Line)
+	event, err = entry.Events.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), event.Line)
+}
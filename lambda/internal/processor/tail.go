@@ -0,0 +1,143 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"rdsauditlogss3/internal/entity"
+	"rdsauditlogss3/internal/logcollector"
+	"rdsauditlogss3/internal/parser"
+)
+
+// tailActiveLogFile processes the data written to the active log file since the last call.
+// Only complete records are processed, the beginning of a record which is still being written is kept in the checkpoint.
+func (p *Processor) tailActiveLogFile(ctx context.Context, logParser parser.Parser, checkpoint *entity.CheckpointRecord) (int, error) {
+	active := checkpoint.ActiveLogFile
+	downloaded := active.Offset + int64(len(active.PartialLine))
+
+	logFile, err := p.logcollector.GetActiveLogs(ctx, active.Marker, downloaded)
+	if err != nil {
+		return 0, fmt.Errorf("could not get active log file: %v", err)
+	}
+	if logFile == nil {
+		return 0, nil
+	}
+	defer logFile.Close()
+
+	data := &countingReader{reader: logFile}
+	logLines := newCompleteLinesReader(io.MultiReader(strings.NewReader(active.PartialLine), data))
+
+	entries := p.newSourceReader(logParser.ParseEntries(logLines, logFile.LogFileTimestamp), logFile, active.Lines)
+	writtenEntries, err := p.writeLogEntries(ctx, entries)
+	if err != nil {
+		return writtenEntries, err
+	}
+	_, err = io.Copy(ioutil.Discard, logLines)
+	if err != nil {
+		return writtenEntries, fmt.Errorf("could not read active log file: %v", err)
+	}
+
+	partialLine := logLines.PartialLine()
+	checkpoint.ActiveLogFile = entity.ActiveLogFileCheckpoint{
+		Marker:      logFile.Marker(),
+		Offset:      downloaded + data.count - int64(len(partialLine)),
+		PartialLine: string(partialLine),
+		Lines:       active.Lines + int64(strings.Count(active.PartialLine, "\n")) + data.lines - int64(bytes.Count(partialLine, []byte{'\n'})),
+	}
+	if checkpoint.ActiveLogFile == active {
+		return writtenEntries, nil
+	}
+
+	logrus.WithFields(logrus.Fields{"logfile_name": logFile.LogFileName, "offset": checkpoint.ActiveLogFile.Offset}).Info("StoreCheckpoint")
+	err = p.database.StoreCheckpoint(ctx, checkpoint)
+	if err != nil {
+		return writtenEntries, fmt.Errorf("could not save marker: %v", err)
+	}
+
+	return writtenEntries, nil
+}
+
+// skipTailedData skips the data of a rotated log file which has been processed while it was the active log file.
+// It returns the number of skipped lines.
+func skipTailedData(logFile *logcollector.LogFileReader, offset int64) (io.Reader, int64, error) {
+	if logFile.Size < offset {
+		// Better process data twice than losing it
+		logrus.WithFields(logrus.Fields{"logfile_name": logFile.LogFileName, "size": logFile.Size, "offset": offset}).Warn("Rotated log file is smaller than tailed data, processing it completely")
+		return logFile, 0, nil
+	}
+
+	skipped := &countingReader{reader: logFile}
+	_, err := io.CopyN(ioutil.Discard, skipped, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	return logFile, skipped.lines, nil
+}
+
+// countingReader counts the bytes and lines read
+type countingReader struct {
+	reader io.Reader
+	count  int64
+	lines  int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.count += int64(n)
+	c.lines += int64(bytes.Count(p[:n], []byte{'\n'}))
+	return n, err
+}
+
+// completeLinesReader only returns complete lines of the underlying reader.
+// Data after the last newline is held back and available via PartialLine once the reader is consumed,
+// like the lines of an incomplete record the parser hands back with Unread.
+type completeLinesReader struct {
+	reader  io.Reader
+	pending []byte
+	ready   []byte
+	eof     bool
+}
+
+func newCompleteLinesReader(reader io.Reader) *completeLinesReader {
+	return &completeLinesReader{reader: reader}
+}
+
+func (c *completeLinesReader) Read(p []byte) (int, error) {
+	buf := make([]byte, 32*1024)
+	for len(c.ready) == 0 {
+		if c.eof {
+			return 0, io.EOF
+		}
+
+		n, err := c.reader.Read(buf)
+		c.pending = append(c.pending, buf[:n]...)
+		if i := bytes.LastIndexByte(c.pending, '\n'); i >= 0 {
+			c.ready = append(c.ready, c.pending[:i+1]...)
+			c.pending = append(c.pending[:0], c.pending[i+1:]...)
+		}
+		if err == io.EOF {
+			c.eof = true
+		} else if err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, c.ready)
+	c.ready = c.ready[n:]
+	return n, nil
+}
+
+// Unread holds back data which has been read already
+func (c *completeLinesReader) Unread(data []byte) {
+	c.pending = append(append([]byte{}, data...), c.pending...)
+}
+
+// PartialLine returns the data after the last newline and the unread data
+func (c *completeLinesReader) PartialLine() []byte {
+	return c.pending
+}
@@ -0,0 +1,105 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// Class tells if a failed operation may succeed when it is retried
+type Class int
+
+const (
+	// Permanent errors fail again when retried
+	Permanent Class = iota
+	// Retryable errors are transient, eg. server errors and reset connections
+	Retryable
+	// Throttling errors are retried with longer delays to reduce the request rate
+	Throttling
+)
+
+func (c Class) String() string {
+	switch c {
+	case Retryable:
+		return "retryable"
+	case Throttling:
+		return "throttling"
+	default:
+		return "permanent"
+	}
+}
+
+// classifiedError is an error whose class has been set by the operation
+type classifiedError struct {
+	error
+	class Class
+}
+
+func (e *classifiedError) Unwrap() error {
+	return e.error
+}
+
+// WithClass sets the class of an error, eg. for inconsistent results which are expected to resolve
+func WithClass(err error, class Class) error {
+	if err == nil {
+		return nil
+	}
+	return &classifiedError{error: err, class: class}
+}
+
+// ClassifyStatusCode returns the class of a failed HTTP request by its response status code
+func ClassifyStatusCode(statusCode int) Class {
+	switch {
+	case statusCode == http.StatusTooManyRequests, statusCode == http.StatusServiceUnavailable:
+		return Throttling
+	case statusCode >= 500 && statusCode != http.StatusNotImplemented:
+		return Retryable
+	default:
+		return Permanent
+	}
+}
+
+// Classify returns the class of an error. Throttling, 5xx responses, reset connections and timeouts
+// are retried, all other errors are permanent.
+func Classify(err error) Class {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return Permanent
+	}
+
+	var classified *classifiedError
+	if errors.As(err, &classified) {
+		return classified.class
+	}
+
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		if request.IsErrorThrottle(awsErr) {
+			return Throttling
+		}
+		var requestFailure awserr.RequestFailure
+		if errors.As(err, &requestFailure) && requestFailure.StatusCode() != 0 {
+			if class := ClassifyStatusCode(requestFailure.StatusCode()); class != Permanent {
+				return class
+			}
+		}
+		if awsErr.Code() != request.CanceledErrorCode && request.IsErrorRetryable(awsErr) {
+			return Retryable
+		}
+		return Permanent
+	}
+
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return Retryable
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return Retryable
+	}
+	return Permanent
+}
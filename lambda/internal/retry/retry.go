@@ -0,0 +1,86 @@
+package retry
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultMaxAttempts         = 5
+	DefaultBaseDelay           = 100 * time.Millisecond
+	DefaultThrottlingBaseDelay = time.Second
+	DefaultMaxDelay            = 20 * time.Second
+)
+
+// Policy retries failed operations with exponential backoff and full jitter
+type Policy struct {
+	// MaxAttempts is the number of attempts including the first one, 1 disables retries
+	MaxAttempts int
+	// BaseDelay is the maximum delay before the first retry, it doubles with every retry up to MaxDelay
+	BaseDelay time.Duration
+	// ThrottlingBaseDelay replaces BaseDelay if the operation has been throttled
+	ThrottlingBaseDelay time.Duration
+	MaxDelay            time.Duration
+}
+
+func DefaultPolicy() Policy {
+	return Policy{
+		MaxAttempts:         DefaultMaxAttempts,
+		BaseDelay:           DefaultBaseDelay,
+		ThrottlingBaseDelay: DefaultThrottlingBaseDelay,
+		MaxDelay:            DefaultMaxDelay,
+	}
+}
+
+// Delay returns a random delay before the given retry (starting at 1) of an operation which failed with an error of class
+func (p Policy) Delay(retry int, class Class) time.Duration {
+	base := p.BaseDelay
+	if class == Throttling && p.ThrottlingBaseDelay > base {
+		base = p.ThrottlingBaseDelay
+	}
+
+	max := base
+	for i := 1; i < retry && max < p.MaxDelay; i++ {
+		max *= 2
+	}
+	if p.MaxDelay > 0 && max > p.MaxDelay {
+		max = p.MaxDelay
+	}
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(max) + 1))
+}
+
+// Do calls fn until it succeeds, fails with a permanent error or MaxAttempts is reached.
+// It does not wait for a retry which would end after the deadline of ctx, the last error is returned then.
+func (p Policy) Do(ctx context.Context, operation string, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+
+		class := Classify(err)
+		if class == Permanent || attempt >= p.MaxAttempts {
+			return err
+		}
+
+		delay := p.Delay(attempt, class)
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			return err
+		}
+		log.WithFields(log.Fields{"operation": operation, "attempt": attempt, "class": class, "delay": delay}).WithError(err).Warn("Retrying failed operation")
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package retry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/stretchr/testify/assert"
+)
+
+var testPolicy = Policy{
+	MaxAttempts:         3,
+	BaseDelay:           time.Millisecond,
+	ThrottlingBaseDelay: 2 * time.Millisecond,
+	MaxDelay:            4 * time.Millisecond,
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected Class
+	}{
+		{"other error", fmt.Errorf("some error"), Permanent},
+		{"context canceled", context.Canceled, Permanent},
+		{"classified", WithClass(fmt.Errorf("some error"), Retryable), Retryable},
+		{"wrapped classified", fmt.Errorf("wrapped: %w", WithClass(fmt.Errorf("some error"), Throttling)), Throttling},
+		{"rds throttling", awserr.NewRequestFailure(awserr.New("Throttling", "Rate exceeded", nil), 400, "id"), Throttling},
+		{"server error", awserr.NewRequestFailure(awserr.New("InternalFailure", "", nil), 500, "id"), Retryable},
+		{"not found", awserr.NewRequestFailure(awserr.New("DBInstanceNotFound", "", nil), 404, "id"), Permanent},
+		{"request canceled", awserr.New(request.CanceledErrorCode, "", context.Canceled), Permanent},
+		{"sdk connection reset", awserr.New(request.ErrCodeRequestError, "send request failed", syscall.ECONNRESET), Retryable},
+		{"connection reset", fmt.Errorf("read: %w", syscall.ECONNRESET), Retryable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Classify(tt.err))
+		})
+	}
+}
+
+func TestClassifyStatusCode(t *testing.T) {
+	assert.Equal(t, Permanent, ClassifyStatusCode(http.StatusForbidden))
+	assert.Equal(t, Throttling, ClassifyStatusCode(http.StatusTooManyRequests))
+	assert.Equal(t, Throttling, ClassifyStatusCode(http.StatusServiceUnavailable))
+	assert.Equal(t, Retryable, ClassifyStatusCode(http.StatusBadGateway))
+	assert.Equal(t, Permanent, ClassifyStatusCode(http.StatusNotImplemented))
+}
+
+func TestDelay(t *testing.T) {
+	policy := Policy{BaseDelay: 100 * time.Millisecond, ThrottlingBaseDelay: time.Second, MaxDelay: 10 * time.Second}
+	for i := 0; i < 100; i++ {
+		assert.True(t, policy.Delay(1, Retryable) <= 100*time.Millisecond)
+		assert.True(t, policy.Delay(3, Retryable) <= 400*time.Millisecond)
+		assert.True(t, policy.Delay(1, Throttling) <= time.Second)
+		assert.True(t, policy.Delay(20, Throttling) <= 10*time.Second)
+	}
+	assert.Equal(t, time.Duration(0), Policy{}.Delay(1, Retryable))
+}
+
+func TestDo(t *testing.T) {
+	attempts := 0
+	err := testPolicy.Do(context.Background(), "test", func() error {
+		attempts++
+		if attempts < 3 {
+			return WithClass(fmt.Errorf("some error"), Retryable)
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+}
+
+func TestDoMaxAttempts(t *testing.T) {
+	attempts := 0
+	someErr := WithClass(fmt.Errorf("some error"), Throttling)
+	err := testPolicy.Do(context.Background(), "test", func() error {
+		attempts++
+		return someErr
+	})
+	assert.Equal(t, someErr, err)
+	assert.Equal(t, 3, attempts)
+}
+
+func TestDoPermanentError(t *testing.T) {
+	attempts := 0
+	err := testPolicy.Do(context.Background(), "test", func() error {
+		attempts++
+		return fmt.Errorf("some error")
+	})
+	assert.EqualError(t, err, "some error")
+	assert.Equal(t, 1, attempts)
+}
+
+func TestDoDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	policy := testPolicy
+	policy.BaseDelay = time.Hour
+	policy.MaxDelay = time.Hour
+
+	attempts := 0
+	err := policy.Do(ctx, "test", func() error {
+		attempts++
+		return WithClass(fmt.Errorf("some error"), Retryable)
+	})
+	assert.EqualError(t, err, "some error")
+	assert.True(t, attempts < 3)
+}
+
+func TestSDKRetryer(t *testing.T) {
+	retryer := testPolicy.SDKRetryer()
+	assert.Equal(t, 2, retryer.MaxRetries())
+
+	newRequest := func(err error, statusCode int) *request.Request {
+		req := request.New(aws.Config{}, metadata.ClientInfo{ServiceName: "rds"}, request.Handlers{}, nil, &request.Operation{Name: "DescribeDBLogFiles"}, nil, nil)
+		req.Error = err
+		req.HTTPResponse = &http.Response{StatusCode: statusCode}
+		return req
+	}
+
+	assert.True(t, retryer.ShouldRetry(newRequest(awserr.New("Throttling", "Rate exceeded", nil), 400)))
+	assert.True(t, retryer.ShouldRetry(newRequest(awserr.New("InternalFailure", "", nil), 500)))
+	assert.False(t, retryer.ShouldRetry(newRequest(awserr.New("InvalidParameterValue", "", nil), 400)))
+	assert.True(t, retryer.RetryRules(newRequest(awserr.New("Throttling", "Rate exceeded", nil), 400)) <= 2*time.Millisecond)
+}
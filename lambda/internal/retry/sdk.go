@@ -0,0 +1,60 @@
+package retry
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	log "github.com/sirupsen/logrus"
+)
+
+// sdkRetryer lets the AWS SDK retry the requests of a client according to a policy
+type sdkRetryer struct {
+	policy Policy
+}
+
+// SDKRetryer returns a retryer for the clients of the AWS SDK, eg. set with request.WithRetryer
+func (p Policy) SDKRetryer() request.Retryer {
+	return &sdkRetryer{policy: p}
+}
+
+func (r *sdkRetryer) MaxRetries() int {
+	if r.policy.MaxAttempts < 1 {
+		return 0
+	}
+	return r.policy.MaxAttempts - 1
+}
+
+func (r *sdkRetryer) ShouldRetry(req *request.Request) bool {
+	if req.Retryable != nil {
+		return *req.Retryable
+	}
+	if deadline, ok := req.Context().Deadline(); ok && time.Until(deadline) < r.policy.BaseDelay {
+		return false
+	}
+	return classifyRequest(req) != Permanent
+}
+
+func (r *sdkRetryer) RetryRules(req *request.Request) time.Duration {
+	class := classifyRequest(req)
+	delay := r.policy.Delay(req.RetryCount+1, class)
+	log.WithFields(log.Fields{
+		"operation": req.ClientInfo.ServiceName + "." + req.Operation.Name,
+		"attempt":   req.RetryCount + 1,
+		"class":     class,
+		"delay":     delay,
+	}).WithError(req.Error).Warn("Retrying failed AWS request")
+	return delay
+}
+
+// classifyRequest returns the class of the error of a failed request, considering its response status code
+func classifyRequest(req *request.Request) Class {
+	if req.IsErrorThrottle() {
+		return Throttling
+	}
+	if req.HTTPResponse != nil {
+		if class := ClassifyStatusCode(req.HTTPResponse.StatusCode); class != Permanent {
+			return class
+		}
+	}
+	return Classify(req.Error)
+}
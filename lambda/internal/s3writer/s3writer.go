@@ -1,46 +1,192 @@
 package s3writer
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager/s3manageriface"
 	log "github.com/sirupsen/logrus"
-	"rdsauditlogss3/internal/entity"
 	"io"
+	"path"
+	"rdsauditlogss3/internal/entity"
+	"rdsauditlogss3/internal/format"
+	"strconv"
 )
 
+// s3GapRecord is the JSON document written to S3 for a gap in the audit logs
+type s3GapRecord struct {
+	RdsInstanceIdentifier string `json:"rds_instance_identifier"`
+	From                  int64  `json:"from_timestamp"`
+	To                    int64  `json:"to_timestamp"`
+	LogFileName           string `json:"logfile_name"`
+	DetectedAt            int64  `json:"detected_at"`
+}
+
+// s3ManifestRecord is the JSON document written to S3 for a downloaded log file
+type s3ManifestRecord struct {
+	RdsInstanceIdentifier string `json:"rds_instance_identifier"`
+	LogFileName           string `json:"logfile_name"`
+	LogFileTimestamp      int64  `json:"logfile_timestamp"`
+	Identity              string `json:"identity,omitempty"`
+	Size                  int64  `json:"size"`
+	Bytes                 int64  `json:"bytes"`
+	Lines                 int64  `json:"lines"`
+	Sha256                string `json:"sha256"`
+	Error                 string `json:"error,omitempty"`
+}
+
 type s3Writer struct {
+	client     s3iface.S3API
 	uploader   s3manageriface.UploaderAPI
 	bucketName string
 	s3Prefix   string
+	format     format.Format
 }
 
-func NewS3Writer(uploader s3manageriface.UploaderAPI, bucketName string, s3Prefix string) Writer {
+func NewS3Writer(client s3iface.S3API, uploader s3manageriface.UploaderAPI, bucketName string, s3Prefix string, f format.Format) Writer {
 	return &s3Writer{
+		client:     client,
 		uploader:   uploader,
 		bucketName: bucketName,
 		s3Prefix:   s3Prefix,
+		format:     f,
 	}
 }
 
-func (s *s3Writer) WriteLogEntry(data entity.LogEntry) error {
-	key := generateKey(s.s3Prefix, data.Timestamp, data.LogFileTimestamp)
+func (s *s3Writer) WriteLogEntry(ctx context.Context, data entity.LogEntry) error {
+	key := s.logEntryKey(data)
+
+	body := format.NewReader(s.format, data)
+	defer body.Close()
 
-	err := s.upload(key, data.LogLine)
+	err := s.uploadWithContentType(ctx, key, body, s.format.ContentType(), nil)
 	if err != nil {
 		return fmt.Errorf("could not upload file to S3: %v", err)
 	}
 	return nil
 }
 
-func (s *s3Writer) upload(key string, data io.Reader) error {
-	// Upload the file to S3.
-	_, err := s.uploader.Upload(&s3manager.UploadInput{
+// DeleteLogEntry deletes the object of a log entry, it succeeds if the object does not exist
+func (s *s3Writer) DeleteLogEntry(ctx context.Context, data entity.LogEntry) error {
+	key := s.logEntryKey(data)
+
+	_, err := s.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
 		Bucket: aws.String(s.bucketName),
 		Key:    aws.String(key),
-		Body:   data,
 	})
+	if err != nil {
+		return fmt.Errorf("could not delete file from S3: %v", err)
+	}
+	log.WithField("key", key).Info("File deleted from S3")
+	return nil
+}
+
+// logEntryKey returns the key of the object a log entry is written to
+func (s *s3Writer) logEntryKey(data entity.LogEntry) string {
+	if layout, ok := s.format.(format.Layout); ok {
+		return layout.ObjectKey(data)
+	}
+	return generateKey(s.s3Prefix, data.Timestamp, data.LogFileTimestamp, data.LogFileID(), s.format.Extension())
+}
+
+// WriteGapRecord writes a gap in the audit logs next to the logs, so it is kept as long as the logs
+func (s *s3Writer) WriteGapRecord(ctx context.Context, gap entity.GapRecord) error {
+	data, err := json.Marshal(&s3GapRecord{
+		RdsInstanceIdentifier: gap.RdsInstanceIdentifier,
+		From:                  gap.From,
+		To:                    gap.To,
+		LogFileName:           gap.LogFileName,
+		DetectedAt:            gap.DetectedAt,
+	})
+	if err != nil {
+		return fmt.Errorf("could not marshal gap record: %v", err)
+	}
+
+	key := fmt.Sprintf("%s/gaps/%d.json", s.s3Prefix, gap.From)
+	err = s.upload(ctx, key, bytes.NewReader(data), nil)
+	if err != nil {
+		return fmt.Errorf("could not upload gap record to S3: %v", err)
+	}
+	return nil
+}
+
+// WriteManifest writes the size and digest of a processed log file, the digest is also part of the object metadata.
+// The log objects are uploaded while the log file is downloaded, before its digest is known, so it is only part of
+// the metadata of the manifest.
+func (s *s3Writer) WriteManifest(ctx context.Context, manifest entity.ManifestRecord) error {
+	data, err := json.Marshal(newS3ManifestRecord(manifest))
+	if err != nil {
+		return fmt.Errorf("could not marshal manifest: %v", err)
+	}
+
+	key := fmt.Sprintf("%s/manifests/%d-%s.json", s.s3Prefix, manifest.LogFileTimestamp, manifest.Sha256)
+	err = s.upload(ctx, key, bytes.NewReader(data), manifestMetadata(manifest))
+	if err != nil {
+		return fmt.Errorf("could not upload manifest to S3: %v", err)
+	}
+	return nil
+}
+
+// WriteQuarantine writes the raw data of a log file which could not be verified, the reason is part of the object metadata
+func (s *s3Writer) WriteQuarantine(ctx context.Context, manifest entity.ManifestRecord, data io.Reader) error {
+	key := fmt.Sprintf("%s/quarantine/%d-%s", s.s3Prefix, manifest.LogFileTimestamp, path.Base(manifest.LogFileName))
+	err := s.upload(ctx, key, data, map[string]*string{
+		"logfile-name": aws.String(manifest.LogFileName),
+		"size":         aws.String(strconv.FormatInt(manifest.Size, 10)),
+		"error":        aws.String(manifest.Error),
+	})
+	if err != nil {
+		return fmt.Errorf("could not upload quarantined log file to S3: %v", err)
+	}
+	return nil
+}
+
+func newS3ManifestRecord(manifest entity.ManifestRecord) *s3ManifestRecord {
+	return &s3ManifestRecord{
+		RdsInstanceIdentifier: manifest.RdsInstanceIdentifier,
+		LogFileName:           manifest.LogFileName,
+		LogFileTimestamp:      manifest.LogFileTimestamp,
+		Identity:              manifest.Identity,
+		Size:                  manifest.Size,
+		Bytes:                 manifest.Bytes,
+		Lines:                 manifest.Lines,
+		Sha256:                manifest.Sha256,
+		Error:                 manifest.Error,
+	}
+}
+
+func manifestMetadata(manifest entity.ManifestRecord) map[string]*string {
+	return map[string]*string{
+		"logfile-name": aws.String(manifest.LogFileName),
+		"size":         aws.String(strconv.FormatInt(manifest.Size, 10)),
+		"bytes":        aws.String(strconv.FormatInt(manifest.Bytes, 10)),
+		"lines":        aws.String(strconv.FormatInt(manifest.Lines, 10)),
+		"sha256":       aws.String(manifest.Sha256),
+	}
+}
+
+func (s *s3Writer) upload(ctx context.Context, key string, data io.Reader, metadata map[string]*string) error {
+	return s.uploadWithContentType(ctx, key, data, "", metadata)
+}
+
+func (s *s3Writer) uploadWithContentType(ctx context.Context, key string, data io.Reader, contentType string, metadata map[string]*string) error {
+	input := &s3manager.UploadInput{
+		Bucket:   aws.String(s.bucketName),
+		Key:      aws.String(key),
+		Body:     data,
+		Metadata: metadata,
+	}
+	if contentType != "" {
+		input.ContentType = aws.String(contentType)
+	}
+
+	// Upload the file to S3.
+	_, err := s.uploader.UploadWithContext(ctx, input)
 	if err != nil {
 		return fmt.Errorf("failed to upload file, %v", err)
 	}
@@ -49,8 +195,9 @@ func (s *s3Writer) upload(key string, data io.Reader) error {
 	return nil
 }
 
-func generateKey(s3Prefix string, ts entity.LogEntryTimestamp, logFileTimestamp int64) string {
+// generateKey returns the key of a log entry, the log file ID keeps log files last written at the same time apart
+func generateKey(s3Prefix string, ts entity.LogEntryTimestamp, logFileTimestamp int64, logFileID string, extension string) string {
 	datePart := fmt.Sprintf("year=%04d/month=%02d/day=%02d/hour=%02d", ts.Year, ts.Month, ts.Day, ts.Hour)
-	filename := fmt.Sprintf("%d.log", logFileTimestamp)
+	filename := fmt.Sprintf("%d-%s.%s", logFileTimestamp, logFileID, extension)
 	return fmt.Sprintf("%s/%s/%s", s3Prefix, datePart, filename)
 }
@@ -2,12 +2,20 @@ package s3writer
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager/s3manageriface"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"rdsauditlogss3/internal/entity"
+	"rdsauditlogss3/internal/format"
+	"io/ioutil"
+	"strings"
 	"testing"
 )
 
@@ -16,11 +24,21 @@ type mockS3Uploader struct {
 	mock.Mock
 }
 
-func (m *mockS3Uploader) Upload(input *s3manager.UploadInput, _ ...func(uploader *s3manager.Uploader)) (*s3manager.UploadOutput, error) {
-	args := m.Called(input)
+func (m *mockS3Uploader) UploadWithContext(ctx aws.Context, input *s3manager.UploadInput, _ ...func(uploader *s3manager.Uploader)) (*s3manager.UploadOutput, error) {
+	args := m.MethodCalled("Upload", input)
 	return args.Get(0).(*s3manager.UploadOutput), args.Error(1)
 }
 
+type mockS3Client struct {
+	s3iface.S3API
+	mock.Mock
+}
+
+func (m *mockS3Client) DeleteObjectWithContext(ctx aws.Context, input *s3.DeleteObjectInput, _ ...request.Option) (*s3.DeleteObjectOutput, error) {
+	args := m.MethodCalled("DeleteObject", input)
+	return args.Get(0).(*s3.DeleteObjectOutput), args.Error(1)
+}
+
 const (
 	TestBucketName            = "my-bucket"
 	TestS3Prefix              = "my-rds-instance/audit-logs"
@@ -28,14 +46,15 @@ const (
 
 func TestWriteLogEntry(t *testing.T) {
 	s3Uploader := new(mockS3Uploader)
-	client := NewS3Writer(s3Uploader, TestBucketName, TestS3Prefix)
+	client := NewS3Writer(nil, s3Uploader, TestBucketName, TestS3Prefix, format.Raw{})
 
 	expectedS3Input := mock.MatchedBy(func(i *s3manager.UploadInput) bool {
-		return *i.Bucket == TestBucketName && *i.Key == fmt.Sprintf("%s/year=2020/month=07/day=13/hour=14/1595494263000.log", TestS3Prefix)
+		return *i.Bucket == TestBucketName && *i.Key == fmt.Sprintf("%s/year=2020/month=07/day=13/hour=14/1595494263000-25047f301b5b7954.log", TestS3Prefix)
 	})
 
 	s3Uploader.On("Upload", expectedS3Input).Return(&s3manager.UploadOutput{}, nil)
-	err := client.WriteLogEntry(entity.LogEntry{
+	err := client.WriteLogEntry(context.Background(), entity.LogEntry{
+		LogFileName:      "audit/server_audit.log.1",
 		Timestamp:        entity.NewLogEntryTimestamp(2020, 7, 13, 14),
 		LogLine:          bytes.NewBufferString("20200713 14:18:10,ip-172-27-2-141,monolith-web,10.160.167.194,10739612,551067709,QUERY,personio,'select * from `job_positions` where (`job_positions`.`company_id` = ? or `job_positions`.`company_id` is null) and `company_id` = ? and `id` = ? limit 1',0"),
 		LogFileTimestamp: int64(1595494263000),
@@ -43,4 +62,156 @@ func TestWriteLogEntry(t *testing.T) {
 	assert.NoError(t, err)
 
 	s3Uploader.AssertExpectations(t)
-}
\ No newline at end of file
+}
+func TestLogEntryKeyOfLogFilesWrittenAtTheSameTime(t *testing.T) {
+	client := NewS3Writer(nil, nil, TestBucketName, TestS3Prefix, format.Raw{}).(*s3Writer)
+
+	entry := func(logFileName string, identity string) entity.LogEntry {
+		return entity.LogEntry{
+			LogFileName:      logFileName,
+			LogFileIdentity:  identity,
+			Timestamp:        entity.NewLogEntryTimestamp(2020, 7, 13, 14),
+			LogFileTimestamp: int64(1595494263000),
+		}
+	}
+
+	// Log files last written at the same time don't overwrite each other
+	first := client.logEntryKey(entry("audit/audit.log.0.2020-07-13-14-00.0", "1595494263000-100-aaa"))
+	second := client.logEntryKey(entry("audit/audit.log.1.2020-07-13-14-00.0", "1595494263000-200-bbb"))
+	assert.NotEqual(t, first, second)
+	assert.True(t, strings.HasPrefix(first, TestS3Prefix+"/year=2020/month=07/day=13/hour=14/1595494263000-"))
+
+	// A renamed log file keeps its key
+	assert.Equal(t, first, client.logEntryKey(entry("audit/audit.log.0.2020-07-13-14-00.1", "1595494263000-100-aaa")))
+}
+
+func TestWriteLogEntryBody(t *testing.T) {
+	s3Uploader := new(mockS3Uploader)
+	client := NewS3Writer(nil, s3Uploader, TestBucketName, TestS3Prefix, format.Raw{})
+
+	logLine := "20200713 14:18:10,ip-172-27-2-141,monolith-web,10.160.167.194,10739612,0,CONNECT,personio,,0\n"
+	expectedS3Input := mock.MatchedBy(func(i *s3manager.UploadInput) bool {
+		body, _ := ioutil.ReadAll(i.Body)
+		return *i.ContentType == "text/plain" && string(body) == logLine
+	})
+
+	s3Uploader.On("Upload", expectedS3Input).Return(&s3manager.UploadOutput{}, nil)
+	err := client.WriteLogEntry(context.Background(), entity.LogEntry{
+		Timestamp:        entity.NewLogEntryTimestamp(2020, 7, 13, 14),
+		LogLine:          bytes.NewBufferString(logLine),
+		LogFileTimestamp: int64(1595494263000),
+	})
+	assert.NoError(t, err)
+
+	s3Uploader.AssertExpectations(t)
+}
+
+func TestWriteLogEntryLayout(t *testing.T) {
+	s3Uploader := new(mockS3Uploader)
+	ocsf, err := format.NewOCSF("rds-audit-logs", "eu-central-1", "123456789012")
+	assert.NoError(t, err)
+	client := NewS3Writer(nil, s3Uploader, TestBucketName, TestS3Prefix, ocsf)
+
+	expectedS3Input := mock.MatchedBy(func(i *s3manager.UploadInput) bool {
+		return *i.Bucket == TestBucketName && *i.Key == "ext/rds-audit-logs/region=eu-central-1/accountId=123456789012/eventDay=20200713/my-rds-instance-14-1595494263000-e3b0c44298fc1c14.parquet"
+	})
+
+	s3Uploader.On("Upload", expectedS3Input).Return(&s3manager.UploadOutput{}, nil)
+	err = client.WriteLogEntry(context.Background(), entity.LogEntry{
+		Timestamp:             entity.NewLogEntryTimestamp(2020, 7, 13, 14),
+		LogFileTimestamp:      int64(1595494263000),
+		RdsInstanceIdentifier: "my-rds-instance",
+	})
+	assert.NoError(t, err)
+
+	s3Uploader.AssertExpectations(t)
+}
+
+func TestWriteGapRecord(t *testing.T) {
+	s3Uploader := new(mockS3Uploader)
+	client := NewS3Writer(nil, s3Uploader, TestBucketName, TestS3Prefix, format.Raw{})
+
+	expectedS3Input := mock.MatchedBy(func(i *s3manager.UploadInput) bool {
+		body, _ := ioutil.ReadAll(i.Body)
+		return *i.Bucket == TestBucketName && *i.Key == fmt.Sprintf("%s/gaps/1595256406000.json", TestS3Prefix) &&
+			string(body) == `{"rds_instance_identifier":"my-rds-instance","from_timestamp":1595256406000,"to_timestamp":1595262837000,"logfile_name":"audit/server_audit.log.3","detected_at":1595263000000}`
+	})
+
+	s3Uploader.On("Upload", expectedS3Input).Return(&s3manager.UploadOutput{}, nil)
+	err := client.WriteGapRecord(context.Background(), entity.GapRecord{
+		Id:                    "my-rds-instance:gap:1595256406000",
+		RdsInstanceIdentifier: "my-rds-instance",
+		From:                  1595256406000,
+		To:                    1595262837000,
+		LogFileName:           "audit/server_audit.log.3",
+		DetectedAt:            1595263000000,
+	})
+	assert.NoError(t, err)
+
+	s3Uploader.AssertExpectations(t)
+}
+
+func TestWriteManifest(t *testing.T) {
+	s3Uploader := new(mockS3Uploader)
+	client := NewS3Writer(nil, s3Uploader, TestBucketName, TestS3Prefix, format.Raw{})
+
+	expectedS3Input := mock.MatchedBy(func(i *s3manager.UploadInput) bool {
+		return *i.Bucket == TestBucketName && *i.Key == fmt.Sprintf("%s/manifests/1595259824000-abc.json", TestS3Prefix) &&
+			*i.Metadata["sha256"] == "abc" && *i.Metadata["size"] == "1000" && *i.Metadata["bytes"] == "1000" &&
+			*i.Metadata["lines"] == "10" && *i.Metadata["logfile-name"] == "audit/server_audit.log.1"
+	})
+
+	s3Uploader.On("Upload", expectedS3Input).Return(&s3manager.UploadOutput{}, nil)
+	err := client.WriteManifest(context.Background(), entity.ManifestRecord{
+		RdsInstanceIdentifier: "my-rds-instance",
+		LogFileName:           "audit/server_audit.log.1",
+		LogFileTimestamp:      1595259824000,
+		Size:                  1000,
+		Bytes:                 1000,
+		Lines:                 10,
+		Sha256:                "abc",
+	})
+	assert.NoError(t, err)
+
+	s3Uploader.AssertExpectations(t)
+}
+
+func TestWriteQuarantine(t *testing.T) {
+	s3Uploader := new(mockS3Uploader)
+	client := NewS3Writer(nil, s3Uploader, TestBucketName, TestS3Prefix, format.Raw{})
+
+	expectedS3Input := mock.MatchedBy(func(i *s3manager.UploadInput) bool {
+		body, _ := ioutil.ReadAll(i.Body)
+		return *i.Bucket == TestBucketName && *i.Key == fmt.Sprintf("%s/quarantine/1595259824000-server_audit.log.1", TestS3Prefix) &&
+			string(body) == "truncated" && *i.Metadata["error"] == "download is truncated" && *i.Metadata["size"] == "1000"
+	})
+
+	s3Uploader.On("Upload", expectedS3Input).Return(&s3manager.UploadOutput{}, nil)
+	err := client.WriteQuarantine(context.Background(), entity.ManifestRecord{
+		LogFileName:      "audit/server_audit.log.1",
+		LogFileTimestamp: 1595259824000,
+		Size:             1000,
+		Error:            "download is truncated",
+	}, bytes.NewBufferString("truncated"))
+	assert.NoError(t, err)
+
+	s3Uploader.AssertExpectations(t)
+}
+
+func TestDeleteLogEntry(t *testing.T) {
+	s3Client := new(mockS3Client)
+	client := NewS3Writer(s3Client, new(mockS3Uploader), TestBucketName, TestS3Prefix, format.Raw{})
+
+	s3Client.On("DeleteObject", &s3.DeleteObjectInput{
+		Bucket: aws.String(TestBucketName),
+		Key:    aws.String(fmt.Sprintf("%s/year=2020/month=07/day=13/hour=14/1595494263000-25047f301b5b7954.log", TestS3Prefix)),
+	}).Return(&s3.DeleteObjectOutput{}, nil)
+	err := client.DeleteLogEntry(context.Background(), entity.LogEntry{
+		LogFileName:      "audit/server_audit.log.1",
+		Timestamp:        entity.NewLogEntryTimestamp(2020, 7, 13, 14),
+		LogFileTimestamp: int64(1595494263000),
+	})
+	assert.NoError(t, err)
+
+	s3Client.AssertExpectations(t)
+}
@@ -1,8 +1,18 @@
 package s3writer
 
-import "rdsauditlogss3/internal/entity"
+import (
+	"context"
+	"io"
+
+	"rdsauditlogss3/internal/entity"
+)
 
 // Writer is the interface for writing log entries to S3
 type Writer interface {
-	WriteLogEntry(data entity.LogEntry) error
+	WriteLogEntry(ctx context.Context, data entity.LogEntry) error
+	// DeleteLogEntry removes the object a log entry has been written to, eg. if its log file could not be verified
+	DeleteLogEntry(ctx context.Context, data entity.LogEntry) error
+	WriteGapRecord(ctx context.Context, gap entity.GapRecord) error
+	WriteManifest(ctx context.Context, manifest entity.ManifestRecord) error
+	WriteQuarantine(ctx context.Context, manifest entity.ManifestRecord, data io.Reader) error
 }
@@ -0,0 +1,204 @@
+package syslogwriter
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"rdsauditlogss3/internal/retry"
+)
+
+const (
+	DefaultTimeout = 10 * time.Second
+
+	// maxPendingSize is the size of the frames at which they are sent to the collector while an entry is written
+	maxPendingSize = 64 * 1024
+)
+
+// Sender sends syslog messages to a collector
+type Sender interface {
+	// Send queues a message, it may send the queued messages
+	Send(ctx context.Context, message string) error
+	// Flush sends all messages queued by this sender and returns once they have been written to the connection
+	Flush(ctx context.Context) error
+}
+
+// ClientOptions configures the connection to the syslog collector
+type ClientOptions struct {
+	// Address is the host:port of the collector
+	Address string
+	// TLS enables TLS, otherwise messages are sent over plain TCP
+	TLS bool
+	// CertFile and KeyFile are PEM files of the client certificate presented to the collector (optional)
+	CertFile string
+	KeyFile  string
+	// CABundle is a PEM file with certificate authorities which are trusted in addition to the system ones
+	CABundle string
+	// Timeout limits connecting and every write to the collector
+	Timeout time.Duration
+	Retry   retry.Policy
+}
+
+// Client sends RFC 5424 messages with octet-counting framing (RFC 6587) over TCP or TLS.
+// The connection is shared by the senders of all instances, every sender queues its own messages until they are flushed.
+// The connection is re-established and the queued messages are sent again if a write fails, so messages are delivered
+// at least once. It is closed at the end of every invocation, as it may not survive a freeze of the execution environment.
+type Client struct {
+	options   ClientOptions
+	tlsConfig *tls.Config
+	// mutex guards the connection while it is written, not while a failed write waits for its next attempt
+	mutex sync.Mutex
+	conn  net.Conn
+}
+
+// NewClient returns a client of the collector, it connects with the first flush after it has been created or closed
+func NewClient(options ClientOptions) (*Client, error) {
+	if options.Address == "" {
+		return nil, fmt.Errorf("syslog address must be set")
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = DefaultTimeout
+	}
+	client := &Client{options: options}
+	if !options.TLS {
+		if options.CertFile != "" {
+			return nil, fmt.Errorf("client certificate requires TLS")
+		}
+		return client, nil
+	}
+
+	host, _, err := net.SplitHostPort(options.Address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid syslog address: %v", err)
+	}
+	client.tlsConfig = &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: host,
+	}
+	if options.CertFile != "" || options.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(options.CertFile, options.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load client certificate: %v", err)
+		}
+		client.tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if options.CABundle != "" {
+		pem, err := ioutil.ReadFile(options.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("could not read CA bundle: %v", err)
+		}
+		rootCAs, err := x509.SystemCertPool()
+		if err != nil {
+			rootCAs = x509.NewCertPool()
+		}
+		if !rootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", options.CABundle)
+		}
+		client.tlsConfig.RootCAs = rootCAs
+	}
+	return client, nil
+}
+
+// NewSender returns a sender queuing the messages of one writer, it must not be used concurrently
+func (c *Client) NewSender() Sender {
+	return &clientSender{client: c}
+}
+
+// clientSender queues the frames of the messages sent by one writer, so a flush only waits for its own messages
+type clientSender struct {
+	client  *Client
+	pending bytes.Buffer
+}
+
+// Send queues the frame of a message, the queued frames are sent once they exceed maxPendingSize
+func (s *clientSender) Send(ctx context.Context, message string) error {
+	s.pending.WriteString(strconv.Itoa(len(message)))
+	s.pending.WriteByte(' ')
+	s.pending.WriteString(message)
+	if s.pending.Len() < maxPendingSize {
+		return nil
+	}
+	return s.Flush(ctx)
+}
+
+// Flush writes the queued frames to the connection, it reconnects and writes them again if a write fails
+func (s *clientSender) Flush(ctx context.Context) error {
+	if s.pending.Len() == 0 {
+		return nil
+	}
+	err := s.client.options.Retry.Do(ctx, "syslog", func() error {
+		return s.client.write(ctx, s.pending.Bytes())
+	})
+	if err != nil {
+		return err
+	}
+	s.pending.Reset()
+	return nil
+}
+
+// write makes a single attempt to write frames to the connection, it connects first if there is no connection
+func (c *Client) write(ctx context.Context, frames []byte) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	err := c.connect(ctx)
+	if err != nil {
+		return retry.WithClass(err, retry.Retryable)
+	}
+	err = c.conn.SetWriteDeadline(time.Now().Add(c.options.Timeout))
+	if err == nil {
+		_, err = c.conn.Write(frames)
+	}
+	if err != nil {
+		c.close()
+		return retry.WithClass(fmt.Errorf("could not write to syslog collector: %v", err), retry.Retryable)
+	}
+	return nil
+}
+
+// Close closes the connection, queued messages are kept and sent on a new connection with the next flush
+func (c *Client) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.close()
+}
+
+func (c *Client) close() error {
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+func (c *Client) connect(ctx context.Context) error {
+	if c.conn != nil {
+		return nil
+	}
+	dialer := &net.Dialer{Timeout: c.options.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", c.options.Address)
+	if err != nil {
+		return fmt.Errorf("could not connect to syslog collector: %v", err)
+	}
+	if c.tlsConfig != nil {
+		tlsConn := tls.Client(conn, c.tlsConfig)
+		err = tlsConn.SetDeadline(time.Now().Add(c.options.Timeout))
+		if err == nil {
+			err = tlsConn.Handshake()
+		}
+		if err != nil {
+			conn.Close()
+			return fmt.Errorf("could not connect to syslog collector: %v", err)
+		}
+		conn = tlsConn
+	}
+	c.conn = conn
+	return nil
+}
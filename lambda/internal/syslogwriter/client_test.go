@@ -0,0 +1,225 @@
+package syslogwriter
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"rdsauditlogss3/internal/retry"
+)
+
+// readFrame reads an octet-counted frame
+func readFrame(r *bufio.Reader) (string, error) {
+	length, err := r.ReadString(' ')
+	if err != nil {
+		return "", err
+	}
+	n, err := strconv.Atoi(length[:len(length)-1])
+	if err != nil {
+		return "", err
+	}
+	message := make([]byte, n)
+	_, err = io.ReadFull(r, message)
+	return string(message), err
+}
+
+// acceptFrames returns the frames received on the connections accepted by listener, one slice per connection
+func acceptFrames(listener net.Listener, connections int, framesPerConnection int) <-chan []string {
+	result := make(chan []string, connections)
+	go func() {
+		for i := 0; i < connections; i++ {
+			conn, err := listener.Accept()
+			if err != nil {
+				close(result)
+				return
+			}
+			r := bufio.NewReader(conn)
+			var frames []string
+			for len(frames) < framesPerConnection {
+				frame, err := readFrame(r)
+				if err != nil {
+					break
+				}
+				frames = append(frames, frame)
+			}
+			conn.Close()
+			result <- frames
+		}
+	}()
+	return result
+}
+
+func TestClientFlush(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+	frames := acceptFrames(listener, 1, 2)
+
+	client, err := NewClient(ClientOptions{Address: listener.Addr().String()})
+	assert.NoError(t, err)
+	defer client.Close()
+
+	sender := client.NewSender()
+	assert.NoError(t, sender.Send(context.Background(), "<110>1 - - - - - - first"))
+	assert.NoError(t, sender.Send(context.Background(), "<110>1 - - - - - - zweite ü"))
+	assert.NoError(t, sender.Flush(context.Background()))
+
+	assert.Equal(t, []string{"<110>1 - - - - - - first", "<110>1 - - - - - - zweite ü"}, <-frames)
+}
+
+func TestClientReconnect(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+	frames := acceptFrames(listener, 2, 1)
+
+	client, err := NewClient(ClientOptions{
+		Address: listener.Addr().String(),
+		Retry:   retry.Policy{MaxAttempts: 2, BaseDelay: time.Millisecond},
+	})
+	assert.NoError(t, err)
+	defer client.Close()
+
+	sender := client.NewSender()
+	assert.NoError(t, sender.Send(context.Background(), "first"))
+	assert.NoError(t, sender.Flush(context.Background()))
+	assert.Equal(t, []string{"first"}, <-frames)
+
+	// The write to the broken connection fails, the message is sent again on a new connection
+	client.conn.Close()
+	assert.NoError(t, sender.Send(context.Background(), "second"))
+	assert.NoError(t, sender.Flush(context.Background()))
+	assert.Equal(t, []string{"second"}, <-frames)
+}
+
+func TestClientSendersFlushOwnMessages(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+	frames := acceptFrames(listener, 2, 1)
+
+	client, err := NewClient(ClientOptions{Address: listener.Addr().String()})
+	assert.NoError(t, err)
+	defer client.Close()
+
+	first := client.NewSender()
+	second := client.NewSender()
+	assert.NoError(t, first.Send(context.Background(), "first"))
+	assert.NoError(t, second.Send(context.Background(), "second"))
+	assert.NoError(t, second.Flush(context.Background()))
+	assert.Equal(t, []string{"second"}, <-frames)
+
+	// The connection is closed at the end of an invocation, the next flush connects again
+	assert.NoError(t, client.Close())
+	assert.NoError(t, first.Flush(context.Background()))
+	assert.Equal(t, []string{"first"}, <-frames)
+}
+
+func TestClientFlushError(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	address := listener.Addr().String()
+	listener.Close()
+
+	client, err := NewClient(ClientOptions{Address: address, Retry: retry.Policy{MaxAttempts: 2, BaseDelay: time.Millisecond}})
+	assert.NoError(t, err)
+
+	sender := client.NewSender()
+	assert.NoError(t, sender.Send(context.Background(), "message"))
+	err = sender.Flush(context.Background())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "could not connect to syslog collector")
+	assert.NotZero(t, sender.(*clientSender).pending.Len())
+}
+
+func TestClientTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "syslogwriter")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeCertificate(t, dir)
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	assert.NoError(t, err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	assert.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	})
+	assert.NoError(t, err)
+	defer listener.Close()
+	frames := acceptFrames(listener, 1, 1)
+
+	client, err := NewClient(ClientOptions{
+		Address:  listener.Addr().String(),
+		TLS:      true,
+		CertFile: certFile,
+		KeyFile:  keyFile,
+		CABundle: certFile,
+	})
+	assert.NoError(t, err)
+	defer client.Close()
+
+	sender := client.NewSender()
+	assert.NoError(t, sender.Send(context.Background(), "message"))
+	assert.NoError(t, sender.Flush(context.Background()))
+	assert.Equal(t, []string{"message"}, <-frames)
+}
+
+func TestNewClientInvalidOptions(t *testing.T) {
+	_, err := NewClient(ClientOptions{})
+	assert.EqualError(t, err, "syslog address must be set")
+
+	_, err = NewClient(ClientOptions{Address: "localhost:6514", CertFile: "client.pem"})
+	assert.EqualError(t, err, "client certificate requires TLS")
+
+	_, err = NewClient(ClientOptions{Address: "localhost:6514", TLS: true, CertFile: "missing.pem", KeyFile: "missing.key"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "could not load client certificate")
+}
+
+// writeCertificate writes a self-signed certificate for 127.0.0.1 which is used by the collector and the client
+func writeCertificate(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "syslog"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	assert.NoError(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.NoError(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	return certFile, keyFile
+}
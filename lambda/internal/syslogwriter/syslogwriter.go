@@ -0,0 +1,102 @@
+package syslogwriter
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"rdsauditlogss3/internal/entity"
+	"rdsauditlogss3/internal/format"
+	"rdsauditlogss3/internal/s3writer"
+)
+
+// syslogWriter forwards the audit events of the log entries to a syslog collector while they are written by the next
+// writer. Gap records, manifests, quarantined log files and deleted log entries are only handled by the next writer,
+// audit events which have been forwarded are not recalled.
+type syslogWriter struct {
+	s3writer.Writer
+	sender Sender
+	cef    format.CEF
+}
+
+// NewSyslogWriter returns a writer sending every audit event as CEF message to sender in addition to writing it with next.
+// WriteLogEntry returns once the messages have been flushed, so the checkpoint is only stored after their delivery.
+func NewSyslogWriter(sender Sender, next s3writer.Writer) s3writer.Writer {
+	return &syslogWriter{
+		Writer: next,
+		sender: sender,
+	}
+}
+
+func (s *syslogWriter) WriteLogEntry(ctx context.Context, data entity.LogEntry) error {
+	if data.Events == nil {
+		return fmt.Errorf("log entry has no audit events")
+	}
+	events := &forwardingEventReader{
+		events:  data.Events,
+		forward: func(event *entity.AuditEvent) error { return s.sender.Send(ctx, s.cef.SyslogMessage(data, event)) },
+	}
+	// Both readers forward the events, whichever is read by the format of the next writer
+	data.Events = events
+	data.LogLine = &rawLineReader{events: events}
+
+	err := s.Writer.WriteLogEntry(ctx, data)
+	if err != nil {
+		return err
+	}
+
+	// Forward the events the next writer has not read
+	for {
+		_, err := events.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("could not forward audit events: %v", err)
+		}
+	}
+	err = s.sender.Flush(ctx)
+	if err != nil {
+		return fmt.Errorf("could not send audit events to syslog: %v", err)
+	}
+	return nil
+}
+
+// forwardingEventReader forwards every event read
+type forwardingEventReader struct {
+	events  entity.AuditEventReader
+	forward func(event *entity.AuditEvent) error
+}
+
+func (f *forwardingEventReader) Next() (*entity.AuditEvent, error) {
+	event, err := f.events.Next()
+	if err != nil {
+		return nil, err
+	}
+	err = f.forward(event)
+	if err != nil {
+		return nil, fmt.Errorf("could not send audit event to syslog: %v", err)
+	}
+	return event, nil
+}
+
+// rawLineReader reads the records of audit events as written to the log file, one per line
+type rawLineReader struct {
+	events entity.AuditEventReader
+	buf    []byte
+}
+
+func (r *rawLineReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		event, err := r.events.Next()
+		if err != nil {
+			return 0, err
+		}
+		r.buf = append(r.buf[:0], event.Raw...)
+		r.buf = append(r.buf, '\n')
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
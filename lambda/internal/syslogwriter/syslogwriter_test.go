@@ -0,0 +1,163 @@
+package syslogwriter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"rdsauditlogss3/internal/entity"
+	"rdsauditlogss3/internal/s3writer"
+)
+
+type mockSender struct {
+	messages []string
+	flushed  int
+	err      error
+}
+
+func (m *mockSender) Send(_ context.Context, message string) error {
+	m.messages = append(m.messages, message)
+	return m.err
+}
+
+func (m *mockSender) Flush(_ context.Context) error {
+	m.flushed = len(m.messages)
+	return m.err
+}
+
+type mockWriter struct {
+	s3writer.Writer
+	mock.Mock
+	// readLines reads the LogLine of the entry instead of its events
+	readLines bool
+	read      string
+	events    int
+}
+
+func (m *mockWriter) WriteLogEntry(_ context.Context, data entity.LogEntry) error {
+	if m.readLines {
+		data, err := ioutil.ReadAll(data.LogLine)
+		m.read = string(data)
+		if err != nil {
+			return err
+		}
+	} else {
+		event, err := data.Events.Next()
+		if err != nil {
+			return err
+		}
+		m.events++
+		m.read = event.Raw
+	}
+	return m.MethodCalled("WriteLogEntry").Error(0)
+}
+
+func (m *mockWriter) WriteGapRecord(_ context.Context, gap entity.GapRecord) error {
+	return m.MethodCalled("WriteGapRecord", gap).Error(0)
+}
+
+// eventSlice returns the events one after another
+type eventSlice []*entity.AuditEvent
+
+func (s *eventSlice) Next() (*entity.AuditEvent, error) {
+	if len(*s) == 0 {
+		return nil, io.EOF
+	}
+	event := (*s)[0]
+	*s = (*s)[1:]
+	return event, nil
+}
+
+func testEntry() entity.LogEntry {
+	return entity.LogEntry{
+		RdsInstanceIdentifier: "my-instance",
+		LogFileName:           "audit/server_audit.log.1",
+		Timestamp:             entity.NewLogEntryTimestamp(2020, 7, 14, 10),
+		Events: &eventSlice{
+			{
+				Timestamp:    time.Date(2020, 7, 14, 10, 30, 2, 0, time.UTC),
+				ConnectionID: 33303,
+				Operation:    entity.OperationConnect,
+				Raw:          "20200714 10:30:02,ip-172-27-1-97,admin,10.120.182.212,33303,0,CONNECT,rdslogstest,,0",
+				Line:         1,
+			},
+			{
+				Timestamp:    time.Date(2020, 7, 14, 10, 30, 3, 0, time.UTC),
+				ConnectionID: 33303,
+				Operation:    entity.OperationDisconnect,
+				Raw:          "20200714 10:30:03,ip-172-27-1-97,admin,10.120.182.212,33303,0,DISCONNECT,rdslogstest,,0",
+				Line:         2,
+			},
+		},
+	}
+}
+
+func TestWriteLogEntryRaw(t *testing.T) {
+	sender := &mockSender{}
+	next := &mockWriter{readLines: true}
+	next.On("WriteLogEntry").Return(nil)
+
+	err := NewSyslogWriter(sender, next).WriteLogEntry(context.Background(), testEntry())
+	assert.NoError(t, err)
+
+	assert.Equal(t, "20200714 10:30:02,ip-172-27-1-97,admin,10.120.182.212,33303,0,CONNECT,rdslogstest,,0\n"+
+		"20200714 10:30:03,ip-172-27-1-97,admin,10.120.182.212,33303,0,DISCONNECT,rdslogstest,,0\n", next.read)
+	assert.Len(t, sender.messages, 2)
+	assert.Regexp(t, `^<110>1 2020-07-14T10:30:02Z my-instance rds-audit-logs-s3 33303 CONNECT - CEF:0\|`, sender.messages[0])
+	assert.Regexp(t, `^<110>1 2020-07-14T10:30:03Z my-instance rds-audit-logs-s3 33303 DISCONNECT - CEF:0\|`, sender.messages[1])
+	assert.Equal(t, 2, sender.flushed)
+}
+
+func TestWriteLogEntryForwardsUnreadEvents(t *testing.T) {
+	sender := &mockSender{}
+	next := &mockWriter{}
+	next.On("WriteLogEntry").Return(nil)
+
+	err := NewSyslogWriter(sender, next).WriteLogEntry(context.Background(), testEntry())
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, next.events)
+	assert.Len(t, sender.messages, 2)
+	assert.Equal(t, 2, sender.flushed)
+}
+
+func TestWriteLogEntryNextError(t *testing.T) {
+	sender := &mockSender{}
+	next := &mockWriter{}
+	next.On("WriteLogEntry").Return(fmt.Errorf("could not upload file to S3"))
+
+	err := NewSyslogWriter(sender, next).WriteLogEntry(context.Background(), testEntry())
+	assert.EqualError(t, err, "could not upload file to S3")
+	assert.Zero(t, sender.flushed)
+}
+
+func TestWriteLogEntrySendError(t *testing.T) {
+	sender := &mockSender{err: fmt.Errorf("connection refused")}
+	next := &mockWriter{}
+
+	err := NewSyslogWriter(sender, next).WriteLogEntry(context.Background(), testEntry())
+	assert.EqualError(t, err, "could not send audit event to syslog: connection refused")
+	next.AssertNotCalled(t, "WriteLogEntry")
+}
+
+func TestWriteLogEntryWithoutEvents(t *testing.T) {
+	err := NewSyslogWriter(&mockSender{}, &mockWriter{}).WriteLogEntry(context.Background(), entity.LogEntry{})
+	assert.EqualError(t, err, "log entry has no audit events")
+}
+
+func TestWriteGapRecordIsNotForwarded(t *testing.T) {
+	sender := &mockSender{}
+	next := &mockWriter{}
+	gap := entity.GapRecord{RdsInstanceIdentifier: "my-instance"}
+	next.On("WriteGapRecord", gap).Return(nil)
+
+	err := NewSyslogWriter(sender, next).WriteGapRecord(context.Background(), gap)
+	assert.NoError(t, err)
+	assert.Empty(t, sender.messages)
+	next.AssertExpectations(t)
+}
@@ -1,44 +1,299 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"path"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-lambda-go/lambdacontext"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
+	awslambda "github.com/aws/aws-sdk-go/service/lambda"
 	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/kelseyhightower/envconfig"
 	log "github.com/sirupsen/logrus"
+	"rdsauditlogss3/internal/continuation"
 	"rdsauditlogss3/internal/database"
+	"rdsauditlogss3/internal/format"
 	"rdsauditlogss3/internal/logcollector"
 	"rdsauditlogss3/internal/parser"
 	"rdsauditlogss3/internal/processor"
+	"rdsauditlogss3/internal/retry"
 	"rdsauditlogss3/internal/s3writer"
+	"rdsauditlogss3/internal/syslogwriter"
 )
 
 // HandlerConfig holds the configuration for the lambda function
 type HandlerConfig struct {
-	RdsInstanceIdentifier string `envconfig:"RDS_INSTANCE_IDENTIFIER" required:"true" desc:"Identifier of the RDS instance"`
-	S3BucketName          string `envconfig:"S3_BUCKET_NAME" required:"true" desc:"Name of the bucket to write logs to"`
-	DynamoDbTableName     string `envconfig:"DYNAMODB_TABLE_NAME" required:"true" desc:"DynamoDb table name"`
-	AwsRegion             string `envconfig:"AWS_REGION" required:"true" desc:"AWS region"`
-	Debug                 bool   `envconfig:"DEBUG" required:"true" desc:"Enable debug mode."`
+	RdsInstanceIdentifier  []string         `envconfig:"RDS_INSTANCE_IDENTIFIER" desc:"Comma separated identifiers of the RDS instances"`
+	RdsClusterIdentifier   string           `envconfig:"RDS_CLUSTER_IDENTIFIER" desc:"Identifier of the Aurora cluster, logs of all cluster members are processed"`
+	DiscoveryTag           string           `envconfig:"DISCOVERY_TAG" desc:"Tag (key=value) of the RDS instances to discover and get logs for"`
+	S3BucketName           string           `envconfig:"S3_BUCKET_NAME" required:"true" desc:"Name of the bucket to write logs to"`
+	DynamoDbTableName      string           `envconfig:"DYNAMODB_TABLE_NAME" required:"true" desc:"DynamoDb table name"`
+	AwsRegion              string           `envconfig:"AWS_REGION" required:"true" desc:"AWS region"`
+	PgLogLinePrefix        string           `envconfig:"PG_LOG_LINE_PREFIX" default:"%t:%r:%u@%d:[%p]:" desc:"log_line_prefix of PostgreSQL instances"`
+	PgLogTimezone          string           `envconfig:"PG_LOG_TIMEZONE" default:"UTC" desc:"log_timezone of PostgreSQL instances"`
+	Concurrency            int              `envconfig:"CONCURRENCY" default:"4" desc:"Number of RDS instances processed at the same time"`
+	TailActiveLogFile      bool             `envconfig:"TAIL_ACTIVE_LOG_FILE" default:"false" desc:"Process the active log file before it is rotated"`
+	GapTolerance           time.Duration    `envconfig:"GAP_TOLERANCE" default:"1m" desc:"Time between two log files which is not reported as gap if log files have been lost"`
+	DeadlineMargin         time.Duration    `envconfig:"DEADLINE_MARGIN" default:"1m" desc:"Time left before the Lambda timeout at which no new log file is started"`
+	Continuation           string           `envconfig:"CONTINUATION" default:"none" desc:"How processing is continued if it stopped before the Lambda timeout: none, lambda or sqs"`
+	ContinuationQueueURL   string           `envconfig:"CONTINUATION_QUEUE_URL" desc:"URL of the queue triggering the lambda function if CONTINUATION is sqs"`
+	MaxContinuations       int              `envconfig:"MAX_CONTINUATIONS" default:"10" desc:"Maximum number of invocations continued in a row"`
+	DownloadStrategy       string           `envconfig:"DOWNLOAD_STRATEGY" default:"complete" desc:"How log files are downloaded: complete, portion or auto"`
+	OutputFormat           string           `envconfig:"OUTPUT_FORMAT" default:"raw" desc:"Format of the log objects written to S3: raw, json, ecs, cef, parquet, avro or ocsf"`
+	ParquetCompression     string           `envconfig:"PARQUET_COMPRESSION" default:"snappy" desc:"Compression of the columns of Parquet files: snappy or zstd"`
+	ParquetRowGroupSize    int64            `envconfig:"PARQUET_ROW_GROUP_SIZE" default:"67108864" desc:"Size of the row groups of Parquet files in bytes"`
+	AvroCompression        string           `envconfig:"AVRO_COMPRESSION" default:"deflate" desc:"Compression of the blocks of Avro files: null, deflate or snappy"`
+	SecurityLakeSource     string           `envconfig:"SECURITY_LAKE_CUSTOM_SOURCE" desc:"Name of the custom source in Security Lake if OUTPUT_FORMAT is ocsf"`
+	SyslogAddress          string           `envconfig:"SYSLOG_ADDRESS" desc:"host:port of a syslog collector the audit events are forwarded to in addition to S3"`
+	SyslogTLS              bool             `envconfig:"SYSLOG_TLS" default:"true" desc:"Connect to the syslog collector with TLS, otherwise plain TCP"`
+	SyslogClientCert       string           `envconfig:"SYSLOG_CLIENT_CERT" desc:"PEM file of the client certificate presented to the syslog collector"`
+	SyslogClientKey        string           `envconfig:"SYSLOG_CLIENT_KEY" desc:"PEM file of the key of the client certificate"`
+	SyslogCABundle         string           `envconfig:"SYSLOG_CA_BUNDLE" desc:"PEM file with certificate authorities of the syslog collector"`
+	SyslogTimeout          time.Duration    `envconfig:"SYSLOG_TIMEOUT" default:"10s" desc:"Timeout of connecting and writing to the syslog collector"`
+	SyslogMaxAttempts      int              `envconfig:"SYSLOG_MAX_ATTEMPTS" default:"5" desc:"Maximum number of attempts of sending to the syslog collector"`
+	RdsEndpoint            string           `envconfig:"RDS_ENDPOINT" desc:"Endpoint of RDS instead of the regional one"`
+	S3Endpoint             string           `envconfig:"S3_ENDPOINT" desc:"Endpoint of S3 instead of the regional one"`
+	S3ForcePathStyle       bool             `envconfig:"S3_FORCE_PATH_STYLE" default:"false" desc:"Use path-style S3 URLs, eg. for S3-compatible stores"`
+	DynamoDbEndpoint       string           `envconfig:"DYNAMODB_ENDPOINT" desc:"Endpoint of DynamoDB instead of the regional one"`
+	RdsRoleArn             string           `envconfig:"RDS_ROLE_ARN" desc:"Role assumed for RDS API calls and downloading log files, eg. for instances in another account"`
+	RdsExternalID          string           `envconfig:"RDS_EXTERNAL_ID" desc:"External ID for assuming RDS_ROLE_ARN"`
+	RdsInstanceRoleArns    instanceSettings `envconfig:"RDS_INSTANCE_ROLE_ARNS" desc:"Comma separated instance=role ARN pairs overriding RDS_ROLE_ARN for single instances"`
+	RdsInstanceExternalIDs instanceSettings `envconfig:"RDS_INSTANCE_EXTERNAL_IDS" desc:"Comma separated instance=external ID pairs overriding RDS_EXTERNAL_ID for single instances"`
+	RetryBaseDelay         time.Duration    `envconfig:"RETRY_BASE_DELAY" default:"100ms" desc:"Maximum delay before the first retry of a failed request, it doubles with every retry"`
+	RetryThrottlingDelay   time.Duration    `envconfig:"RETRY_THROTTLING_DELAY" default:"1s" desc:"Maximum delay before the first retry of a throttled request"`
+	RetryMaxDelay          time.Duration    `envconfig:"RETRY_MAX_DELAY" default:"20s" desc:"Maximum delay between two attempts of a request"`
+	RdsMaxAttempts         int              `envconfig:"RDS_MAX_ATTEMPTS" default:"5" desc:"Maximum number of attempts of requests to RDS"`
+	S3MaxAttempts          int              `envconfig:"S3_MAX_ATTEMPTS" default:"5" desc:"Maximum number of attempts of requests to S3"`
+	DynamoDbMaxAttempts    int              `envconfig:"DYNAMODB_MAX_ATTEMPTS" default:"5" desc:"Maximum number of attempts of requests to DynamoDB"`
+	ProxyURL               string           `envconfig:"PROXY_URL" desc:"Proxy for all requests to AWS, HTTPS_PROXY is used if not set"`
+	TLSCABundle            string           `envconfig:"TLS_CA_BUNDLE" desc:"PEM file with additional certificate authorities"`
+	TLSInsecureSkipVerify  bool             `envconfig:"TLS_INSECURE_SKIP_VERIFY" default:"false" desc:"Disable TLS certificate verification, only for development"`
+	Debug                  bool             `envconfig:"DEBUG" required:"true" desc:"Enable debug mode."`
+}
+
+// instanceSettings holds a setting per RDS instance, it is configured as comma separated instance=value pairs
+type instanceSettings map[string]string
+
+// Decode parses the instance=value pairs, values may contain colons unlike envconfig's map format
+func (s *instanceSettings) Decode(value string) error {
+	settings := make(instanceSettings)
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("invalid instance setting %q, must have the format instance=value", pair)
+		}
+		settings[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	*s = settings
+	return nil
+}
+
+// assumeRoleOptions returns the role to assume for an RDS instance, an empty identifier returns the default role
+func (c *HandlerConfig) assumeRoleOptions(rdsInstanceIdentifier string) logcollector.AssumeRoleOptions {
+	options := logcollector.AssumeRoleOptions{
+		RoleARN:    c.RdsRoleArn,
+		ExternalID: c.RdsExternalID,
+	}
+	if roleARN, ok := c.RdsInstanceRoleArns[rdsInstanceIdentifier]; ok {
+		options.RoleARN = roleARN
+	}
+	if externalID, ok := c.RdsInstanceExternalIDs[rdsInstanceIdentifier]; ok {
+		options.ExternalID = externalID
+	}
+	return options
+}
+
+// splitInstanceKey splits the key of an RDS instance of the format [<account>:]<instance> into its account and identifier
+func splitInstanceKey(key string) (string, string) {
+	if i := strings.Index(key, ":"); i >= 0 {
+		return key[:i], key[i+1:]
+	}
+	return "", key
+}
+
+// instanceAccount returns the account of an RDS instance, which is the account of the role assumed for it or the
+// account of the lambda function. An instance qualified with an account must be accessed with a role of that account.
+func (c *HandlerConfig) instanceAccount(key string, lambdaAccountID string) (string, error) {
+	qualifier, _ := splitInstanceKey(key)
+	roleARN := c.assumeRoleOptions(key).RoleARN
+	if roleARN == "" {
+		if qualifier != "" && qualifier != lambdaAccountID {
+			return "", fmt.Errorf("RDS instance %s is in another account, but no role is assumed for it", key)
+		}
+		return lambdaAccountID, nil
+	}
+
+	parsed, err := arn.Parse(roleARN)
+	if err != nil {
+		return "", fmt.Errorf("invalid role ARN of RDS instance %s: %v", key, err)
+	}
+	if qualifier != "" && qualifier != parsed.AccountID {
+		return "", fmt.Errorf("RDS instance %s is qualified with another account than its role %s", key, roleARN)
+	}
+	return parsed.AccountID, nil
+}
+
+// validateRoles makes sure the configured roles can be assumed for the instances, so a misconfiguration is reported
+// at startup instead of failing the instances in every invocation
+func (c *HandlerConfig) validateRoles(lambdaAccountID string) error {
+	if c.RdsRoleArn != "" {
+		if _, err := arn.Parse(c.RdsRoleArn); err != nil {
+			return fmt.Errorf("invalid RDS_ROLE_ARN: %v", err)
+		}
+	}
+	for key := range c.RdsInstanceRoleArns {
+		if _, err := c.instanceAccount(key, lambdaAccountID); err != nil {
+			return err
+		}
+	}
+	for _, key := range c.RdsInstanceIdentifier {
+		if _, err := c.instanceAccount(key, lambdaAccountID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// needsAccountID returns true if the account of the lambda function is needed to tell the accounts of the instances apart
+func (c *HandlerConfig) needsAccountID() bool {
+	if c.OutputFormat == "ocsf" || c.DiscoveryTag != "" || c.RdsRoleArn != "" || len(c.RdsInstanceRoleArns) > 0 {
+		return true
+	}
+	for _, key := range c.RdsInstanceIdentifier {
+		if strings.Contains(key, ":") {
+			return true
+		}
+	}
+	return false
+}
+
+// retryPolicy returns the retry policy of a service with the configured delays
+func (c *HandlerConfig) retryPolicy(maxAttempts int) retry.Policy {
+	return retry.Policy{
+		MaxAttempts:         maxAttempts,
+		BaseDelay:           c.RetryBaseDelay,
+		ThrottlingBaseDelay: c.RetryThrottlingDelay,
+		MaxDelay:            c.RetryMaxDelay,
+	}
 }
 
 type lambdaHandler struct {
-	processor *processor.Processor
+	processor processor.GroupProcessor
+	// continuer starts the next invocation if processing stopped before the deadline, it is nil if disabled
+	continuer        continuation.Continuer
+	maxContinuations int
+	// stopped records the instances which stopped before the deadline in the current invocation
+	stopped *continuation.Recorder
+	// syslog is closed at the end of every invocation, it is nil if audit events are not forwarded
+	syslog *syslogwriter.Client
+}
+
+// HandlerEvent is the payload of the scheduled event, an asynchronous continuation or the messages of the continuation queue
+type HandlerEvent struct {
+	continuation.Event
+	Records []struct {
+		Body string `json:"body"`
+	} `json:"Records"`
+}
+
+// previousContinuation returns the continuation of the previous invocation or nil for scheduled invocations
+func (e HandlerEvent) previousContinuation() (*continuation.Continuation, error) {
+	previous := e.Continuation
+	for _, record := range e.Records {
+		var event continuation.Event
+		err := json.Unmarshal([]byte(record.Body), &event)
+		if err != nil {
+			return nil, fmt.Errorf("could not unmarshal continuation: %v", err)
+		}
+		// Messages are expected one at a time, otherwise the longest chain is continued
+		if previous == nil || (event.Continuation != nil && event.Continuation.Chain > previous.Chain) {
+			previous = event.Continuation
+		}
+	}
+	return previous, nil
+}
+
+// HandlerResult is returned by the lambda function if no error occurred
+type HandlerResult struct {
+	// Status is "partial" if processing stopped before the Lambda timeout, the next invocation continues there
+	Status processor.Status `json:"status"`
+	// Continued is set if the next invocation has been started to continue processing
+	Continued bool `json:"continued"`
 }
 
 // Handler is the handler registered as the lambda function handler
-func (lh *lambdaHandler) Handler() error {
-	err := lh.processor.Process()
+func (lh *lambdaHandler) Handler(ctx context.Context, event HandlerEvent) (HandlerResult, error) {
+	previous, err := event.previousContinuation()
 	if err != nil {
 		log.WithError(err).Errorf("Error in Lambda function")
-		return fmt.Errorf("error in Lambda function")
+		return HandlerResult{}, fmt.Errorf("error in Lambda function")
 	}
-	return nil
+	if previous != nil {
+		log.WithField("chain", previous.Chain).Info("Continuing previous invocation")
+	}
+
+	if lh.syslog != nil {
+		// The connection may be broken while the execution environment is frozen between invocations without
+		// writes failing, so every invocation connects again
+		defer lh.syslog.Close()
+	}
+
+	lh.stopped = continuation.NewRecorder()
+	var status processor.Status
+	if previous != nil {
+		// Only the instances which stopped before the deadline are continued, their checkpoints are read from
+		// DynamoDB as the continuation may be outdated
+		status, err = lh.processor.ProcessInstances(ctx, previous.RdsInstanceIdentifiers())
+	} else {
+		status, err = lh.processor.Process(ctx)
+	}
+	// Processing is continued even if some instances failed, eg. because of a gap
+	continued := lh.continueProcessing(ctx, previous)
+	if err != nil {
+		log.WithError(err).Errorf("Error in Lambda function")
+		if len(event.Records) > 0 {
+			// The message must not be delivered again, the next continuation has been sent as a new message
+			return HandlerResult{Status: status, Continued: continued}, nil
+		}
+		return HandlerResult{}, fmt.Errorf("error in Lambda function")
+	}
+	log.WithFields(log.Fields{"status": status, "continued": continued}).Info("Lambda function finished")
+	return HandlerResult{Status: status, Continued: continued}, nil
+}
+
+// continueProcessing starts the next invocation if instances stopped before the deadline and returns true if it did
+func (lh *lambdaHandler) continueProcessing(ctx context.Context, previous *continuation.Continuation) bool {
+	if lh.continuer == nil {
+		return false
+	}
+	next := continuation.Next(previous, lh.stopped.Instances(), lh.maxContinuations)
+	if next == nil {
+		return false
+	}
+
+	err := lh.continuer.Continue(ctx, *next)
+	if err != nil {
+		log.WithError(err).Error("Could not continue processing, it is continued by the next scheduled invocation")
+		return false
+	}
+	log.WithFields(log.Fields{"chain": next.Chain, "instances": len(next.Instances)}).Info("Continuing processing in the next invocation")
+	return true
 }
 
 func main() {
@@ -52,34 +307,246 @@ func main() {
 		log.SetLevel(log.DebugLevel)
 	}
 
+	modes := 0
+	for _, set := range []bool{len(c.RdsInstanceIdentifier) > 0, c.RdsClusterIdentifier != "", c.DiscoveryTag != ""} {
+		if set {
+			modes++
+		}
+	}
+	if modes != 1 {
+		log.Fatal("Exactly one of RDS_INSTANCE_IDENTIFIER, RDS_CLUSTER_IDENTIFIER and DISCOVERY_TAG must be set")
+	}
+
 	// Initialize AWS session
+	awsHTTPClient, err := logcollector.NewHTTPClient(logcollector.HTTPClientOptions{
+		ProxyURL:           c.ProxyURL,
+		CABundle:           c.TLSCABundle,
+		InsecureSkipVerify: c.TLSInsecureSkipVerify,
+	})
+	if err != nil {
+		log.WithError(err).Fatal("Error creating HTTP client")
+	}
 	sessionConfig := &aws.Config{
-		Region: aws.String(c.AwsRegion),
+		Region:     aws.String(c.AwsRegion),
+		HTTPClient: awsHTTPClient,
 	}
 	sess := session.New(sessionConfig)
 
-	// Create & start lambda handler
-	lh := &lambdaHandler{
-		processor: processor.NewProcessor(
-			database.NewDynamoDb(
-				dynamodb.New(sess),
-				c.DynamoDbTableName,
-			),
-			logcollector.NewRdsLogCollector(
-				rds.New(sess),
-				logcollector.NewAWSHttpClient(sess),
-				c.AwsRegion,
-				c.RdsInstanceIdentifier,
-				"mysql",
-			),
-			s3writer.NewS3Writer(
-				s3manager.NewUploader(sess),
-				c.S3BucketName,
-				fmt.Sprintf("%s/%s", c.RdsInstanceIdentifier, "audit-logs"),
-			),
-			parser.NewAuditLogParser(),
+	db := database.NewDynamoDb(
+		dynamodb.New(sess, request.WithRetryer(endpointConfig(c.DynamoDbEndpoint), c.retryPolicy(c.DynamoDbMaxAttempts).SDKRetryer())),
+		c.DynamoDbTableName,
+	)
+	// RDS is accessed with the assumed roles, S3 and DynamoDB with the credentials of the lambda function
+	roleSessions := logcollector.NewRoleSessions(sess)
+	rdsRetry := c.retryPolicy(c.RdsMaxAttempts)
+	rdsClient := rds.New(roleSessions.Session(c.assumeRoleOptions("")), request.WithRetryer(endpointConfig(c.RdsEndpoint), rdsRetry.SDKRetryer()))
+	s3Config := endpointConfig(c.S3Endpoint).WithS3ForcePathStyle(c.S3ForcePathStyle)
+	s3Client := s3.New(sess, request.WithRetryer(s3Config, c.retryPolicy(c.S3MaxAttempts).SDKRetryer()))
+	uploader := s3manager.NewUploaderWithClient(s3Client)
+
+	pgAuditParser, err := parser.NewPgAuditParser(c.PgLogLinePrefix, c.PgLogTimezone)
+	if err != nil {
+		log.WithError(err).Fatal("Error creating PostgreSQL audit log parser")
+	}
+	parsers := parser.Parsers{
+		"mysql":    parser.NewAuditLogParser(),
+		"postgres": pgAuditParser,
+	}
+
+	downloadStrategy, err := logcollector.ParseDownloadStrategy(c.DownloadStrategy)
+	if err != nil {
+		log.WithError(err).Fatal("Invalid DOWNLOAD_STRATEGY")
+	}
+	// Failed complete downloads are counted across invocations, so the auto strategy keeps downloading in portions
+	downloadFallbacks := logcollector.NewDownloadFallbacks()
+
+	formatOptions := format.DefaultOptions()
+	formatOptions.ParquetCompression = c.ParquetCompression
+	formatOptions.ParquetRowGroupSize = c.ParquetRowGroupSize
+	formatOptions.AvroCompression = c.AvroCompression
+	formatOptions.SecurityLakeSource = c.SecurityLakeSource
+	formatOptions.Region = c.AwsRegion
+	// The account of the lambda function is the account of instances not accessed with a role of another account.
+	// Discovered instances may override the output format with ocsf.
+	var lambdaAccountID string
+	if c.needsAccountID() {
+		identity, err := sts.New(sess).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+		if err != nil {
+			log.WithError(err).Fatal("Error getting the account ID")
+		}
+		lambdaAccountID = aws.StringValue(identity.Account)
+	}
+	err = c.validateRoles(lambdaAccountID)
+	if err != nil {
+		log.WithError(err).Fatal("Invalid role configuration")
+	}
+	formatOptions.AccountID = lambdaAccountID
+	outputFormat, err := format.New(c.OutputFormat, formatOptions)
+	if err != nil {
+		log.WithError(err).Fatal("Invalid OUTPUT_FORMAT")
+	}
+
+	// The connection to the syslog collector is shared by all instances of an invocation
+	var syslogClient *syslogwriter.Client
+	if c.SyslogAddress != "" {
+		syslogClient, err = syslogwriter.NewClient(syslogwriter.ClientOptions{
+			Address:  c.SyslogAddress,
+			TLS:      c.SyslogTLS,
+			CertFile: c.SyslogClientCert,
+			KeyFile:  c.SyslogClientKey,
+			CABundle: c.SyslogCABundle,
+			Timeout:  c.SyslogTimeout,
+			Retry:    c.retryPolicy(c.SyslogMaxAttempts),
+		})
+		if err != nil {
+			log.WithError(err).Fatal("Error creating syslog client")
+		}
+	}
+
+	// Create lambda handler
+	lh := &lambdaHandler{maxContinuations: c.MaxContinuations, syslog: syslogClient}
+	switch c.Continuation {
+	case "none":
+	case "lambda":
+		lh.continuer = continuation.NewLambdaContinuer(awslambda.New(sess), lambdacontext.FunctionName)
+	case "sqs":
+		if c.ContinuationQueueURL == "" {
+			log.Fatal("CONTINUATION_QUEUE_URL must be set if CONTINUATION is sqs")
+		}
+		lh.continuer = continuation.NewSQSContinuer(sqs.New(sess), c.ContinuationQueueURL)
+	default:
+		log.Fatalf("Invalid CONTINUATION %s, must be none, lambda or sqs", c.Continuation)
+	}
+
+	// newInstanceFormat returns the output format of an RDS instance in the given account
+	newInstanceFormat := func(account string, name string) (format.Format, error) {
+		if name == c.OutputFormat && (name != "ocsf" || account == formatOptions.AccountID) {
+			return outputFormat, nil
+		}
+		// OCSF events belong to the account of the instance
+		instanceOptions := formatOptions
+		instanceOptions.AccountID = account
+		return format.New(name, instanceOptions)
+	}
+
+	// newInstanceProcessor creates the processor of an RDS instance, its key is the identifier optionally qualified
+	// with its account as <account>:<instance>. s3Prefix returns the prefix of its log objects, the account passed
+	// to it is empty if the instance is in the account of the lambda function.
+	newInstanceProcessor := func(key string, s3Prefix func(account string) string, formatName string) processor.LogProcessor {
+		// Only this instance fails, the others are still processed
+		account, err := c.instanceAccount(key, lambdaAccountID)
+		if err != nil {
+			return processor.NewFailedProcessor(err)
+		}
+		instanceFormat, err := newInstanceFormat(account, formatName)
+		if err != nil {
+			return processor.NewFailedProcessor(fmt.Errorf("invalid output format: %v", err))
+		}
+		otherAccount := ""
+		if account != lambdaAccountID {
+			otherAccount = account
+		}
+
+		_, rdsInstanceIdentifier := splitInstanceKey(key)
+		instanceSess := roleSessions.Session(c.assumeRoleOptions(key))
+		lc := logcollector.NewRdsLogCollector(
+			rds.New(instanceSess, request.WithRetryer(endpointConfig(c.RdsEndpoint), rdsRetry.SDKRetryer())),
+			logcollector.NewAWSHttpClient(instanceSess),
+			c.AwsRegion,
+			rdsInstanceIdentifier,
+			"mysql",
+		)
+		lc.DownloadStrategy = downloadStrategy
+		lc.Fallbacks = downloadFallbacks
+		lc.Retry = rdsRetry
+		if c.RdsEndpoint != "" {
+			lc.Endpoint = c.RdsEndpoint
+		}
+
+		writer := s3writer.NewS3Writer(
+			s3Client,
+			uploader,
+			c.S3BucketName,
+			s3Prefix(otherAccount),
+			instanceFormat,
+		)
+		if syslogClient != nil {
+			writer = syslogwriter.NewSyslogWriter(syslogClient.NewSender(), writer)
+		}
+
+		p := processor.NewProcessor(
+			db,
+			lc,
+			writer,
+			parsers,
+			rdsInstanceIdentifier,
+		)
+		p.InstanceKey = key
+		p.TailActiveLogFile = c.TailActiveLogFile
+		p.GapTolerance = c.GapTolerance
+		p.DeadlineMargin = c.DeadlineMargin
+		p.Continuation = lh.stopped
+		return p
+	}
+
+	// Start lambda handler
+	switch {
+	case c.DiscoveryTag != "":
+		tag := strings.SplitN(c.DiscoveryTag, "=", 2)
+		if len(tag) != 2 {
+			log.Fatal("DISCOVERY_TAG must have the format key=value")
+		}
+		lh.processor = processor.NewDiscoveryProcessor(
+			db,
+			logcollector.NewRdsTagInstanceDiscoverer(rdsClient, tag[0], tag[1]),
+			func(instance logcollector.DiscoveredInstance) processor.LogProcessor {
+				s3Prefix := func(account string) string {
+					if prefix, ok := instance.Overrides["s3-prefix"]; ok {
+						return prefix
+					}
+					return path.Join(account, instance.InstanceIdentifier, "audit-logs")
+				}
+				formatName := c.OutputFormat
+				if name, ok := instance.Overrides["output-format"]; ok {
+					formatName = name
+				}
+				return newInstanceProcessor(instance.InstanceIdentifier, s3Prefix, formatName)
+			},
+			c.Concurrency,
+			c.DiscoveryTag,
+		)
+	case c.RdsClusterIdentifier != "":
+		lh.processor = processor.NewClusterProcessor(
+			db,
+			logcollector.NewRdsClusterMemberLister(rdsClient, c.RdsClusterIdentifier),
+			func(rdsInstanceIdentifier string) processor.LogProcessor {
+				return newInstanceProcessor(rdsInstanceIdentifier, func(account string) string {
+					return path.Join(account, c.RdsClusterIdentifier, rdsInstanceIdentifier, "audit-logs")
+				}, c.OutputFormat)
+			},
+			c.Concurrency,
+			c.RdsClusterIdentifier,
+		)
+	default:
+		lh.processor = processor.NewMultiProcessor(
+			func(key string) processor.LogProcessor {
+				return newInstanceProcessor(key, func(account string) string {
+					_, rdsInstanceIdentifier := splitInstanceKey(key)
+					return path.Join(account, rdsInstanceIdentifier, "audit-logs")
+				}, c.OutputFormat)
+			},
+			c.Concurrency,
 			c.RdsInstanceIdentifier,
-		),
+		)
 	}
 	lambda.Start(lh.Handler)
 }
+
+// endpointConfig overrides the endpoint of a service if it is set, otherwise the endpoint is resolved from the region
+func endpointConfig(endpoint string) *aws.Config {
+	config := &aws.Config{}
+	if endpoint != "" {
+		config.Endpoint = aws.String(endpoint)
+	}
+	return config
+}